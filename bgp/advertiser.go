@@ -0,0 +1,46 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"net"
+)
+
+// Announcement describes prefix that is originated (advertised to BGP neighbors) by BGP plugin.
+// Prefix is in CIDR notation. If Nexthop is nil, BGP speaker's own address is used as next hop.
+// Optional attributes are not sent if they are not set (nil Med/LocalPref, empty Communities, zero AsPathPrepend).
+// AsPathPrepend says how many times the local AS is prepended to AS path in addition to the standard prepending
+// done on eBGP sessions.
+type Announcement struct {
+	Prefix        string
+	Nexthop       net.IP
+	Communities   []Community
+	Med           *uint32
+	LocalPref     *uint32
+	AsPathPrepend uint8
+}
+
+// AnnouncementHandle identifies prefix announced by Advertiser. It is the way how to withdraw exactly the announced route.
+type AnnouncementHandle interface {
+	//Withdraw withdraws the announced route from BGP neighbors.
+	Withdraw() error
+}
+
+// Advertiser provides the ability to originate prefixes (i.e. service VIPs or pod subnets) to BGP neighbors.
+type Advertiser interface {
+	//Announce advertises <announcement> to BGP neighbors. Returned <AnnouncementHandle> is the way how to withdraw
+	//the announced route in the future.
+	Announce(announcement Announcement) (AnnouncementHandle, error)
+}
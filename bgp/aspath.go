@@ -0,0 +1,126 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AsPathSegmentType is type of AS_PATH segment as defined in RFC 4271 and RFC 5065 (confederations).
+type AsPathSegmentType uint8
+
+const (
+	// AsSet is unordered set of ASes that route in the UPDATE message has traversed.
+	AsSet AsPathSegmentType = 1
+	// AsSequence is ordered set of ASes that route in the UPDATE message has traversed.
+	AsSequence AsPathSegmentType = 2
+	// AsConfedSequence is ordered set of Member ASes in the local confederation that the UPDATE message has traversed.
+	AsConfedSequence AsPathSegmentType = 3
+	// AsConfedSet is unordered set of Member ASes in the local confederation that the UPDATE message has traversed.
+	AsConfedSet AsPathSegmentType = 4
+)
+
+// String returns human readable name of AS_PATH segment type.
+func (t AsPathSegmentType) String() string {
+	switch t {
+	case AsSet:
+		return "as-set"
+	case AsSequence:
+		return "as-sequence"
+	case AsConfedSequence:
+		return "as-confed-sequence"
+	case AsConfedSet:
+		return "as-confed-set"
+	default:
+		return "unknown(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// isConfed returns true for segment types that describe path inside of local confederation.
+func (t AsPathSegmentType) isConfed() bool {
+	return t == AsConfedSequence || t == AsConfedSet
+}
+
+// AsPathSegment is one segment of AS_PATH attribute. ASes are kept in the same order as they are in the BGP message.
+type AsPathSegment struct {
+	Type AsPathSegmentType
+	ASes []uint32
+}
+
+// String returns segment in commonly used notation, i.e. sequence as "1 2 3", set as "{1,2,3}",
+// confederation sequence as "(1 2 3)" and confederation set as "[1,2,3]".
+func (s AsPathSegment) String() string {
+	ases := make([]string, 0, len(s.ASes))
+	for _, as := range s.ASes {
+		ases = append(ases, strconv.FormatUint(uint64(as), 10))
+	}
+	switch s.Type {
+	case AsSet:
+		return "{" + strings.Join(ases, ",") + "}"
+	case AsConfedSequence:
+		return "(" + strings.Join(ases, " ") + ")"
+	case AsConfedSet:
+		return "[" + strings.Join(ases, ",") + "]"
+	default:
+		return strings.Join(ases, " ")
+	}
+}
+
+// AsPath is AS_PATH attribute of route represented as ordered list of segments. The first segment is the one
+// added by the nearest AS (neighbor AS), the last segment contains the AS that originated the route (origin AS).
+type AsPath []AsPathSegment
+
+// String returns AS_PATH as space separated segments (see AsPathSegment.String()).
+func (p AsPath) String() string {
+	segments := make([]string, 0, len(p))
+	for _, segment := range p {
+		segments = append(segments, segment.String())
+	}
+	return strings.Join(segments, " ")
+}
+
+// OriginAs returns AS that originated the route, i.e. the last AS of the last (non-confederation) AS_SEQUENCE segment.
+// If the path ends with AS_SET, origin AS can be derived only from single-member set. Zero is returned if origin AS
+// can't be derived (i.e. for empty path of locally originated or iBGP routes).
+func (p AsPath) OriginAs() uint32 {
+	for i := len(p) - 1; i >= 0; i-- {
+		segment := p[i]
+		if segment.Type.isConfed() || len(segment.ASes) == 0 {
+			continue
+		}
+		if segment.Type == AsSet && len(segment.ASes) > 1 {
+			return 0
+		}
+		return segment.ASes[len(segment.ASes)-1]
+	}
+	return 0
+}
+
+// NeighborAs returns AS from which the route was received, i.e. the first AS of the first AS_SEQUENCE segment.
+// Confederation segments are skipped as defined in RFC 5065 (section 5.3). Zero is returned if path doesn't start
+// with AS_SEQUENCE (i.e. empty path of locally originated or iBGP routes).
+func (p AsPath) NeighborAs() uint32 {
+	for _, segment := range p {
+		if segment.Type.isConfed() || len(segment.ASes) == 0 {
+			continue
+		}
+		if segment.Type == AsSequence {
+			return segment.ASes[0]
+		}
+		return 0
+	}
+	return 0
+}
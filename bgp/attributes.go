@@ -0,0 +1,182 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+)
+
+// PathAttributes is typed set of BGP path attributes of route. Attributes that are not present in the route have
+// zero values (nil for optional attributes whose zero value is meaningful, i.e. Med or LocalPref). AS_PATH and next hop
+// attributes are not part of PathAttributes, because they are directly part of ReachableIPRoute.
+// Path attributes that have no typed field (unknown attributes or other optional attributes) are kept in Other.
+type PathAttributes struct {
+	Origin              Origin
+	Med                 *uint32
+	LocalPref           *uint32
+	Communities         []Community
+	ExtendedCommunities []ExtendedCommunity
+	LargeCommunities    []LargeCommunity
+	AtomicAggregate     bool
+	Aggregator          *Aggregator
+	OriginatorID        net.IP
+	ClusterList         []net.IP
+	Other               []RawPathAttribute
+}
+
+// Origin is value of ORIGIN path attribute (RFC 4271).
+type Origin uint8
+
+const (
+	// OriginIGP means that route is interior to the originating AS
+	OriginIGP Origin = 0
+	// OriginEGP means that route was learned via the EGP protocol
+	OriginEGP Origin = 1
+	// OriginIncomplete means that route was learned by some other means
+	OriginIncomplete Origin = 2
+)
+
+// String returns human readable name of origin.
+func (o Origin) String() string {
+	switch o {
+	case OriginIGP:
+		return "igp"
+	case OriginEGP:
+		return "egp"
+	case OriginIncomplete:
+		return "incomplete"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(o))
+	}
+}
+
+// Community is standard BGP community (RFC 1997). Upper 16 bits usually contain AS number and lower 16 bits
+// contain AS specific value.
+type Community uint32
+
+// NewCommunity creates community from its <as> and <value> parts.
+func NewCommunity(as uint16, value uint16) Community {
+	return Community(uint32(as)<<16 | uint32(value))
+}
+
+// LLGRStale is well-known LLGR_STALE community (RFC 9494) that marks routes retained as stale by long-lived graceful restart.
+const LLGRStale Community = 0xffff0006
+
+// String returns community in "as:value" notation.
+func (c Community) String() string {
+	return fmt.Sprintf("%d:%d", uint32(c)>>16, uint32(c)&0xffff)
+}
+
+// ExtendedCommunity is BGP extended community (RFC 4360) kept in its raw 8-octet form.
+type ExtendedCommunity [8]byte
+
+// Type returns type field (high-order octet) of extended community.
+func (c ExtendedCommunity) Type() uint8 {
+	return c[0]
+}
+
+// SubType returns sub-type field (low-order octet of extended type) of extended community.
+func (c ExtendedCommunity) SubType() uint8 {
+	return c[1]
+}
+
+// IsTransitive returns true if extended community is transitive across ASes (T bit of type field is not set).
+func (c ExtendedCommunity) IsTransitive() bool {
+	return c[0]&0x40 == 0
+}
+
+// Value returns value field (6 octets following type and sub-type) of extended community.
+func (c ExtendedCommunity) Value() []byte {
+	return c[2:]
+}
+
+// String returns extended community as type, sub-type and hexadecimal value (i.e. "0x00:0x02:0xfde800000064").
+func (c ExtendedCommunity) String() string {
+	return fmt.Sprintf("0x%02x:0x%02x:0x%x", c.Type(), c.SubType(), c.Value())
+}
+
+// NewLinkBandwidth creates non-transitive link bandwidth extended community (draft-ietf-idr-link-bandwidth) of <as>
+// with <bandwidth> in bytes per second.
+func NewLinkBandwidth(as uint16, bandwidth float32) ExtendedCommunity {
+	c := ExtendedCommunity{0x40, 0x04}
+	binary.BigEndian.PutUint16(c[2:4], as)
+	binary.BigEndian.PutUint32(c[4:8], math.Float32bits(bandwidth))
+	return c
+}
+
+// LinkBandwidth returns AS and bandwidth (in bytes per second) of link bandwidth extended community (both
+// non-transitive and transitive variant of draft-ietf-idr-link-bandwidth). Ok is false for other extended communities.
+func (c ExtendedCommunity) LinkBandwidth() (as uint16, bandwidth float32, ok bool) {
+	if c.SubType() != 0x04 || (c.Type() != 0x40 && c.Type() != 0x00) {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint16(c[2:4]), math.Float32frombits(binary.BigEndian.Uint32(c[4:8])), true
+}
+
+// NewRouterMAC creates EVPN router's MAC extended community (RFC 9135) carrying <mac>.
+func NewRouterMAC(mac net.HardwareAddr) ExtendedCommunity {
+	c := ExtendedCommunity{0x06, 0x03}
+	copy(c[2:8], mac)
+	return c
+}
+
+// RouterMAC returns MAC address of EVPN router's MAC extended community (RFC 9135). Ok is false for other extended
+// communities.
+func (c ExtendedCommunity) RouterMAC() (mac net.HardwareAddr, ok bool) {
+	if c.Type() != 0x06 || c.SubType() != 0x03 {
+		return nil, false
+	}
+	return net.HardwareAddr(append([]byte(nil), c[2:8]...)), true
+}
+
+// LargeCommunity is BGP large community (RFC 8092).
+type LargeCommunity struct {
+	GlobalAdmin uint32
+	LocalData1  uint32
+	LocalData2  uint32
+}
+
+// String returns large community in "global:local1:local2" notation.
+func (c LargeCommunity) String() string {
+	return fmt.Sprintf("%d:%d:%d", c.GlobalAdmin, c.LocalData1, c.LocalData2)
+}
+
+// Aggregator is value of AGGREGATOR path attribute (RFC 4271), i.e. AS number and IP address of BGP speaker that formed
+// the aggregate route.
+type Aggregator struct {
+	As      uint32
+	Address net.IP
+}
+
+// RawPathAttribute is path attribute in its raw form, i.e. attribute type code, attribute flags and attribute value
+// (without attribute header).
+type RawPathAttribute struct {
+	Type  uint8
+	Flags uint8
+	Value []byte
+}
+
+// IsOptional returns true if optional bit of attribute flags is set.
+func (a RawPathAttribute) IsOptional() bool {
+	return a.Flags&0x80 != 0
+}
+
+// IsTransitive returns true if transitive bit of attribute flags is set.
+func (a RawPathAttribute) IsTransitive() bool {
+	return a.Flags&0x40 != 0
+}
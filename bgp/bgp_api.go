@@ -16,15 +16,121 @@
 package bgp
 
 import (
+	"fmt"
 	"github.com/ligato/cn-infra/logging"
 	"net"
 )
 
 // ReachableIPRoute represents new learned IP-based route that could be used for route-based decisions.
+// As is the origin AS of route derived from AsPath (see AsPath.OriginAs()).
+// Prefix is in CIDR notation and its address family is given by Family. LinkLocalNexthop is filled only for IPv6 routes
+// whose MP_REACH_NLRI carries both global and link-local next hop address (Nexthop is then the global one).
+// Other BGP path attributes of route are in Attributes.
+// Multipath is ECMP next hop set of the prefix (including next hop of the route itself). It is filled only if multipath
+// is enabled in BGP speaker, otherwise it is nil.
+// L3VPN routes (see RouteFamily.IsVPN()) carry also their route distinguisher (i.e. "65000:100"), route targets
+// (i.e. "65000:100", taken from extended communities) and MPLS label stack. Prefix of L3VPN route doesn't contain
+// the route distinguisher. Labeled unicast routes (see RouteFamily.IsLabeledUnicast()) carry MPLS label stack
+// too (Labels is nil for other routes).
+// PathID is path identifier of route (RFC 7911) that tells apart paths of the same prefix received from the same peer
+// with ADD-PATH (0 if ADD-PATH is not used). SourcePeer is address of peer that the route was received from (nil for
+// locally originated routes). Stale is true for route that is retained, because session with its peer was lost while
+// the peer is gracefully restarting (RFC 4724) or that carries LLGR_STALE community of long-lived graceful restart
+// (see LLGRStale). Stale route is refreshed or withdrawn when the peer finishes restart or the restart time expires.
 type ReachableIPRoute struct {
-	As      uint32
-	Prefix  string
+	As                 uint32
+	Family             RouteFamily
+	Prefix             string
+	Nexthop            net.IP
+	LinkLocalNexthop   net.IP
+	AsPath             AsPath
+	Attributes         PathAttributes
+	Multipath          []MultipathNexthop
+	RouteDistinguisher string
+	RouteTargets       []string
+	Labels             []uint32
+	PathID             uint32
+	SourcePeer         net.IP
+	Stale              bool
+}
+
+// MultipathNexthop is one member of ECMP next hop set of route.
+// Weight is link bandwidth (in bytes per second) taken from link bandwidth extended community of the path that
+// uses the next hop. It is 0 if the path has no such community. Weighted ECMP should split traffic proportionally
+// to weights.
+type MultipathNexthop struct {
 	Nexthop net.IP
+	Weight  float32
+}
+
+// IPNet returns prefix of route parsed as IP network.
+func (route *ReachableIPRoute) IPNet() (*net.IPNet, error) {
+	_, prefix, err := net.ParseCIDR(route.Prefix)
+	return prefix, err
+}
+
+// RouteEventType identifies the kind of reachability change that is described by RouteEvent.
+type RouteEventType int
+
+const (
+	// RouteAdded means that a best path was learned for prefix that was not reachable before.
+	RouteAdded RouteEventType = iota
+	// RouteUpdated means that a new best path was selected for already reachable prefix.
+	RouteUpdated
+	// RouteWithdrawn means that prefix is no longer reachable.
+	RouteWithdrawn
+	// RIBSnapshotEnd marks the end of RIB snapshot (see WithRIBSnapshot()). It carries no route.
+	RIBSnapshotEnd
+	// WatchDisconnected means that watcher was disconnected, because it didn't keep up with route changes
+	// (see OverflowDisconnect) or because the watched VRF was deleted (see WithVrf()). It carries no route and it is
+	// the last event sent to watcher.
+	WatchDisconnected
+	// RouteStale means that route of reachable prefix became stale (see ReachableIPRoute.Stale) instead of being
+	// withdrawn. Forwarding should be kept until the route is refreshed (RouteUpdated) or swept (RouteWithdrawn).
+	RouteStale
+	// ResyncStart marks the start of resynchronization of watcher after re-establishment of lost BGP session. It is
+	// followed by all currently reachable routes (as RouteAdded events) and ResyncEnd marker. Route events sent by the peer
+	// after re-establishment of the session can come before ResyncEnd. Routes held by watcher that were not resent before
+	// ResyncEnd are no longer reachable. ResyncStart carries no route.
+	ResyncStart
+	// ResyncEnd marks the end of resynchronization of watcher (see ResyncStart). It carries no route.
+	ResyncEnd
+)
+
+// String returns human readable name of route event type.
+func (t RouteEventType) String() string {
+	switch t {
+	case RouteAdded:
+		return "added"
+	case RouteUpdated:
+		return "updated"
+	case RouteWithdrawn:
+		return "withdrawn"
+	case RIBSnapshotEnd:
+		return "rib-snapshot-end"
+	case WatchDisconnected:
+		return "watch-disconnected"
+	case RouteStale:
+		return "stale"
+	case ResyncStart:
+		return "resync-start"
+	case ResyncEnd:
+		return "resync-end"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(t))
+	}
+}
+
+// RouteEvent represents one change of IP-based route reachability.
+// Route is the newly learned route for RouteAdded and RouteUpdated events and the stale route for RouteStale events.
+// For RouteWithdrawn events it identifies the withdrawn prefix. PreviousRoute is the route that was reachable before
+// the change, so it is filled only for RouteUpdated, RouteStale and RouteWithdrawn events. Stamp identifies position
+// of the event in the stream of events sent to watcher (see EventStamp).
+type RouteEvent struct {
+	Type          RouteEventType
+	Route         *ReachableIPRoute
+	PreviousRoute *ReachableIPRoute
+	Stamp         EventStamp
 }
 
 // WatchRegistration represents both-side-agreed agreement between Plugin and watchers that binds Plugin to notify watchers
@@ -32,7 +138,12 @@ type ReachableIPRoute struct {
 // WatchRegistration implementation is meant for watcher side as evidence about agreement and way how to access watcher side
 // control upon agreement (i.e. to close it). Implementations don't have to be thread-safe.
 type WatchRegistration interface {
+	//ID returns identification of the registration that is unique among all registrations made to the Plugin
+	//(also among registrations that reuse the name of already closed registration).
+	ID() uint64
+
 	//Close ends the agreement between Plugin and watcher. Plugin stops sending watcher any further notifications.
+	//Close is idempotent and it never affects other registrations, even those with the same watcher name.
 	Close() error
 }
 
@@ -40,19 +151,36 @@ type WatchRegistration interface {
 // Duty of Watcher implementation is to notify its clients(watchers) about new learned BGP information.
 type Watcher interface {
 	//WatchIPRoutes register watcher to notifications for any new learned IP-based routes.
+	//Only announcements (added or updated routes) are passed to <callback>, withdrawals are not. Use WatchIPRouteEvents
+	//to be notified about all kinds of route changes.
 	//Watcher have to identify himself by name(<watcher> param) and provide <callback> so that GoBGP can sent information to watcher.
 	//WatchIPRoutes returns <bgp.WatchRegistration> as way how to control the watcher-goBGPlugin agreement from the watcher side in the future.
-	//It also returns error to indicate failure, but currently for this plugin is not known use case of failure.
-	//WatchRegistration is not retroactive, that means that any IP-based routes learned in the past are not send to new watchers.
+	//It fails with ErrNilCallback if <callback> is nil and with DuplicateWatcherError if watcher with the same name
+	//is already registered (name can be reused after closing of previous registration).
+	//WatchRegistration is not retroactive by default, that means that any IP-based routes learned in the past are not send to new watchers.
 	//This also means that if you want be notified of all learned IP-based routes, you must register before calling of
 	//AfterInit(). In case of external(=not other plugin started with this plugin) watchers this means before plugin start.
 	//However, late-registered watchers are permitted (no error will be returned), but they can miss some learned IP-based routes.
-	WatchIPRoutes(watcher string, callback func(*ReachableIPRoute)) (WatchRegistration, error)
+	//Late-registered watchers that can't miss any route should use WithRIBSnapshot() option (<opts> param).
+	WatchIPRoutes(watcher string, callback func(*ReachableIPRoute), opts ...WatchOption) (WatchRegistration, error)
+
+	//WatchIPRouteEvents register watcher to notifications for any change of IP-based routes, i.e. addition of new route,
+	//update of best path for already known prefix and withdrawal of prefix. Registration semantics are the same as for WatchIPRoutes.
+	WatchIPRouteEvents(watcher string, callback func(*RouteEvent), opts ...WatchOption) (WatchRegistration, error)
+
+	//WatchIPRouteBatches register watcher to notifications for any change of IP-based routes like WatchIPRouteEvents,
+	//but route events are passed to <callback> in batches, so that high-volume route churn (i.e. full table after session
+	//reset) doesn't cost one callback per route. Events caused by one event of BGP implementation are passed in the same
+	//batch unless the batch is full (see WithBatching()). Within one batch the latest event of each prefix wins,
+	//earlier events of the prefix are merged into it (see MergeRouteEvents()). Registration semantics are the same
+	//as for WatchIPRoutes.
+	WatchIPRouteBatches(watcher string, callback func([]*RouteEvent), opts ...WatchOption) (WatchRegistration, error)
 }
 
 // ToChan creates a callback that can be passed to the Watch function in order to receive
 // notifications through the channel <ch>.
 // Function uses given logger for debug purposes to print received ReachableIPRoutes.
+// The callback blocks if the channel is full. Use WatchContext for watching that can be cancelled.
 func ToChan(ch chan ReachableIPRoute, logger logging.Logger) func(info *ReachableIPRoute) {
 	return func(info *ReachableIPRoute) {
 		ch <- *info
@@ -16,11 +16,15 @@
 package bgp_test
 
 import (
+	"context"
+	"errors"
 	"github.com/ligato/bgp-agent/bgp"
 	"github.com/ligato/cn-infra/logging/logrus"
 	. "github.com/onsi/gomega"
 	"net"
+	"sync"
 	"testing"
+	"time"
 )
 
 // TestHelper allows tests to be written in given/when/then idiom of BDD
@@ -38,6 +42,15 @@ type Variables struct {
 	channel      chan bgp.ReachableIPRoute
 	wrappingFunc func(info *bgp.ReachableIPRoute)
 	sentRoute    bgp.ReachableIPRoute
+	asPath       bgp.AsPath
+	filter       *bgp.RouteFilter
+	event        *bgp.RouteEvent
+	watcher      *fakeWatcher
+	cancelWatch  context.CancelFunc
+	events       <-chan bgp.RouteEvent
+	errors       <-chan error
+	callbackDone chan struct{}
+	extCommunity bgp.ExtendedCommunity
 }
 
 // Given is composition of multiple test step methods (see BDD Given keyword)
@@ -90,3 +103,301 @@ func (t *Then) ChannelReceivesIt() {
 	Expect(received).To(Equal(t.vars.sentRoute))
 	Expect(t.vars.channel).To(BeEmpty())
 }
+
+// AsPathWithConfederation adds AS path that was received from confederation peer to Given things (see BDD Given).
+func (g *Given) AsPathWithConfederation() {
+	g.vars.asPath = bgp.AsPath{
+		{Type: bgp.AsConfedSequence, ASes: []uint32{65010}},
+		{Type: bgp.AsSequence, ASes: []uint32{65001, 65002, 65003}},
+	}
+}
+
+// AsPathOfAggregatedRoute adds AS path of route aggregated from routes of multiple origin ASes to Given things (see BDD Given).
+func (g *Given) AsPathOfAggregatedRoute() {
+	g.vars.asPath = bgp.AsPath{
+		{Type: bgp.AsSequence, ASes: []uint32{65001}},
+		{Type: bgp.AsSet, ASes: []uint32{65002, 65003}},
+	}
+}
+
+// OriginAsIs asserts that origin AS derived from previously Given AS path is <expected>.
+func (t *Then) OriginAsIs(expected uint32) {
+	Expect(t.vars.asPath.OriginAs()).To(Equal(expected))
+}
+
+// NeighborAsIs asserts that neighbor AS derived from previously Given AS path is <expected>.
+func (t *Then) NeighborAsIs(expected uint32) {
+	Expect(t.vars.asPath.NeighborAs()).To(Equal(expected))
+}
+
+// AsPathIsPrintedAs asserts that string representation of previously Given AS path is <expected>.
+func (t *Then) AsPathIsPrintedAs(expected string) {
+	Expect(t.vars.asPath.String()).To(Equal(expected))
+}
+
+// FilterWithPrefixList adds route filter with one prefix list entry (<prefix> with <ge> and <le> length range) to Given
+// things (see BDD Given).
+func (g *Given) FilterWithPrefixList(prefix string, ge uint8, le uint8) {
+	_, network, err := net.ParseCIDR(prefix)
+	Expect(err).To(BeNil())
+	g.vars.filter = &bgp.RouteFilter{Prefixes: []bgp.PrefixMatch{{Prefix: network, Ge: ge, Le: le}}}
+}
+
+// FilterWithOriginAsAndNexthopSubnet adds route filter that restricts both origin AS and next hop of routes to Given things
+// (see BDD Given).
+func (g *Given) FilterWithOriginAsAndNexthopSubnet(originAs uint32, subnet string) {
+	_, network, err := net.ParseCIDR(subnet)
+	Expect(err).To(BeNil())
+	g.vars.filter = &bgp.RouteFilter{OriginAs: []uint32{originAs}, NexthopSubnets: []*net.IPNet{network}}
+}
+
+// FilterWithCommunity adds route filter that passes only routes with given <community> to Given things (see BDD Given).
+func (g *Given) FilterWithCommunity(community bgp.Community) {
+	g.vars.filter = &bgp.RouteFilter{Communities: []bgp.Community{community}}
+}
+
+// RouteIsUpdatedToLoseCommunity creates route update event where previous route has community required by Given filter
+// and new route doesn't have it. Event is passed through Given filter.
+func (w *When) RouteIsUpdatedToLoseCommunity() {
+	w.vars.event = w.vars.filter.FilterEvent(&bgp.RouteEvent{
+		Type:          bgp.RouteUpdated,
+		Route:         &bgp.ReachableIPRoute{Prefix: "10.0.0.0/24"},
+		PreviousRoute: &bgp.ReachableIPRoute{Prefix: "10.0.0.0/24", Attributes: bgp.PathAttributes{Communities: w.vars.filter.Communities}},
+	})
+}
+
+// RouteIsUpdatedToGainCommunity creates route update event where new route has community required by Given filter
+// and previous route doesn't have it. Event is passed through Given filter.
+func (w *When) RouteIsUpdatedToGainCommunity() {
+	w.vars.event = w.vars.filter.FilterEvent(&bgp.RouteEvent{
+		Type:          bgp.RouteUpdated,
+		Route:         &bgp.ReachableIPRoute{Prefix: "10.0.0.0/24", Attributes: bgp.PathAttributes{Communities: w.vars.filter.Communities}},
+		PreviousRoute: &bgp.ReachableIPRoute{Prefix: "10.0.0.0/24"},
+	})
+}
+
+// RoutesPassFilter asserts that routes with given <prefixes> pass previously Given filter.
+func (t *Then) RoutesPassFilter(prefixes ...string) {
+	for _, prefix := range prefixes {
+		Expect(t.vars.filter.Match(&bgp.ReachableIPRoute{Prefix: prefix})).To(BeTrue(), "Route %v should pass filter", prefix)
+	}
+}
+
+// RoutesDontPassFilter asserts that routes with given <prefixes> don't pass previously Given filter.
+func (t *Then) RoutesDontPassFilter(prefixes ...string) {
+	for _, prefix := range prefixes {
+		Expect(t.vars.filter.Match(&bgp.ReachableIPRoute{Prefix: prefix})).To(BeFalse(), "Route %v should not pass filter", prefix)
+	}
+}
+
+// RouteFromAsViaNexthopPassesFilter asserts that route originated by <originAs> with <nexthop> passes previously Given filter.
+func (t *Then) RouteFromAsViaNexthopPassesFilter(originAs uint32, nexthop string) {
+	Expect(t.vars.filter.Match(routeFromAsViaNexthop(originAs, nexthop))).To(BeTrue())
+}
+
+// RouteFromAsViaNexthopDoesntPassFilter asserts that route originated by <originAs> with <nexthop> doesn't pass previously Given filter.
+func (t *Then) RouteFromAsViaNexthopDoesntPassFilter(originAs uint32, nexthop string) {
+	Expect(t.vars.filter.Match(routeFromAsViaNexthop(originAs, nexthop))).To(BeFalse())
+}
+
+// FilteredEventIs asserts that event produced by filter has <expected> type.
+func (t *Then) FilteredEventIs(expected bgp.RouteEventType) {
+	Expect(t.vars.event).NotTo(BeNil())
+	Expect(t.vars.event.Type).To(Equal(expected))
+}
+
+// EventsAreMerged merges two events of the same prefix with <olderType> and <newerType>. Older event carries route via next hop
+// 10.0.0.2 (and previous route via 10.0.0.1 if it is not addition), newer event carries route via next hop 10.0.0.3.
+func (w *When) EventsAreMerged(olderType bgp.RouteEventType, newerType bgp.RouteEventType) {
+	older := &bgp.RouteEvent{Type: olderType, Route: routeFromAsViaNexthop(65001, "10.0.0.2")}
+	if olderType != bgp.RouteAdded {
+		older.PreviousRoute = routeFromAsViaNexthop(65001, "10.0.0.1")
+	}
+	newer := &bgp.RouteEvent{Type: newerType, Route: routeFromAsViaNexthop(65001, "10.0.0.3"), PreviousRoute: older.Route}
+	w.vars.event = bgp.MergeRouteEvents(older, newer)
+}
+
+// MergedEventIs asserts that merged event has <expected> type, carries route of newer event and route before older event
+// as previous route (if <hasPrevious>).
+func (t *Then) MergedEventIs(expected bgp.RouteEventType, hasPrevious bool) {
+	Expect(t.vars.event).NotTo(BeNil())
+	Expect(t.vars.event.Type).To(Equal(expected))
+	Expect(t.vars.event.Route.Nexthop.String()).To(Equal("10.0.0.3"))
+	if hasPrevious {
+		Expect(t.vars.event.PreviousRoute).NotTo(BeNil())
+		Expect(t.vars.event.PreviousRoute.Nexthop.String()).To(Equal("10.0.0.1"))
+	} else {
+		Expect(t.vars.event.PreviousRoute).To(BeNil())
+	}
+}
+
+// EventsCancelEachOther asserts that merged events canceled each other.
+func (t *Then) EventsCancelEachOther() {
+	Expect(t.vars.event).To(BeNil())
+}
+
+// routeFromAsViaNexthop creates route originated by <originAs> (received from neighbor AS 65001) with given <nexthop>.
+func routeFromAsViaNexthop(originAs uint32, nexthop string) *bgp.ReachableIPRoute {
+	return &bgp.ReachableIPRoute{
+		Prefix:  "10.0.0.0/24",
+		Nexthop: net.ParseIP(nexthop),
+		AsPath:  bgp.AsPath{{Type: bgp.AsSequence, ASes: []uint32{65001, originAs}}},
+	}
+}
+
+// ContextWatchOfWatcher starts context-bound watching of fake watcher by bgp.WatchContext (see BDD Given).
+func (g *Given) ContextWatchOfWatcher() {
+	g.startContextWatch(&fakeWatcher{})
+}
+
+// ContextWatchOfFailingWatcher starts context-bound watching of fake watcher that refuses all registrations (see BDD Given).
+func (g *Given) ContextWatchOfFailingWatcher() {
+	g.startContextWatch(&fakeWatcher{err: errors.New("registration refused")})
+}
+
+// startContextWatch starts context-bound watching of <watcher> and remembers cancel function of the context.
+func (g *Given) startContextWatch(watcher *fakeWatcher) {
+	var ctx context.Context
+	ctx, g.vars.cancelWatch = context.WithCancel(context.Background())
+	g.vars.watcher = watcher
+	g.vars.events, g.vars.errors = bgp.WatchContext(ctx, watcher, "contextWatcher")
+}
+
+// WatcherNotifiesAddedRoute passes route addition event to callback registered in fake watcher. Callback is called from
+// separate goroutine (as real watcher would do), because it blocks until the event is read from event channel.
+func (w *When) WatcherNotifiesAddedRoute() {
+	w.vars.sentRoute = bgp.ReachableIPRoute{As: 1, Prefix: "1.2.3.4/32", Nexthop: net.IPv4(192, 168, 1, 1)}
+	w.vars.watcher.notify(&bgp.RouteEvent{Type: bgp.RouteAdded, Route: &w.vars.sentRoute}, w.vars)
+}
+
+// WatcherDisconnects passes bgp.WatchDisconnected event to callback registered in fake watcher.
+func (w *When) WatcherDisconnects() {
+	w.vars.watcher.notify(&bgp.RouteEvent{Type: bgp.WatchDisconnected}, w.vars)
+}
+
+// ContextIsCancelled cancels the context of watching.
+func (w *When) ContextIsCancelled() {
+	w.vars.cancelWatch()
+}
+
+// EventChannelReceivesAddedRoute asserts that event channel receives route addition event with sent route.
+func (t *Then) EventChannelReceivesAddedRoute() {
+	var event bgp.RouteEvent
+	Eventually(t.vars.events).Should(Receive(&event))
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(*event.Route).To(Equal(t.vars.sentRoute))
+	Eventually(t.vars.callbackDone).Should(BeClosed())
+}
+
+// EventChannelReceivesDisconnection asserts that event channel receives bgp.WatchDisconnected event.
+func (t *Then) EventChannelReceivesDisconnection() {
+	var event bgp.RouteEvent
+	Eventually(t.vars.events).Should(Receive(&event))
+	Expect(event.Type).To(Equal(bgp.WatchDisconnected))
+}
+
+// WatchingEnds asserts that the watcher was unregistered, callback doesn't block anymore and both channels are closed.
+func (t *Then) WatchingEnds() {
+	Eventually(t.vars.events).Should(BeClosed())
+	Eventually(t.vars.errors).Should(BeClosed())
+	Expect(t.vars.watcher.isClosed()).To(BeTrue())
+	if t.vars.callbackDone != nil {
+		Eventually(t.vars.callbackDone).Should(BeClosed())
+	}
+}
+
+// ErrorChannelReceivesRegistrationFailure asserts that error of refused registration is sent to error channel
+// and that both channels are closed.
+func (t *Then) ErrorChannelReceivesRegistrationFailure() {
+	Expect(t.vars.errors).To(Receive(MatchError("registration refused")))
+	Expect(t.vars.errors).To(BeClosed())
+	Expect(t.vars.events).To(BeClosed())
+}
+
+// LinkBandwidthCommunity adds link bandwidth extended community of <as> with <bandwidth> to Given things (see BDD Given).
+func (g *Given) LinkBandwidthCommunity(as uint16, bandwidth float32) {
+	g.vars.extCommunity = bgp.NewLinkBandwidth(as, bandwidth)
+}
+
+// TransitiveLinkBandwidthCommunity adds transitive link bandwidth extended community (type 0x00) of AS 65001 with
+// bandwidth 1250000 bytes per second to Given things (see BDD Given).
+func (g *Given) TransitiveLinkBandwidthCommunity() {
+	g.vars.extCommunity = bgp.ExtendedCommunity{0x00, 0x04, 0xfd, 0xe9, 0x49, 0x98, 0x96, 0x80}
+}
+
+// RouteTargetCommunity adds route target extended community to Given things (see BDD Given).
+func (g *Given) RouteTargetCommunity() {
+	g.vars.extCommunity = bgp.ExtendedCommunity{0x00, 0x02, 0xfd, 0xe9, 0x00, 0x00, 0x00, 0x64}
+}
+
+// LinkBandwidthIs asserts that given extended community is link bandwidth community of <as> with <bandwidth>.
+func (t *Then) LinkBandwidthIs(as uint16, bandwidth float32) {
+	actualAs, actualBandwidth, ok := t.vars.extCommunity.LinkBandwidth()
+	Expect(ok).To(BeTrue())
+	Expect(actualAs).To(Equal(as))
+	Expect(actualBandwidth).To(Equal(bandwidth))
+}
+
+// IsNotLinkBandwidth asserts that given extended community is not link bandwidth community.
+func (t *Then) IsNotLinkBandwidth() {
+	_, _, ok := t.vars.extCommunity.LinkBandwidth()
+	Expect(ok).To(BeFalse())
+}
+
+// fakeWatcher is bgp.Watcher (and also its bgp.WatchRegistration) that only remembers callback of registered watcher.
+type fakeWatcher struct {
+	sync.Mutex
+	callback func(*bgp.RouteEvent)
+	closed   bool
+	err      error // error returned by registration
+}
+
+// WatchIPRoutes is not used by tests.
+func (w *fakeWatcher) WatchIPRoutes(watcher string, callback func(*bgp.ReachableIPRoute), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	return nil, errors.New("not implemented")
+}
+
+// WatchIPRouteEvents remembers <callback> or fails with configured error.
+func (w *fakeWatcher) WatchIPRouteEvents(watcher string, callback func(*bgp.RouteEvent), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	w.callback = callback
+	return w, nil
+}
+
+// WatchIPRouteBatches is not used by tests.
+func (w *fakeWatcher) WatchIPRouteBatches(watcher string, callback func([]*bgp.RouteEvent), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	return nil, errors.New("not implemented")
+}
+
+// ID returns constant registration ID.
+func (w *fakeWatcher) ID() uint64 {
+	return 1
+}
+
+// Close marks registration as closed.
+func (w *fakeWatcher) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	w.closed = true
+	return nil
+}
+
+// isClosed returns true if the registration was closed.
+func (w *fakeWatcher) isClosed() bool {
+	w.Lock()
+	defer w.Unlock()
+	return w.closed
+}
+
+// notify passes <event> to registered callback in separate goroutine. End of callback is signalled by closing of
+// callbackDone channel in <vars>.
+func (w *fakeWatcher) notify(event *bgp.RouteEvent, vars *Variables) {
+	vars.callbackDone = make(chan struct{})
+	go func(done chan struct{}) {
+		w.callback(event)
+		close(done)
+	}(vars.callbackDone)
+	time.Sleep(10 * time.Millisecond) // gives callback time to block on event channel
+}
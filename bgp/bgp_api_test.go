@@ -16,6 +16,7 @@
 package bgp_test
 
 import (
+	"github.com/ligato/bgp-agent/bgp"
 	"testing"
 )
 
@@ -30,3 +31,143 @@ func TestToChan(x *testing.T) {
 	t.When.SentRouteToWrappingFunc()
 	t.Then.ChannelReceivesIt()
 }
+
+// TestAsPathDerivedASes tests derivation of origin AS and neighbor AS from AS path that starts with confederation segment.
+// Confederation segments must be skipped and the path must be printable in common AS path notation.
+func TestAsPathDerivedASes(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.Given.AsPathWithConfederation()
+	t.Then.OriginAsIs(65003)
+	t.Then.NeighborAsIs(65001)
+	t.Then.AsPathIsPrintedAs("(65010) 65001 65002 65003")
+}
+
+// TestAsPathEndingWithAsSet tests that origin AS of aggregated route (path ending with multi-member AS_SET) is not guessed.
+func TestAsPathEndingWithAsSet(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.Given.AsPathOfAggregatedRoute()
+	t.Then.OriginAsIs(0)
+	t.Then.NeighborAsIs(65001)
+	t.Then.AsPathIsPrintedAs("65001 {65002,65003}")
+}
+
+// TestPrefixListFilter tests matching of route prefixes against prefix list entry with ge/le prefix length range.
+func TestPrefixListFilter(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.Given.FilterWithPrefixList("10.0.0.0/8", 16, 24)
+	t.Then.RoutesPassFilter("10.1.0.0/16", "10.1.2.0/24")
+	t.Then.RoutesDontPassFilter("10.0.0.0/8", "10.1.2.128/25", "11.1.0.0/16", "2001:db8::/32")
+}
+
+// TestFilterWithMultipleCriteria tests that route passes filter only if it matches all filter criteria.
+func TestFilterWithMultipleCriteria(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.Given.FilterWithOriginAsAndNexthopSubnet(65003, "192.168.1.0/24")
+	t.Then.RouteFromAsViaNexthopPassesFilter(65003, "192.168.1.1")
+	t.Then.RouteFromAsViaNexthopDoesntPassFilter(65004, "192.168.1.1")
+	t.Then.RouteFromAsViaNexthopDoesntPassFilter(65003, "192.168.2.1")
+}
+
+// TestFilterTurnsUpdatesIntoAddAndWithdraw tests that route updates are translated by filter so that watcher
+// state stays consistent, i.e. update of route that stops to pass the filter is seen by watcher as withdrawal and
+// update of route that starts to pass the filter is seen as addition.
+func TestFilterTurnsUpdatesIntoAddAndWithdraw(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.Given.FilterWithCommunity(bgp.NewCommunity(65000, 10))
+	t.When.RouteIsUpdatedToLoseCommunity()
+	t.Then.FilteredEventIs(bgp.RouteWithdrawn)
+	t.When.RouteIsUpdatedToGainCommunity()
+	t.Then.FilteredEventIs(bgp.RouteAdded)
+}
+
+// TestMergeRouteEvents tests merging of consecutive route events of the same prefix. Merged event must describe the change
+// from the state before the first event to the state after the second event.
+func TestMergeRouteEvents(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.When.EventsAreMerged(bgp.RouteAdded, bgp.RouteUpdated)
+	t.Then.MergedEventIs(bgp.RouteAdded, false)
+	t.When.EventsAreMerged(bgp.RouteUpdated, bgp.RouteUpdated)
+	t.Then.MergedEventIs(bgp.RouteUpdated, true)
+	t.When.EventsAreMerged(bgp.RouteUpdated, bgp.RouteWithdrawn)
+	t.Then.MergedEventIs(bgp.RouteWithdrawn, true)
+	t.When.EventsAreMerged(bgp.RouteWithdrawn, bgp.RouteAdded)
+	t.Then.MergedEventIs(bgp.RouteUpdated, true)
+	t.When.EventsAreMerged(bgp.RouteUpdated, bgp.RouteStale)
+	t.Then.MergedEventIs(bgp.RouteStale, true)
+	t.When.EventsAreMerged(bgp.RouteStale, bgp.RouteUpdated)
+	t.Then.MergedEventIs(bgp.RouteUpdated, true)
+	t.When.EventsAreMerged(bgp.RouteAdded, bgp.RouteWithdrawn)
+	t.Then.EventsCancelEachOther()
+}
+
+// TestLinkBandwidthCommunity tests reading of AS and bandwidth from both variants of link bandwidth extended community
+// (used as weights of ECMP next hops) and that other extended communities are not taken for link bandwidth.
+func TestLinkBandwidthCommunity(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.Given.LinkBandwidthCommunity(65001, 125000000)
+	t.Then.LinkBandwidthIs(65001, 125000000)
+	t.Given.TransitiveLinkBandwidthCommunity()
+	t.Then.LinkBandwidthIs(65001, 1250000)
+	t.Given.RouteTargetCommunity()
+	t.Then.IsNotLinkBandwidth()
+}
+
+// TestWatchContext tests ability of WatchContext(...) function to pass route events from watcher's callback to event channel
+// and to unregister the watcher (and close channels) when the context is cancelled.
+func TestWatchContext(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.Given.ContextWatchOfWatcher()
+	t.When.WatcherNotifiesAddedRoute()
+	t.Then.EventChannelReceivesAddedRoute()
+
+	t.When.ContextIsCancelled()
+	t.Then.WatchingEnds()
+}
+
+// TestWatchContextCancellationUnblocksCallback tests that cancellation of the context unblocks watcher's callback that waits
+// for reader of event channel.
+func TestWatchContextCancellationUnblocksCallback(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.Given.ContextWatchOfWatcher()
+	t.When.WatcherNotifiesAddedRoute()
+	t.When.ContextIsCancelled()
+	t.Then.WatchingEnds()
+}
+
+// TestWatchContextDisconnection tests that watching by WatchContext(...) ends after watcher is disconnected (i.e. slow reader).
+func TestWatchContextDisconnection(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.Given.ContextWatchOfWatcher()
+	t.When.WatcherDisconnects()
+	t.Then.EventChannelReceivesDisconnection()
+	t.Then.WatchingEnds()
+}
+
+// TestWatchContextRegistrationFailure tests that failure of registration is passed to error channel of WatchContext(...).
+func TestWatchContextRegistrationFailure(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+
+	t.Given.ContextWatchOfFailingWatcher()
+	t.Then.ErrorChannelReceivesRegistrationFailure()
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+// MergeRouteEvents merges two consecutive events of the same prefix into one event that describes the change from the state
+// before <older> event to the state after <newer> event. Nil is returned if the events cancel each other (prefix was added
+// and withdrawn again). Events that carry no route (markers) can't be merged, so <newer> is returned for them.
+func MergeRouteEvents(older, newer *RouteEvent) *RouteEvent {
+	if older.Route == nil || newer.Route == nil {
+		return newer
+	}
+	if older.Type == RouteWithdrawn && newer.Type == RouteWithdrawn {
+		return older
+	}
+	merged, cancel := mergeEventTypes(older.Type, newer.Type)
+	if cancel {
+		return nil
+	}
+	return &RouteEvent{Type: merged, Route: newer.Route, PreviousRoute: older.PreviousRoute}
+}
+
+// mergeEventTypes returns type of event merged from two consecutive events of types <older> and <newer>. Cancel is true
+// if the events cancel each other (route was added and withdrawn again). Route that became stale stays stale until
+// it is refreshed or withdrawn.
+func mergeEventTypes(older, newer RouteEventType) (merged RouteEventType, cancel bool) {
+	switch {
+	case older == RouteAdded && newer == RouteWithdrawn:
+		return older, true
+	case older == RouteAdded:
+		return RouteAdded, false
+	case newer == RouteWithdrawn:
+		return RouteWithdrawn, false
+	case newer == RouteStale:
+		return RouteStale, false
+	default:
+		return RouteUpdated, false
+	}
+}
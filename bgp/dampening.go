@@ -0,0 +1,95 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DampeningConfig is configuration of route flap dampening (RFC 2439) of route events sent to watchers.
+// Penalty is added to penalty of prefix for each its withdrawal or update. Penalty of prefix decays exponentially,
+// it is halved each HalfLife. Events of prefix whose penalty exceeds SuppressThreshold are suppressed (held back)
+// until its penalty decays below ReuseThreshold. Prefix is never suppressed longer than MaxSuppressTime.
+type DampeningConfig struct {
+	Penalty           uint32
+	HalfLife          time.Duration
+	SuppressThreshold uint32
+	ReuseThreshold    uint32
+	MaxSuppressTime   time.Duration
+}
+
+// DefaultDampeningConfig returns commonly used dampening configuration (penalty 1000, half-life 15 minutes, suppress
+// threshold 2000, reuse threshold 750 and max suppress time 60 minutes).
+func DefaultDampeningConfig() DampeningConfig {
+	return DampeningConfig{
+		Penalty:           1000,
+		HalfLife:          15 * time.Minute,
+		SuppressThreshold: 2000,
+		ReuseThreshold:    750,
+		MaxSuppressTime:   60 * time.Minute,
+	}
+}
+
+// Validate checks that dampening configuration is usable, i.e. that all its values are positive, reuse threshold
+// is below suppress threshold and that the maximal penalty (see MaxPenalty()) exceeds suppress threshold.
+func (c DampeningConfig) Validate() error {
+	switch {
+	case c.Penalty == 0 || c.HalfLife <= 0 || c.ReuseThreshold == 0 || c.MaxSuppressTime <= 0:
+		return fmt.Errorf("Invalid dampening configuration %+v: penalty, half-life, reuse threshold and max suppress time must be positive", c)
+	case c.SuppressThreshold <= c.ReuseThreshold:
+		return fmt.Errorf("Invalid dampening configuration %+v: suppress threshold must be above reuse threshold", c)
+	case c.MaxPenalty() <= float64(c.SuppressThreshold):
+		return fmt.Errorf("Invalid dampening configuration %+v: prefix can't be suppressed with given max suppress time", c)
+	}
+	return nil
+}
+
+// Decay returns <penalty> decayed after <elapsed> time.
+func (c DampeningConfig) Decay(penalty float64, elapsed time.Duration) float64 {
+	return penalty * math.Exp2(-elapsed.Seconds()/c.HalfLife.Seconds())
+}
+
+// MaxPenalty returns the highest penalty that prefix can have, i.e. penalty that decays to reuse threshold in max suppress time.
+func (c DampeningConfig) MaxPenalty() float64 {
+	return float64(c.ReuseThreshold) * math.Exp2(c.MaxSuppressTime.Seconds()/c.HalfLife.Seconds())
+}
+
+// ReuseDelay returns time after which <penalty> decays below reuse threshold (0 if it is already below).
+func (c DampeningConfig) ReuseDelay(penalty float64) time.Duration {
+	if penalty <= float64(c.ReuseThreshold) {
+		return 0
+	}
+	return time.Duration(math.Log2(penalty/float64(c.ReuseThreshold)) * float64(c.HalfLife))
+}
+
+// SuppressedPrefix is prefix whose route events are suppressed by route flap dampening. Prefix is identified by its
+// route family, route distinguisher (L3VPN routes only) and prefix. Penalty is its current penalty. ReuseAt is time
+// when the prefix is expected to be reused (if it doesn't flap again).
+type SuppressedPrefix struct {
+	Family             RouteFamily
+	RouteDistinguisher string
+	Prefix             string
+	Penalty            uint32
+	SuppressedSince    time.Time
+	ReuseAt            time.Time
+}
+
+// DampeningReader provides information about route flap dampening of route events sent to watchers.
+type DampeningReader interface {
+	// SuppressedPrefixes returns all prefixes whose route events are currently suppressed (empty if dampening is disabled).
+	SuppressedPrefixes() []SuppressedPrefix
+}
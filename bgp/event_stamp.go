@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventStamp identifies position of event in the stream of events sent to one watcher, so that watchers that forward
+// events elsewhere (i.e. to message queue or database) can tell whether they missed anything.
+// Sequence is increased by one for each event sent to the watcher (the first event after registration has sequence 1).
+// Gap in sequence numbers means that events were lost (i.e. dropped due to full queue, see OverflowDropOldest)
+// and watcher should re-request snapshot (see SnapshotRequester). Events merged together (see OverflowCoalesce
+// and WithBatching()) don't cause gaps. Epoch identifies session of the plugin, it changes when plugin is restarted
+// and when watchers are resynchronized (see ResyncStart), later sessions have greater epochs. Timestamp is the time
+// when the event was emitted by plugin.
+type EventStamp struct {
+	Sequence  uint64
+	Epoch     uint64
+	Timestamp time.Time
+}
+
+// Follows returns true if event stamped by <stamp> directly follows event stamped by <previous> in the stream of events
+// sent to one watcher, i.e. if no event was lost between them.
+func (stamp EventStamp) Follows(previous EventStamp) bool {
+	return stamp.Sequence == previous.Sequence+1
+}
+
+// SnapshotRequester allows watchers to re-request full snapshot, i.e. after they detected gap in sequence numbers
+// of received events (see EventStamp).
+type SnapshotRequester interface {
+	// RequestSnapshot sends all currently known routes to registered <watcher> enclosed in ResyncStart and ResyncEnd
+	// markers (as for resynchronization after re-establishment of lost BGP session). Routes held by watcher that were
+	// not resent before ResyncEnd are no longer reachable. It fails with UnknownWatcherError if there is no such watcher.
+	RequestSnapshot(watcher string) error
+}
+
+// UnknownWatcherError is returned by operations with watcher that is not registered.
+type UnknownWatcherError struct {
+	Watcher string
+}
+
+// Error returns description of UnknownWatcherError.
+func (err *UnknownWatcherError) Error() string {
+	return fmt.Sprintf("Watcher %s is not registered", err.Watcher)
+}
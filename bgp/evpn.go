@@ -0,0 +1,129 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// EVPNRouteType is type of BGP EVPN route (RFC 7432, section 7 and RFC 9136).
+type EVPNRouteType uint8
+
+const (
+	// EVPNMacIPAdvertisement is MAC/IP advertisement route (route type 2). It advertises MAC address (and optionally
+	// IP address) reachable behind VTEP.
+	EVPNMacIPAdvertisement EVPNRouteType = 2
+	// EVPNInclusiveMulticast is inclusive multicast Ethernet tag route (route type 3). It advertises VTEP that wants
+	// to receive broadcast, unknown unicast and multicast traffic of VNI.
+	EVPNInclusiveMulticast EVPNRouteType = 3
+	// EVPNIPPrefix is IP prefix route (route type 5). It advertises IP prefix reachable behind VTEP.
+	EVPNIPPrefix EVPNRouteType = 5
+)
+
+// String returns human readable name of EVPN route type.
+func (t EVPNRouteType) String() string {
+	switch t {
+	case EVPNMacIPAdvertisement:
+		return "mac-ip-advertisement"
+	case EVPNInclusiveMulticast:
+		return "inclusive-multicast"
+	case EVPNIPPrefix:
+		return "ip-prefix"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// EthernetSegmentID is 10-octet Ethernet segment identifier (ESI) of multihomed site (RFC 7432, section 5).
+// Zero ESI means single-homed site.
+type EthernetSegmentID [10]byte
+
+// IsZero returns true for ESI of single-homed site.
+func (esi EthernetSegmentID) IsZero() bool {
+	return esi == EthernetSegmentID{}
+}
+
+// String returns ESI as colon separated hexadecimal octets (i.e. "00:11:22:33:44:55:66:77:88:99").
+func (esi EthernetSegmentID) String() string {
+	octets := make([]string, len(esi))
+	for i, octet := range esi {
+		octets[i] = fmt.Sprintf("%02x", octet)
+	}
+	return strings.Join(octets, ":")
+}
+
+// EVPNRoute is BGP EVPN route used for VXLAN overlays (RFC 8365). Which fields are filled depends on route Type.
+// MAC/IP advertisement routes carry MAC, IP (if advertised), VNI (layer 2 VNI), L3VNI (if advertised for symmetric IRB)
+// and ESI. Inclusive multicast routes carry IP (originating router's IP address) and VNI (from PMSI tunnel attribute).
+// IP prefix routes carry Prefix, GatewayIP (if advertised), VNI (layer 3 VNI) and ESI.
+// VTEP is the tunnel endpoint of the route, i.e. next hop of the route (or tunnel identifier of ingress replication
+// PMSI tunnel for inclusive multicast routes). RouterMAC is MAC address from router's MAC extended community (nil if
+// the community is missing).
+type EVPNRoute struct {
+	Type               EVPNRouteType
+	RouteDistinguisher string
+	ESI                EthernetSegmentID
+	EthernetTag        uint32
+	MAC                net.HardwareAddr
+	IP                 net.IP
+	Prefix             string
+	GatewayIP          net.IP
+	VNI                uint32
+	L3VNI              uint32
+	RouterMAC          net.HardwareAddr
+	VTEP               net.IP
+	RouteTargets       []string
+	AsPath             AsPath
+	Attributes         PathAttributes
+}
+
+// EVPNEvent represents one change of EVPN route. Type of event and meaning of Route and PreviousRoute are the same
+// as for RouteEvent (route is identified by its NLRI, i.e. by route type, route distinguisher, Ethernet tag and MAC/IP
+// or prefix). Stamp identifies position of the event in the stream of events sent to watcher (see EventStamp).
+type EVPNEvent struct {
+	Type          RouteEventType
+	Route         *EVPNRoute
+	PreviousRoute *EVPNRoute
+	Stamp         EventStamp
+}
+
+// MergeEVPNEvents merges two consecutive events of the same EVPN route the same way as MergeRouteEvents merges events
+// of IP-based routes. Nil is returned if the events cancel each other.
+func MergeEVPNEvents(older, newer *EVPNEvent) *EVPNEvent {
+	if older.Route == nil || newer.Route == nil {
+		return newer
+	}
+	if older.Type == RouteWithdrawn && newer.Type == RouteWithdrawn {
+		return older
+	}
+	merged, cancel := mergeEventTypes(older.Type, newer.Type)
+	if cancel {
+		return nil
+	}
+	return &EVPNEvent{Type: merged, Route: newer.Route, PreviousRoute: older.PreviousRoute}
+}
+
+// EVPNWatcher provides the ability to have external clients(watchers) that are notified about changes of BGP EVPN routes
+// (i.e. overlay controller that programs VXLAN tunnels).
+type EVPNWatcher interface {
+	//WatchEVPNRoutes register watcher to notifications for any change of EVPN routes (route types 2, 3 and 5).
+	//Watcher have to identify himself by name(<watcher> param) and provide <callback> that receives the changes.
+	//WatchEVPNRoutes returns <bgp.WatchRegistration> as way how to end the registration in the future.
+	//Registration semantics are the same as for Watcher.WatchIPRouteEvents (names of EVPN watchers are independent
+	//of names of other watchers). Only WithRIBSnapshot() and WithQueue() options apply to EVPN watchers.
+	WatchEVPNRoutes(watcher string, callback func(*EVPNEvent), opts ...WatchOption) (WatchRegistration, error)
+}
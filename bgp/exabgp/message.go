@@ -0,0 +1,273 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exabgp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/ligato/bgp-agent/bgp"
+	"net"
+	"strconv"
+	"time"
+)
+
+// message is one message of ExaBGP JSON API encoder (ExaBGP 4.x) sent to API process. Only the parts used by this plugin
+// are decoded, other parts of the message are ignored.
+type message struct {
+	Exabgp   string    `json:"exabgp"`
+	Time     float64   `json:"time"`
+	Type     string    `json:"type"`
+	Neighbor *neighbor `json:"neighbor"`
+}
+
+// neighbor is part of ExaBGP message that identifies neighbor the message is about and carries its state ("state"
+// messages) or received BGP message ("update" messages with UPDATE or End-of-RIB marker).
+type neighbor struct {
+	Address struct {
+		Local string `json:"local"`
+		Peer  string `json:"peer"`
+	} `json:"address"`
+	Asn struct {
+		Local uint32 `json:"local"`
+		Peer  uint32 `json:"peer"`
+	} `json:"asn"`
+	Direction string `json:"direction"`
+	State     string `json:"state"`
+	Message   *struct {
+		Update *update   `json:"update"`
+		Eor    *endOfRIB `json:"eor"`
+	} `json:"message"`
+}
+
+// endOfRIB is End-of-RIB marker (RFC 4724) of route family given by AFI and SAFI names (i.e. "ipv4" and "unicast").
+type endOfRIB struct {
+	Afi  string `json:"afi"`
+	Safi string `json:"safi"`
+}
+
+// update is parsed UPDATE message. Announced NLRIs are grouped by route family (i.e. "ipv4 unicast") and next hop,
+// withdrawn NLRIs by route family.
+type update struct {
+	Attribute attributes                   `json:"attribute"`
+	Announce  map[string]map[string][]nlri `json:"announce"`
+	Withdraw  map[string][]nlri            `json:"withdraw"`
+}
+
+// nlri is one announced or withdrawn prefix. PathInformation is ADD-PATH path identifier (RFC 7911) in dotted notation
+// (i.e. "0.0.0.1"), it is empty if ADD-PATH is not used.
+type nlri struct {
+	Prefix          string `json:"nlri"`
+	PathInformation string `json:"path-information"`
+}
+
+// attributes are path attributes of announced NLRIs. AS_PATH is list of ASes where nested list is AS_SET, confederation
+// segments of AS_PATH are listed separately in the same way.
+type attributes struct {
+	Origin            string            `json:"origin"`
+	AsPath            []json.RawMessage `json:"as-path"`
+	ConfederationPath []json.RawMessage `json:"confederation-path"`
+	Med               *uint32           `json:"med"`
+	LocalPref         *uint32           `json:"local-preference"`
+	AtomicAggregate   bool              `json:"atomic-aggregate"`
+	Community         [][2]uint16       `json:"community"`
+	LargeCommunity    [][3]uint32       `json:"large-community"`
+	ExtendedCommunity []struct {
+		Value uint64 `json:"value"`
+	} `json:"extended-community"`
+	OriginatorID string   `json:"originator-id"`
+	ClusterList  []string `json:"cluster-list"`
+}
+
+// Types of ExaBGP messages handled by plugin.
+const (
+	typeUpdate = "update"
+	typeState  = "state"
+)
+
+// directionReceive is direction of messages received from neighbor (ExaBGP can pass also messages sent to neighbor).
+const directionReceive = "receive"
+
+// parseMessage decodes one line of ExaBGP JSON API output.
+func parseMessage(line []byte) (*message, error) {
+	msg := &message{}
+	if err := json.Unmarshal(line, msg); err != nil {
+		return nil, fmt.Errorf("Can't parse ExaBGP message: %v", err)
+	}
+	if msg.Exabgp == "" {
+		return nil, fmt.Errorf("Invalid ExaBGP message without version (is ExaBGP process configured with 'encoder json'?)")
+	}
+	return msg, nil
+}
+
+// timestamp returns time when ExaBGP emitted the message.
+func (msg *message) timestamp() time.Time {
+	seconds := int64(msg.Time)
+	return time.Unix(seconds, int64((msg.Time-float64(seconds))*float64(time.Second)))
+}
+
+// toRouteFamily translates ExaBGP name of address family (i.e. "ipv4 unicast") into bgp.RouteFamily. Ok is false for
+// route families that are not supported by plugin.
+func toRouteFamily(family string) (routeFamily bgp.RouteFamily, ok bool) {
+	switch family {
+	case "ipv4 unicast":
+		return bgp.IPv4Unicast, true
+	case "ipv6 unicast":
+		return bgp.IPv6Unicast, true
+	default:
+		return 0, false
+	}
+}
+
+// toSessionState translates ExaBGP neighbor state into bgp.SessionState. ExaBGP reports only TCP connection ("connected"),
+// established session ("up") and session loss ("down").
+func toSessionState(state string) (sessionState bgp.SessionState, ok bool) {
+	switch state {
+	case "connected":
+		return bgp.SessionOpenSent, true
+	case "up":
+		return bgp.SessionEstablished, true
+	case "down":
+		return bgp.SessionIdle, true
+	default:
+		return bgp.SessionIdle, false
+	}
+}
+
+// toRoute translates announced <announced> NLRI of <family> with next hop <nexthop> received from <peer> into
+// bgp.ReachableIPRoute.
+func (attrs *attributes) toRoute(family bgp.RouteFamily, nexthop string, announced nlri, peer net.IP) (*bgp.ReachableIPRoute, error) {
+	route, err := toWithdrawnRoute(family, announced, peer)
+	if err != nil {
+		return nil, err
+	}
+	if route.Nexthop = net.ParseIP(nexthop); route.Nexthop == nil {
+		return nil, fmt.Errorf("Invalid next hop %q of prefix %s", nexthop, announced.Prefix)
+	}
+	if route.AsPath, err = attrs.toAsPath(); err != nil {
+		return nil, err
+	}
+	route.As = route.AsPath.OriginAs()
+	if route.Attributes, err = attrs.toPathAttributes(); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// toWithdrawnRoute translates <withdrawn> NLRI of <family> received from <peer> into bgp.ReachableIPRoute that identifies
+// the withdrawn route.
+func toWithdrawnRoute(family bgp.RouteFamily, withdrawn nlri, peer net.IP) (*bgp.ReachableIPRoute, error) {
+	_, prefix, err := net.ParseCIDR(withdrawn.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid prefix %q: %v", withdrawn.Prefix, err)
+	}
+	pathID, err := toPathID(withdrawn.PathInformation)
+	if err != nil {
+		return nil, err
+	}
+	return &bgp.ReachableIPRoute{Family: family, Prefix: prefix.String(), PathID: pathID, SourcePeer: peer}, nil
+}
+
+// toPathID translates ExaBGP path information (dotted or decimal notation) into path identifier.
+func toPathID(pathInformation string) (uint32, error) {
+	if pathInformation == "" {
+		return 0, nil
+	}
+	if ip := net.ParseIP(pathInformation).To4(); ip != nil {
+		return binary.BigEndian.Uint32(ip), nil
+	}
+	pathID, err := strconv.ParseUint(pathInformation, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid path information %q", pathInformation)
+	}
+	return uint32(pathID), nil
+}
+
+// toAsPath translates AS_PATH attribute. Confederation segments precede other segments (they are added by ASes
+// of local confederation, see RFC 5065), so that the path is the same as if the AS_PATH was translated by goBGP plugin.
+func (attrs *attributes) toAsPath() (bgp.AsPath, error) {
+	asPath, err := toAsPathSegments(attrs.ConfederationPath, bgp.AsConfedSequence, bgp.AsConfedSet)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := toAsPathSegments(attrs.AsPath, bgp.AsSequence, bgp.AsSet)
+	if err != nil {
+		return nil, err
+	}
+	return append(asPath, segments...), nil
+}
+
+// toAsPathSegments translates ExaBGP list of AS path <elements>. Consecutive ASes form segment of <sequence> type
+// and nested list of ASes is segment of <set> type.
+func toAsPathSegments(elements []json.RawMessage, sequence, set bgp.AsPathSegmentType) (bgp.AsPath, error) {
+	var segments bgp.AsPath
+	for _, element := range elements {
+		var as uint32
+		if err := json.Unmarshal(element, &as); err == nil {
+			if last := len(segments) - 1; last >= 0 && segments[last].Type == sequence {
+				segments[last].ASes = append(segments[last].ASes, as)
+			} else {
+				segments = append(segments, bgp.AsPathSegment{Type: sequence, ASes: []uint32{as}})
+			}
+			continue
+		}
+		var asSet []uint32
+		if err := json.Unmarshal(element, &asSet); err != nil {
+			return nil, fmt.Errorf("Invalid AS path element %s", element)
+		}
+		segments = append(segments, bgp.AsPathSegment{Type: set, ASes: asSet})
+	}
+	return segments, nil
+}
+
+// toPathAttributes translates path attributes other than AS_PATH and next hop.
+func (attrs *attributes) toPathAttributes() (bgp.PathAttributes, error) {
+	pathAttrs := bgp.PathAttributes{Med: attrs.Med, LocalPref: attrs.LocalPref, AtomicAggregate: attrs.AtomicAggregate}
+	switch attrs.Origin {
+	case "", "igp":
+		pathAttrs.Origin = bgp.OriginIGP
+	case "egp":
+		pathAttrs.Origin = bgp.OriginEGP
+	case "incomplete":
+		pathAttrs.Origin = bgp.OriginIncomplete
+	default:
+		return pathAttrs, fmt.Errorf("Invalid origin %q", attrs.Origin)
+	}
+	for _, community := range attrs.Community {
+		pathAttrs.Communities = append(pathAttrs.Communities, bgp.NewCommunity(community[0], community[1]))
+	}
+	for _, community := range attrs.LargeCommunity {
+		pathAttrs.LargeCommunities = append(pathAttrs.LargeCommunities,
+			bgp.LargeCommunity{GlobalAdmin: community[0], LocalData1: community[1], LocalData2: community[2]})
+	}
+	for _, community := range attrs.ExtendedCommunity {
+		var extended bgp.ExtendedCommunity
+		binary.BigEndian.PutUint64(extended[:], community.Value)
+		pathAttrs.ExtendedCommunities = append(pathAttrs.ExtendedCommunities, extended)
+	}
+	if attrs.OriginatorID != "" {
+		if pathAttrs.OriginatorID = net.ParseIP(attrs.OriginatorID); pathAttrs.OriginatorID == nil {
+			return pathAttrs, fmt.Errorf("Invalid originator ID %q", attrs.OriginatorID)
+		}
+	}
+	for _, clusterID := range attrs.ClusterList {
+		id := net.ParseIP(clusterID)
+		if id == nil {
+			return pathAttrs, fmt.Errorf("Invalid cluster ID %q", clusterID)
+		}
+		pathAttrs.ClusterList = append(pathAttrs.ClusterList, id)
+	}
+	return pathAttrs, nil
+}
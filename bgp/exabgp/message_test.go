@@ -0,0 +1,137 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exabgp
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/ligato/bgp-agent/bgp"
+	. "github.com/onsi/gomega"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// fixtureMessages returns all ExaBGP messages recorded in fixture file <name> (one message per line).
+func fixtureMessages(name string) []string {
+	file, err := os.Open("testdata/" + name)
+	Expect(err).To(BeNil())
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	Expect(scanner.Err()).To(BeNil())
+	return lines
+}
+
+// TestUpdateTranslation tests translation of announced NLRIs and path attributes of recorded UPDATE message into
+// bgp.ReachableIPRoute.
+func TestUpdateTranslation(x *testing.T) {
+	RegisterTestingT(x)
+	msg, err := parseMessage([]byte(fixtureMessages("session.json")[3]))
+	Expect(err).To(BeNil())
+	Expect(msg.Type).To(Equal(typeUpdate))
+	Expect(msg.timestamp()).To(Equal(time.Unix(1561720002, 0)))
+	update := msg.Neighbor.Message.Update
+	peer := net.ParseIP(msg.Neighbor.Address.Peer)
+
+	route, err := update.Attribute.toRoute(bgp.IPv4Unicast, "192.0.2.2", update.Announce["ipv4 unicast"]["192.0.2.2"][0], peer)
+	Expect(err).To(BeNil())
+	Expect(route.Family).To(Equal(bgp.IPv4Unicast))
+	Expect(route.Prefix).To(Equal("10.1.0.0/16"))
+	Expect(route.Nexthop.Equal(net.ParseIP("192.0.2.2"))).To(BeTrue())
+	Expect(route.SourcePeer.Equal(peer)).To(BeTrue())
+	Expect(route.AsPath).To(Equal(bgp.AsPath{
+		{Type: bgp.AsSequence, ASes: []uint32{65001, 65010}},
+		{Type: bgp.AsSet, ASes: []uint32{65020, 65021}},
+	}))
+	Expect(route.As).To(Equal(route.AsPath.OriginAs()))
+	Expect(route.Attributes.Origin).To(Equal(bgp.OriginIGP))
+	Expect(*route.Attributes.Med).To(BeEquivalentTo(10))
+	Expect(*route.Attributes.LocalPref).To(BeEquivalentTo(100))
+	Expect(route.Attributes.Communities).To(Equal([]bgp.Community{bgp.NewCommunity(65001, 100)}))
+	Expect(route.Attributes.LargeCommunities).To(Equal([]bgp.LargeCommunity{{GlobalAdmin: 65001, LocalData1: 1, LocalData2: 2}}))
+	Expect(route.Attributes.ExtendedCommunities).To(Equal([]bgp.ExtendedCommunity{{0x00, 0x02, 0xfd, 0xe8, 0, 0, 0, 100}}))
+
+	route, err = update.Attribute.toRoute(bgp.IPv6Unicast, "2001:db8::2", update.Announce["ipv6 unicast"]["2001:db8::2"][0], peer)
+	Expect(err).To(BeNil())
+	Expect(route.Prefix).To(Equal("2001:db8:1::/48"))
+	Expect(route.Nexthop.Equal(net.ParseIP("2001:db8::2"))).To(BeTrue())
+}
+
+// TestConfederationPath tests that confederation segments are merged into AS path in front of other segments.
+func TestConfederationPath(x *testing.T) {
+	RegisterTestingT(x)
+	attrs := &attributes{}
+	Expect(json.Unmarshal([]byte(`{"as-path": [65001, [65020, 65021]], "confederation-path": [64512, 64513, [64514, 64515]]}`), attrs)).To(BeNil())
+	asPath, err := attrs.toAsPath()
+	Expect(err).To(BeNil())
+	Expect(asPath).To(Equal(bgp.AsPath{
+		{Type: bgp.AsConfedSequence, ASes: []uint32{64512, 64513}},
+		{Type: bgp.AsConfedSet, ASes: []uint32{64514, 64515}},
+		{Type: bgp.AsSequence, ASes: []uint32{65001}},
+		{Type: bgp.AsSet, ASes: []uint32{65020, 65021}},
+	}))
+	Expect(asPath.NeighborAs()).To(BeEquivalentTo(65001))
+
+	attrs = &attributes{}
+	Expect(json.Unmarshal([]byte(`{"as-path": [65001], "confederation-path": ["x"]}`), attrs)).To(BeNil())
+	_, err = attrs.toAsPath()
+	Expect(err).NotTo(BeNil())
+}
+
+// TestEndOfRIB tests that End-of-RIB marker of recorded session is decoded.
+func TestEndOfRIB(x *testing.T) {
+	RegisterTestingT(x)
+	msg, err := parseMessage([]byte(fixtureMessages("session.json")[4]))
+	Expect(err).To(BeNil())
+	Expect(msg.Type).To(Equal(typeUpdate))
+	Expect(msg.Neighbor.Message.Update).To(BeNil())
+	Expect(msg.Neighbor.Message.Eor).To(Equal(&endOfRIB{Afi: "ipv4", Safi: "unicast"}))
+}
+
+// TestPathInformation tests translation of ADD-PATH path identifiers.
+func TestPathInformation(x *testing.T) {
+	RegisterTestingT(x)
+	msg, err := parseMessage([]byte(fixtureMessages("addpath.json")[1]))
+	Expect(err).To(BeNil())
+	paths := msg.Neighbor.Message.Update.Announce["ipv4 unicast"]["192.0.2.5"]
+	Expect(paths).To(HaveLen(2))
+	for i, path := range paths {
+		route, err := toWithdrawnRoute(bgp.IPv4Unicast, path, nil)
+		Expect(err).To(BeNil())
+		Expect(route.PathID).To(BeEquivalentTo(i + 1))
+	}
+	pathID, err := toPathID("7")
+	Expect(err).To(BeNil())
+	Expect(pathID).To(BeEquivalentTo(7))
+	_, err = toPathID("x")
+	Expect(err).NotTo(BeNil())
+}
+
+// TestMalformedMessage tests that lines that are not messages of ExaBGP JSON API encoder are rejected.
+func TestMalformedMessage(x *testing.T) {
+	RegisterTestingT(x)
+	lines := fixtureMessages("addpath.json")
+	_, err := parseMessage([]byte(lines[2]))
+	Expect(err).NotTo(BeNil())
+	_, err = parseMessage([]byte(lines[3]))
+	Expect(err).NotTo(BeNil())
+	_, err = parseMessage([]byte(`{"type": "update"}`))
+	Expect(err).NotTo(BeNil())
+}
@@ -0,0 +1,392 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exabgp contains Ligato ExaBGP Plugin implementation
+package exabgp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/ligato/bgp-agent/bgp"
+	"github.com/ligato/cn-infra/flavors/local"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Plugin is ExaBGP Ligato BGP Plugin implementation. Plugin runs as API process of ExaBGP (or reads output of such process
+// from named pipe), parses messages of ExaBGP JSON API encoder and exposes learned routes and state of sessions with
+// neighbors to watchers that can register to this plugin. ExaBGP doesn't select best paths, so every path received
+// from every neighbor is exposed as separate route (see bgp.ReachableIPRoute.SourcePeer and PathID).
+type Plugin struct {
+	Deps
+	input              io.Reader
+	closer             io.Closer                                   // closes input, so that blocked reading returns (nil if input can't be closed)
+	routes             map[string]map[string]*bgp.ReachableIPRoute // last known routes by neighbor address and route key (see routeKey())
+	peers              map[string]*peer                            // last known state of neighbors by neighbor address
+	routeWatchers      map[string]*routeWatcher
+	peerStateWatchers  map[string]*peerStateWatcher
+	mu                 sync.Mutex // guards routes, peers and watchers so that RIB snapshots are consistent with sent events
+	lastRegistrationID uint64     // ID of the last watcher registration (guarded by mu)
+	epoch              uint64     // session epoch of plugin (see bgp.EventStamp)
+	closing            chan struct{}
+	readWG             sync.WaitGroup // wait group that allows to wait until reading of input is ended
+}
+
+// Deps combines all needed dependencies for Plugin struct. These dependencies should be injected into Plugin by using constructor's Deps parameter.
+type Deps struct {
+	local.PluginInfraDeps           // inject
+	Input                 io.Reader // optional inject (if not injected, ExaBGP messages are read from Config.Pipe or standard input), closed by Close() if it is io.Closer
+	Config                *Config   // optional inject (external config file has higher priority)
+}
+
+// Config is configuration of ExaBGP plugin.
+type Config struct {
+	// Pipe is path of named pipe that ExaBGP API process writes ExaBGP messages to. Messages are read from standard input
+	// if it is empty (plugin is then started directly as ExaBGP API process).
+	Pipe string `json:"pipe"`
+}
+
+// peer is last known state of neighbor of ExaBGP.
+type peer struct {
+	address net.IP
+	as      uint32
+	state   bgp.SessionState
+}
+
+// New creates an ExaBGP Ligato BGP Plugin implementation. Needed <dependencies> are injected into plugin implementation.
+func New(dependencies Deps) *Plugin {
+	return &Plugin{
+		Deps:              dependencies,
+		routes:            map[string]map[string]*bgp.ReachableIPRoute{},
+		peers:             map[string]*peer{},
+		routeWatchers:     map[string]*routeWatcher{},
+		peerStateWatchers: map[string]*peerStateWatcher{},
+		epoch:             uint64(time.Now().UnixNano()), // epochs of later plugin sessions are greater
+		closing:           make(chan struct{}),
+	}
+}
+
+// Init opens the source of ExaBGP messages. Injected Input has the highest priority, then the named pipe from configuration
+// and standard input is used if neither of them is given. Init fails if the named pipe can't be opened.
+func (plugin *Plugin) Init() error {
+	plugin.Log.Debug("Init ExaBGP plugin")
+	plugin.applyExternalConfig()
+	switch {
+	case plugin.Input != nil:
+		plugin.input = plugin.Input
+		plugin.closer, _ = plugin.Input.(io.Closer)
+	case plugin.Config != nil && plugin.Config.Pipe != "":
+		// pipe is opened also for writing, so that it doesn't reach end of file when ExaBGP (its only writer) restarts
+		pipe, err := os.OpenFile(plugin.Config.Pipe, os.O_RDWR, 0)
+		if err != nil {
+			return fmt.Errorf("Can't open ExaBGP pipe %s: %v", plugin.Config.Pipe, err)
+		}
+		plugin.closer = pipe
+		plugin.input = pipe
+	default:
+		stdin := pollableStdin()
+		plugin.closer = stdin
+		plugin.input = stdin
+	}
+	return nil
+}
+
+// pollableStdin returns standard input whose blocked reading returns when it is closed. Standard input is switched
+// to non-blocking mode, so that it is read by netpoller of Go runtime instead of blocking system call (that wouldn't
+// be interrupted by close). Standard input (os.Stdin) is returned if its mode can't be changed.
+func pollableStdin() *os.File {
+	if err := syscall.SetNonblock(syscall.Stdin, true); err != nil {
+		return os.Stdin
+	}
+	return os.NewFile(uintptr(syscall.Stdin), "/dev/stdin")
+}
+
+// applyExternalConfig tries to find and load plugin configuration from external .yaml file. External configuration has
+// higher priority than injected configuration. If external configuration is not found or can't be loaded,
+// plugin.Config is not changed.
+func (plugin *Plugin) applyExternalConfig() {
+	var externalCfg Config
+	found, err := plugin.PluginConfig.GetValue(&externalCfg) // It tries to lookup `PluginName + "-config"` in go run command flags.
+	if err != nil {
+		plugin.Log.Debug("External ExaBGP plugin configuration could not load or other problem happened", err)
+		return
+	}
+	if !found {
+		plugin.Log.Debug("External ExaBGP plugin configuration was not found")
+		return
+	}
+	plugin.Config = &externalCfg
+}
+
+// AfterInit starts dedicated goroutine that reads ExaBGP messages and forwards learned routes and session state changes
+// to registered watchers. Watchers registered in Init() of other plugins therefore don't miss any information.
+func (plugin *Plugin) AfterInit() error {
+	plugin.readWG.Add(1)
+	go plugin.readMessages(plugin.input)
+	return nil
+}
+
+// Close stops reading of ExaBGP messages and ends all watcher registrations. Input of messages (standard input, named
+// pipe or injected Input that is io.Closer) is closed, so that blocked reading returns, and Close waits for the end
+// of reading. Reading of injected Input that isn't io.Closer can't be interrupted, so messages read from it after Close
+// are ignored.
+func (plugin *Plugin) Close() error {
+	plugin.Log.Info("Closing ExaBGP plugin ", plugin.PluginName)
+	close(plugin.closing)
+	plugin.closeWatchers() // before waiting for the end of reading, that can wait for free space in queue of watcher
+	if plugin.closer != nil {
+		err := plugin.closer.Close()
+		plugin.readWG.Wait()
+		if err != nil {
+			return fmt.Errorf("Can't close input of ExaBGP messages: %v", err)
+		}
+	}
+	return nil
+}
+
+// isClosing returns true if plugin was closed.
+func (plugin *Plugin) isClosing() bool {
+	select {
+	case <-plugin.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// readMessages reads newline delimited ExaBGP messages from <input> and processes them until end of <input>. End of input
+// means that ExaBGP exited, so all neighbors are handled as if their sessions were lost.
+func (plugin *Plugin) readMessages(input io.Reader) {
+	defer plugin.readWG.Done()
+	reader := bufio.NewReader(input)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if plugin.isClosing() {
+			return
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			plugin.processLine(line)
+		}
+		if err != nil {
+			if err != io.EOF {
+				plugin.Log.Errorf("Can't read ExaBGP messages: %v", err)
+			}
+			plugin.Log.Info("End of ExaBGP messages, all sessions with neighbors are considered lost")
+			plugin.processInputEnd(time.Now())
+			return
+		}
+	}
+}
+
+// processLine parses one ExaBGP message and processes it. Malformed messages are logged and skipped.
+func (plugin *Plugin) processLine(line []byte) {
+	msg, err := parseMessage(line)
+	if err != nil {
+		plugin.Log.Warnf("Skipping ExaBGP message %s: %v", line, err)
+		return
+	}
+	switch {
+	case msg.Neighbor == nil:
+		plugin.Log.Debugf("Ignoring ExaBGP %s message without neighbor", msg.Type)
+	case msg.Type == typeUpdate:
+		if msg.Neighbor.Direction == directionReceive && msg.Neighbor.Message != nil && msg.Neighbor.Message.Update != nil {
+			plugin.processUpdate(msg.Neighbor)
+		}
+		if msg.Neighbor.Message != nil && msg.Neighbor.Message.Eor != nil {
+			// routes of neighbor are withdrawn with its session, so there is no resynchronization that would wait for it
+			eor := msg.Neighbor.Message.Eor
+			plugin.Log.Debugf("Ignoring End-of-RIB marker of %s %s from %s", eor.Afi, eor.Safi, msg.Neighbor.Address.Peer)
+		}
+	case msg.Type == typeState:
+		plugin.processState(msg.Neighbor, msg.timestamp())
+	default:
+		plugin.Log.Debugf("Ignoring ExaBGP %s message", msg.Type)
+	}
+}
+
+// routeKey returns key that identifies path of route among all paths received from all neighbors.
+func routeKey(route *bgp.ReachableIPRoute) string {
+	return fmt.Sprintf("%v %v %s %d", route.SourcePeer, route.Family, route.Prefix, route.PathID)
+}
+
+// processUpdate translates UPDATE message received from <neighbor> into bgp.RouteEvent(s) and sends them to registered
+// route watchers.
+func (plugin *Plugin) processUpdate(neighbor *neighbor) {
+	peerAddress := net.ParseIP(neighbor.Address.Peer)
+	if peerAddress == nil {
+		plugin.Log.Warnf("Skipping update from neighbor with invalid address %q", neighbor.Address.Peer)
+		return
+	}
+	deliverAll(plugin.updateRoutes(peerAddress, neighbor.Message.Update))
+}
+
+// updateRoutes applies <update> received from neighbor with <peerAddress> to known routes and returns caused route events
+// prepared for delivery to registered route watchers. Withdrawals are processed before announcements (as in UPDATE
+// message). Withdrawal of unknown route is ignored.
+func (plugin *Plugin) updateRoutes(peerAddress net.IP, update *update) []delivery {
+	plugin.mu.Lock()
+	defer plugin.mu.Unlock()
+	routes := plugin.routes[peerAddress.String()]
+	if routes == nil {
+		routes = map[string]*bgp.ReachableIPRoute{}
+		plugin.routes[peerAddress.String()] = routes
+	}
+
+	var events []*bgp.RouteEvent
+	for _, familyName := range sortedKeys(update.Withdraw) {
+		family, ok := toRouteFamily(familyName)
+		if !ok {
+			plugin.Log.Debugf("Ignoring withdrawal of unsupported route family %s", familyName)
+			continue
+		}
+		for _, withdrawn := range update.Withdraw[familyName] {
+			route, err := toWithdrawnRoute(family, withdrawn, peerAddress)
+			if err != nil {
+				plugin.Log.Warnf("Skipping withdrawal from %v: %v", peerAddress, err)
+				continue
+			}
+			key := routeKey(route)
+			previous, known := routes[key]
+			if !known {
+				plugin.Log.Debugf("Ignoring withdrawal of unknown prefix %s", route.Prefix)
+				continue
+			}
+			delete(routes, key)
+			events = append(events, &bgp.RouteEvent{Type: bgp.RouteWithdrawn, Route: route, PreviousRoute: previous})
+		}
+	}
+	for _, familyName := range sortedKeys(update.Announce) {
+		family, ok := toRouteFamily(familyName)
+		if !ok {
+			plugin.Log.Debugf("Ignoring announcement of unsupported route family %s", familyName)
+			continue
+		}
+		byNexthop := update.Announce[familyName]
+		for _, nexthop := range sortedKeys(byNexthop) {
+			for _, announced := range byNexthop[nexthop] {
+				route, err := update.Attribute.toRoute(family, nexthop, announced, peerAddress)
+				if err != nil {
+					plugin.Log.Warnf("Skipping announcement from %v: %v", peerAddress, err)
+					continue
+				}
+				key := routeKey(route)
+				if previous, known := routes[key]; known {
+					events = append(events, &bgp.RouteEvent{Type: bgp.RouteUpdated, Route: route, PreviousRoute: previous})
+				} else {
+					events = append(events, &bgp.RouteEvent{Type: bgp.RouteAdded, Route: route})
+				}
+				routes[key] = route
+			}
+		}
+	}
+	return plugin.routeDeliveries(events)
+}
+
+// processState translates state change of <neighbor> into bgp.PeerStateEvent emitted at <timestamp> and sends it
+// to registered peer state watchers. All routes received from neighbor whose session is not established are withdrawn
+// (ExaBGP doesn't retain routes of lost sessions).
+func (plugin *Plugin) processState(neighbor *neighbor, timestamp time.Time) {
+	state, ok := toSessionState(neighbor.State)
+	if !ok {
+		plugin.Log.Debugf("Ignoring unknown state %q of neighbor %s", neighbor.State, neighbor.Address.Peer)
+		return
+	}
+	peerAddress := net.ParseIP(neighbor.Address.Peer)
+	if peerAddress == nil {
+		plugin.Log.Warnf("Skipping state of neighbor with invalid address %q", neighbor.Address.Peer)
+		return
+	}
+	plugin.mu.Lock()
+	deliveries := plugin.changePeerState(&peer{address: peerAddress, as: neighbor.Asn.Peer, state: state}, timestamp)
+	plugin.mu.Unlock()
+	deliverAll(deliveries)
+}
+
+// processInputEnd changes state of all neighbors whose session is not idle to idle at <timestamp>.
+func (plugin *Plugin) processInputEnd(timestamp time.Time) {
+	var deliveries []delivery
+	plugin.mu.Lock()
+	for _, address := range sortedKeys(plugin.peers) {
+		if known := plugin.peers[address]; known.state != bgp.SessionIdle {
+			changed := &peer{address: known.address, as: known.as, state: bgp.SessionIdle}
+			deliveries = append(deliveries, plugin.changePeerState(changed, timestamp)...)
+		}
+	}
+	plugin.mu.Unlock()
+	deliverAll(deliveries)
+}
+
+// changePeerState remembers new state of neighbor (<changed>) and returns the change prepared for delivery to registered
+// peer state watchers. Routes received from neighbor whose session is not established are withdrawn first. Caller must
+// hold mu.
+func (plugin *Plugin) changePeerState(changed *peer, timestamp time.Time) []delivery {
+	address := changed.address.String()
+	event := &bgp.PeerStateEvent{
+		PeerAddress: changed.address,
+		PeerAs:      changed.as,
+		NewState:    changed.state,
+		AdminState:  bgp.AdminStateUp,
+		Timestamp:   timestamp,
+	}
+	if previous, known := plugin.peers[address]; known {
+		event.OldState = previous.state
+	}
+	plugin.peers[address] = changed
+	var deliveries []delivery
+	if changed.state != bgp.SessionEstablished {
+		deliveries = plugin.withdrawPeerRoutes(address)
+	}
+
+	plugin.Log.Debugf("Sending peer state event for %v (%v -> %v)", address, event.OldState, event.NewState)
+	for _, watcher := range plugin.peerStateWatchers {
+		deliveries = append(deliveries, delivery{watcher: watcher.watcher, events: watcher.prepare(event)})
+	}
+	return deliveries
+}
+
+// withdrawPeerRoutes withdraws all routes received from neighbor with <address> and returns route events of withdrawals
+// prepared for delivery to registered route watchers. Caller must hold mu.
+func (plugin *Plugin) withdrawPeerRoutes(address string) []delivery {
+	routes := plugin.routes[address]
+	if len(routes) == 0 {
+		return nil
+	}
+	plugin.Log.Infof("Withdrawing %d routes received from %s", len(routes), address)
+	events := make([]*bgp.RouteEvent, 0, len(routes))
+	for _, key := range sortedKeys(routes) {
+		previous := routes[key]
+		withdrawn := &bgp.ReachableIPRoute{Family: previous.Family, Prefix: previous.Prefix, PathID: previous.PathID, SourcePeer: previous.SourcePeer}
+		events = append(events, &bgp.RouteEvent{Type: bgp.RouteWithdrawn, Route: withdrawn, PreviousRoute: previous})
+	}
+	delete(plugin.routes, address)
+	return plugin.routeDeliveries(events)
+}
+
+// sortedKeys returns sorted keys of map <m> with string keys, so that maps (i.e. decoded from ExaBGP messages) are processed
+// in deterministic order.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,386 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exabgp
+
+import (
+	"fmt"
+	"github.com/ligato/bgp-agent/bgp"
+	"github.com/ligato/cn-infra/flavors/local"
+	. "github.com/onsi/gomega"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestPlugin creates initialized plugin that reads ExaBGP messages from <input>.
+func newTestPlugin(input io.Reader) *Plugin {
+	flavor := &local.FlavorLocal{}
+	plugin := New(Deps{PluginInfraDeps: *flavor.InfraDeps("TestExaBGP"), Input: input})
+	Expect(plugin.Init()).To(BeNil())
+	return plugin
+}
+
+// fixtureInput returns reader of all ExaBGP messages recorded in fixture file <name>.
+func fixtureInput(name string) io.Reader {
+	return strings.NewReader(strings.Join(fixtureMessages(name), "\n") + "\n")
+}
+
+// receiveRouteEvent waits for route event from <events>.
+func receiveRouteEvent(events chan bgp.RouteEvent) bgp.RouteEvent {
+	var event bgp.RouteEvent
+	Eventually(events, time.Second).Should(Receive(&event))
+	return event
+}
+
+// expectRouteEvent checks type, prefix and next hop of route <event> (next hop of withdrawn route is not checked).
+func expectRouteEvent(event bgp.RouteEvent, eventType bgp.RouteEventType, prefix string, nexthop string) {
+	Expect(event.Type).To(Equal(eventType))
+	Expect(event.Route.Prefix).To(Equal(prefix))
+	if eventType == bgp.RouteWithdrawn {
+		Expect(event.PreviousRoute.Nexthop.Equal(net.ParseIP(nexthop))).To(BeTrue())
+	} else {
+		Expect(event.Route.Nexthop.Equal(net.ParseIP(nexthop))).To(BeTrue())
+	}
+}
+
+// TestRouteEvents tests that recorded ExaBGP session (announcements, update with withdrawal and loss of session) is
+// translated into route events and that ignored messages (keepalive, end-of-RIB) don't cause any event.
+func TestRouteEvents(x *testing.T) {
+	RegisterTestingT(x)
+	plugin := newTestPlugin(fixtureInput("session.json"))
+	events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestEventWatcher", func(event *bgp.RouteEvent) {
+		events <- *event
+	})
+	Expect(err).To(BeNil())
+	routes := make(chan bgp.ReachableIPRoute, 10)
+	_, err = plugin.WatchIPRoutes("TestRouteWatcher", bgp.ToChan(routes, plugin.Log))
+	Expect(err).To(BeNil())
+	Expect(plugin.AfterInit()).To(BeNil())
+	defer plugin.Close()
+
+	expectRouteEvent(receiveRouteEvent(events), bgp.RouteAdded, "10.1.0.0/16", "192.0.2.2")
+	expectRouteEvent(receiveRouteEvent(events), bgp.RouteAdded, "10.2.0.0/16", "192.0.2.2")
+	expectRouteEvent(receiveRouteEvent(events), bgp.RouteAdded, "2001:db8:1::/48", "2001:db8::2")
+	expectRouteEvent(receiveRouteEvent(events), bgp.RouteWithdrawn, "10.2.0.0/16", "192.0.2.2")
+	updated := receiveRouteEvent(events)
+	expectRouteEvent(updated, bgp.RouteUpdated, "10.1.0.0/16", "192.0.2.3")
+	Expect(updated.Route.Attributes.Origin).To(Equal(bgp.OriginIncomplete))
+	Expect(updated.PreviousRoute.Nexthop.Equal(net.ParseIP("192.0.2.2"))).To(BeTrue())
+	// session loss withdraws all remaining routes of the neighbor
+	expectRouteEvent(receiveRouteEvent(events), bgp.RouteWithdrawn, "10.1.0.0/16", "192.0.2.3")
+	expectRouteEvent(receiveRouteEvent(events), bgp.RouteWithdrawn, "2001:db8:1::/48", "2001:db8::2")
+	Consistently(events).ShouldNot(Receive())
+
+	var prefixes []string
+	for i := 0; i < 4; i++ {
+		var route bgp.ReachableIPRoute
+		Eventually(routes, time.Second).Should(Receive(&route))
+		prefixes = append(prefixes, route.Prefix)
+	}
+	Expect(prefixes).To(Equal([]string{"10.1.0.0/16", "10.2.0.0/16", "2001:db8:1::/48", "10.1.0.0/16"}))
+	Consistently(routes).ShouldNot(Receive())
+}
+
+// TestPeerState tests translation of ExaBGP neighbor states into peer state events.
+func TestPeerState(x *testing.T) {
+	RegisterTestingT(x)
+	plugin := newTestPlugin(fixtureInput("session.json"))
+	states := make(chan bgp.PeerStateEvent, 10)
+	_, err := plugin.WatchPeerState("TestPeerStateWatcher", func(event *bgp.PeerStateEvent) {
+		states <- *event
+	})
+	Expect(err).To(BeNil())
+	Expect(plugin.AfterInit()).To(BeNil())
+	defer plugin.Close()
+
+	expected := []struct {
+		old, new  bgp.SessionState
+		timestamp time.Time
+	}{
+		{bgp.SessionIdle, bgp.SessionOpenSent, time.Unix(1561720000, int64(500*time.Millisecond))},
+		{bgp.SessionOpenSent, bgp.SessionEstablished, time.Unix(1561720001, 0)},
+		{bgp.SessionEstablished, bgp.SessionIdle, time.Unix(1561720005, 0)},
+	}
+	for i, transition := range expected {
+		var event bgp.PeerStateEvent
+		Eventually(states, time.Second).Should(Receive(&event))
+		Expect(event.PeerAddress.Equal(net.ParseIP("192.0.2.2"))).To(BeTrue())
+		Expect(event.PeerAs).To(BeEquivalentTo(65001))
+		Expect(event.OldState).To(Equal(transition.old))
+		Expect(event.NewState).To(Equal(transition.new))
+		Expect(event.Timestamp).To(Equal(transition.timestamp))
+		Expect(event.Stamp.Sequence).To(BeEquivalentTo(i + 1))
+	}
+	Consistently(states).ShouldNot(Receive())
+}
+
+// TestEndOfInput tests that paths of the same prefix (ADD-PATH) are passed as separate routes, that malformed messages
+// are skipped and that end of ExaBGP messages is handled as loss of all sessions.
+func TestEndOfInput(x *testing.T) {
+	RegisterTestingT(x)
+	plugin := newTestPlugin(fixtureInput("addpath.json"))
+	events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestEventWatcher", func(event *bgp.RouteEvent) {
+		events <- *event
+	})
+	Expect(err).To(BeNil())
+	states := make(chan bgp.PeerStateEvent, 10)
+	_, err = plugin.WatchPeerState("TestPeerStateWatcher", func(event *bgp.PeerStateEvent) {
+		states <- *event
+	})
+	Expect(err).To(BeNil())
+	Expect(plugin.AfterInit()).To(BeNil())
+	defer plugin.Close()
+
+	for _, expected := range []struct {
+		eventType bgp.RouteEventType
+		pathID    uint32
+	}{{bgp.RouteAdded, 1}, {bgp.RouteAdded, 2}, {bgp.RouteWithdrawn, 1}, {bgp.RouteWithdrawn, 2}} {
+		event := receiveRouteEvent(events)
+		expectRouteEvent(event, expected.eventType, "10.5.0.0/16", "192.0.2.5")
+		Expect(event.Route.PathID).To(Equal(expected.pathID))
+		Expect(event.Route.SourcePeer.Equal(net.ParseIP("192.0.2.5"))).To(BeTrue())
+	}
+	Consistently(events).ShouldNot(Receive())
+
+	var event bgp.PeerStateEvent
+	Eventually(states, time.Second).Should(Receive(&event))
+	Expect(event.NewState).To(Equal(bgp.SessionEstablished))
+	Eventually(states, time.Second).Should(Receive(&event))
+	Expect(event.OldState).To(Equal(bgp.SessionEstablished))
+	Expect(event.NewState).To(Equal(bgp.SessionIdle))
+}
+
+// TestRIBSnapshotAndBatches tests that late-registered watcher receives RIB snapshot before live updates and that
+// route events of one ExaBGP message are passed to batch watcher together.
+func TestRIBSnapshotAndBatches(x *testing.T) {
+	RegisterTestingT(x)
+	input, exabgp := io.Pipe()
+	plugin := newTestPlugin(input)
+	events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestEventWatcher", func(event *bgp.RouteEvent) {
+		events <- *event
+	})
+	Expect(err).To(BeNil())
+	Expect(plugin.AfterInit()).To(BeNil())
+	defer plugin.Close()
+	defer exabgp.Close()
+
+	messages := fixtureMessages("session.json")
+	for _, msg := range messages[:4] {
+		_, err := io.WriteString(exabgp, msg+"\n")
+		Expect(err).To(BeNil())
+	}
+	for i := 0; i < 3; i++ {
+		Expect(receiveRouteEvent(events).Type).To(Equal(bgp.RouteAdded))
+	}
+
+	batches := make(chan []*bgp.RouteEvent, 10)
+	_, err = plugin.WatchIPRouteBatches("TestBatchWatcher", func(batch []*bgp.RouteEvent) {
+		batches <- batch
+	}, bgp.WithRIBSnapshot(), bgp.WithBatching(2, 0))
+	Expect(err).To(BeNil())
+	var batch []*bgp.RouteEvent
+	Eventually(batches, time.Second).Should(Receive(&batch))
+	Expect(batch).To(HaveLen(2))
+	Eventually(batches, time.Second).Should(Receive(&batch))
+	Expect(batch).To(HaveLen(2))
+	Expect(batch[1].Type).To(Equal(bgp.RIBSnapshotEnd))
+	Expect(batch[1].Stamp.Sequence).To(BeEquivalentTo(4))
+
+	_, err = io.WriteString(exabgp, messages[5]+"\n")
+	Expect(err).To(BeNil())
+	Eventually(batches, time.Second).Should(Receive(&batch))
+	Expect(batch).To(HaveLen(2))
+	expectRouteEvent(*batch[0], bgp.RouteWithdrawn, "10.2.0.0/16", "192.0.2.2")
+	expectRouteEvent(*batch[1], bgp.RouteUpdated, "10.1.0.0/16", "192.0.2.3")
+	Expect(batch[1].Stamp.Follows(batch[0].Stamp)).To(BeTrue())
+	Consistently(batches).ShouldNot(Receive())
+}
+
+// TestBatchFlushInterval tests that route events of ExaBGP messages processed within flush interval are passed to batch
+// watcher together and that events of the same route are merged in the batch.
+func TestBatchFlushInterval(x *testing.T) {
+	RegisterTestingT(x)
+	input, exabgp := io.Pipe()
+	plugin := newTestPlugin(input)
+	batches := make(chan []*bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteBatches("TestBatchWatcher", func(batch []*bgp.RouteEvent) {
+		batches <- batch
+	}, bgp.WithBatching(10, 500*time.Millisecond))
+	Expect(err).To(BeNil())
+	Expect(plugin.AfterInit()).To(BeNil())
+	defer plugin.Close()
+	defer exabgp.Close()
+
+	messages := fixtureMessages("session.json")
+	_, err = io.WriteString(exabgp, messages[1]+"\n"+messages[3]+"\n"+messages[5]+"\n")
+	Expect(err).To(BeNil())
+	var batch []*bgp.RouteEvent
+	Eventually(batches, time.Second).Should(Receive(&batch))
+	Expect(batch).To(HaveLen(2)) // announcement and withdrawal of 10.2.0.0/16 cancel each other
+	expectRouteEvent(*batch[0], bgp.RouteAdded, "10.1.0.0/16", "192.0.2.3")
+	expectRouteEvent(*batch[1], bgp.RouteAdded, "2001:db8:1::/48", "2001:db8::2")
+	Expect(batch[1].Stamp.Follows(batch[0].Stamp)).To(BeTrue())
+	Consistently(batches).ShouldNot(Receive())
+}
+
+// TestOverflowPolicies tests that watchers with full queue don't stall processing of ExaBGP messages unless they use
+// bgp.OverflowBlock policy, that bgp.OverflowDropOldest leaves gap in sequence numbers and that bgp.OverflowDisconnect
+// ends the registration.
+func TestOverflowPolicies(x *testing.T) {
+	RegisterTestingT(x)
+	input, exabgp := io.Pipe()
+	plugin := newTestPlugin(input)
+	events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestEventWatcher", func(event *bgp.RouteEvent) {
+		events <- *event
+	})
+	Expect(err).To(BeNil())
+	release := make(chan struct{})
+	dropped := make(chan bgp.RouteEvent, 10)
+	_, err = plugin.WatchIPRouteEvents("TestDropWatcher", func(event *bgp.RouteEvent) {
+		<-release
+		dropped <- *event
+	}, bgp.WithQueue(1, bgp.OverflowDropOldest))
+	Expect(err).To(BeNil())
+	disconnected := make(chan bgp.RouteEvent, 10)
+	_, err = plugin.WatchIPRouteEvents("TestDisconnectWatcher", func(event *bgp.RouteEvent) {
+		<-release
+		disconnected <- *event
+	}, bgp.WithQueue(1, bgp.OverflowDisconnect))
+	Expect(err).To(BeNil())
+	Expect(plugin.AfterInit()).To(BeNil())
+	defer plugin.Close()
+	defer exabgp.Close()
+
+	messages := fixtureMessages("session.json")
+	for _, msg := range messages {
+		_, err := io.WriteString(exabgp, msg+"\n")
+		Expect(err).To(BeNil())
+	}
+	for i := 0; i < 7; i++ {
+		receiveRouteEvent(events)
+	}
+	Eventually(func() error {
+		_, err := plugin.WatchIPRouteEvents("TestDisconnectWatcher", func(*bgp.RouteEvent) {})
+		return err
+	}).Should(BeNil())
+	close(release)
+
+	var received []bgp.RouteEvent
+	var event bgp.RouteEvent
+	for event.Stamp.Sequence < 7 {
+		Eventually(dropped, time.Second).Should(Receive(&event))
+		received = append(received, event)
+	}
+	Expect(len(received)).To(BeNumerically("<", 7))
+	expectRouteEvent(event, bgp.RouteWithdrawn, "2001:db8:1::/48", "2001:db8::2")
+	for event.Type != bgp.WatchDisconnected {
+		Eventually(disconnected, time.Second).Should(Receive(&event))
+	}
+	Consistently(disconnected).ShouldNot(Receive())
+}
+
+// TestCallbackCallsPlugin tests that callback of watcher whose queue is smaller than RIB snapshot can call the plugin
+// (i.e. register another watcher) while the snapshot is delivered.
+func TestCallbackCallsPlugin(x *testing.T) {
+	RegisterTestingT(x)
+	input, exabgp := io.Pipe()
+	plugin := newTestPlugin(input)
+	events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestEventWatcher", func(event *bgp.RouteEvent) {
+		events <- *event
+	})
+	Expect(err).To(BeNil())
+	Expect(plugin.AfterInit()).To(BeNil())
+	defer plugin.Close()
+	defer exabgp.Close()
+
+	messages := fixtureMessages("session.json")
+	_, err = io.WriteString(exabgp, messages[1]+"\n"+messages[3]+"\n")
+	Expect(err).To(BeNil())
+	for i := 0; i < 3; i++ {
+		receiveRouteEvent(events)
+	}
+
+	snapshot := make(chan bgp.RouteEvent, 10)
+	registered := make(chan error, 10)
+	_, err = plugin.WatchIPRouteEvents("TestSnapshotWatcher", func(event *bgp.RouteEvent) {
+		_, err := plugin.WatchPeerState(fmt.Sprintf("TestPeerStateWatcher%d", event.Stamp.Sequence), func(*bgp.PeerStateEvent) {})
+		registered <- err
+		snapshot <- *event
+	}, bgp.WithRIBSnapshot(), bgp.WithQueue(1, bgp.OverflowBlock))
+	Expect(err).To(BeNil())
+	for i := 0; i < 3; i++ {
+		Expect(receiveRouteEvent(snapshot).Type).To(Equal(bgp.RouteAdded))
+		Eventually(registered, time.Second).Should(Receive(BeNil()))
+	}
+	Expect(receiveRouteEvent(snapshot).Type).To(Equal(bgp.RIBSnapshotEnd))
+}
+
+// TestWatcherRegistration tests registration errors and that closed watcher doesn't receive any further events.
+func TestWatcherRegistration(x *testing.T) {
+	RegisterTestingT(x)
+	input, exabgp := io.Pipe()
+	plugin := newTestPlugin(input)
+	Expect(plugin.AfterInit()).To(BeNil())
+	defer plugin.Close()
+	defer exabgp.Close()
+
+	_, err := plugin.WatchIPRouteEvents("TestEventWatcher", nil)
+	Expect(err).To(Equal(bgp.ErrNilCallback))
+	_, err = plugin.WatchIPRouteEvents("TestEventWatcher", func(*bgp.RouteEvent) {}, bgp.WithVrf("blue"))
+	Expect(err).NotTo(BeNil())
+	events := make(chan bgp.RouteEvent, 10)
+	registration, err := plugin.WatchIPRouteEvents("TestEventWatcher", func(event *bgp.RouteEvent) {
+		events <- *event
+	})
+	Expect(err).To(BeNil())
+	_, err = plugin.WatchIPRoutes("TestEventWatcher", func(*bgp.ReachableIPRoute) {})
+	Expect(err).To(Equal(&bgp.DuplicateWatcherError{Watcher: "TestEventWatcher"}))
+
+	messages := fixtureMessages("session.json")
+	_, err = io.WriteString(exabgp, messages[1]+"\n"+messages[3]+"\n")
+	Expect(err).To(BeNil())
+	receiveRouteEvent(events)
+	Expect(registration.Close()).To(BeNil())
+	Expect(registration.Close()).To(BeNil())
+	_, err = io.WriteString(exabgp, messages[5]+"\n")
+	Expect(err).To(BeNil())
+	Consistently(events).ShouldNot(Receive(WithTransform(func(event bgp.RouteEvent) bgp.RouteEventType {
+		return event.Type
+	}, Equal(bgp.RouteUpdated))))
+}
+
+// TestCloseInterruptsReading tests that Close closes injected Input that is io.Closer, so that reading that waits for
+// the next ExaBGP message returns and Close doesn't block.
+func TestCloseInterruptsReading(x *testing.T) {
+	RegisterTestingT(x)
+	input, exabgp := io.Pipe()
+	plugin := newTestPlugin(input)
+	Expect(plugin.AfterInit()).To(BeNil())
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- plugin.Close()
+	}()
+	Eventually(closed, time.Second).Should(Receive(BeNil()))
+	_, err := io.WriteString(exabgp, "{}\n")
+	Expect(err).To(Equal(io.ErrClosedPipe))
+}
@@ -0,0 +1,570 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exabgp
+
+import (
+	"fmt"
+	"github.com/ligato/bgp-agent/bgp"
+	"sync"
+	"time"
+)
+
+// watcher is registered watcher of any kind. Events wait in watcher's queue until its own goroutine passes them
+// to watcher's callback, at most QueueSize events wait for delivery and overflow policy says what happens when
+// the queue is full (see bgp.WithQueue()). Events are pushed to the queue after mu of plugin is released, so that full
+// queue doesn't block registrations and callback can call the plugin. Only RIB snapshot is queued under mu (regardless
+// of the queue size), so that it precedes all live events.
+type watcher struct {
+	sync.Mutex
+	id           uint64
+	registeredAt time.Time
+	epoch        uint64        // session epoch of plugin (see bgp.EventStamp)
+	changed      *sync.Cond    // signals change of queued events or closing of watcher
+	events       []interface{} // queued events (*bgp.RouteEvent or *bgp.PeerStateEvent), stamped except for sequence number
+	size         int
+	policy       bgp.OverflowPolicy
+	closed       bool
+	sequence     uint64 // sequence number of the last delivered (or dropped) event (see bgp.EventStamp)
+	deliver      func(events []interface{})
+	onDisconnect func() // called after disconnection of watcher due to full queue
+
+	batchSize     int           // maximal count of events passed to watcher at once (0 if events are passed one by one)
+	flushInterval time.Duration // maximal time that events of processed ExaBGP messages wait for more events (batches only)
+	sealed        int           // count of queued events (from the oldest) of processed ExaBGP messages (batches only)
+	sealedAt      time.Time     // time when the oldest sealed event was sealed (batches only)
+	flushTimer    *time.Timer   // wakes up goroutine of watcher when sealed events should be flushed (batches only)
+}
+
+// delivery is set of events caused by one ExaBGP message prepared under mu of plugin for one watcher. It is pushed
+// to the watcher's queue after mu is released (see deliverAll()).
+type delivery struct {
+	watcher *watcher
+	events  []interface{}
+}
+
+// newWatcher creates watcher with queue given by <options> that passes events to <deliver> (in batches only
+// if <batched>) and starts its delivery goroutine. Caller must hold mu.
+func (plugin *Plugin) newWatcher(options *bgp.WatchOptions, batched bool, deliver func(events []interface{})) *watcher {
+	plugin.lastRegistrationID++
+	w := &watcher{
+		id:           plugin.lastRegistrationID,
+		registeredAt: time.Now(),
+		epoch:        plugin.epoch,
+		size:         options.QueueSize,
+		policy:       options.OverflowPolicy,
+		deliver:      deliver,
+	}
+	if batched {
+		w.batchSize = options.BatchSize
+		w.flushInterval = options.FlushInterval
+	}
+	w.changed = sync.NewCond(w)
+	go w.run()
+	return w
+}
+
+// newStamp returns stamp of event emitted now (without sequence number that is assigned on delivery).
+func (w *watcher) newStamp() bgp.EventStamp {
+	return bgp.EventStamp{Epoch: w.epoch, Timestamp: time.Now()}
+}
+
+// run passes queued events to watcher's callback until watcher is closed and its queue is empty.
+func (w *watcher) run() {
+	for {
+		w.Lock()
+		for !w.ready() {
+			w.wait()
+		}
+		if len(w.events) == 0 {
+			if w.flushTimer != nil {
+				w.flushTimer.Stop()
+			}
+			w.Unlock()
+			return
+		}
+		events := w.take()
+		w.Unlock()
+
+		if len(events) > 0 {
+			w.deliver(events)
+		}
+	}
+}
+
+// ready returns true if watcher is closed or if events should be passed to watcher, i.e. there is any queued event
+// (watchers that don't receive batches), there are enough events to fill the batch (or the queue) or sealed events waited
+// for flush interval. Caller must hold the watcher lock.
+func (w *watcher) ready() bool {
+	switch {
+	case len(w.events) == 0:
+		return w.closed
+	case w.batchSize == 0 || w.closed || len(w.events) >= w.batchSize || len(w.events) >= w.size:
+		return true
+	case w.sealed == 0:
+		return false
+	default:
+		return !time.Now().Before(w.sealedAt.Add(w.flushInterval))
+	}
+}
+
+// wait waits for change of queued events or (if there are sealed events) for end of their flush interval. Caller must hold
+// the watcher lock.
+func (w *watcher) wait() {
+	if w.sealed > 0 {
+		wait := time.Until(w.sealedAt.Add(w.flushInterval))
+		if w.flushTimer == nil {
+			w.flushTimer = time.AfterFunc(wait, w.wakeUp)
+		} else {
+			w.flushTimer.Reset(wait)
+		}
+	}
+	w.changed.Wait()
+}
+
+// wakeUp wakes up goroutine of watcher waiting for batch.
+func (w *watcher) wakeUp() {
+	w.Lock()
+	defer w.Unlock()
+	w.changed.Broadcast()
+}
+
+// take removes events that should be passed to watcher from the queue and returns them with assigned sequence numbers.
+// Watchers that don't receive batches get the oldest event, batch watchers get batch of sealed events (or the oldest
+// events regardless of their ExaBGP message if the queue is full or closed) whose events of the same route are merged
+// (see mergeRouteEvents()). Caller must hold the watcher lock.
+func (w *watcher) take() []interface{} {
+	count := 1
+	if w.batchSize > 0 {
+		count = w.sealed
+		if w.closed || len(w.events) >= w.batchSize || len(w.events) >= w.size {
+			count = len(w.events)
+		}
+		if count > w.batchSize {
+			count = w.batchSize
+		}
+	}
+	events := make([]interface{}, count)
+	copy(events, w.events)
+	w.remove(count)
+
+	if w.batchSize > 0 {
+		routeEvents := make([]*bgp.RouteEvent, len(events))
+		for i, event := range events {
+			routeEvents[i] = event.(*bgp.RouteEvent)
+		}
+		events = events[:0]
+		for _, event := range mergeRouteEvents(routeEvents) {
+			events = append(events, event)
+		}
+	}
+	for _, event := range events {
+		w.sequence++
+		switch event := event.(type) {
+		case *bgp.RouteEvent:
+			event.Stamp.Sequence = w.sequence
+		case *bgp.PeerStateEvent:
+			event.Stamp.Sequence = w.sequence
+		}
+	}
+	return events
+}
+
+// remove removes <count> oldest events from the queue. Caller must hold the watcher lock.
+func (w *watcher) remove(count int) {
+	for i := 0; i < count; i++ {
+		w.events[i] = nil // the oldest events are removed by reslicing, so that large snapshots are not copied
+	}
+	w.events = w.events[count:]
+	w.sealed -= count
+	if w.sealed < 0 {
+		w.sealed = 0
+	}
+	w.changed.Broadcast()
+}
+
+// push adds <events> caused by one ExaBGP message to the queue applying overflow policy when the queue is full. Events
+// pushed to closed watcher are dropped. Caller must not hold mu of plugin, pushing waits while the queue is full
+// (bgp.OverflowBlock and bgp.OverflowCoalesce without event to merge with).
+func (w *watcher) push(events []interface{}) {
+	w.Lock()
+	disconnected := false
+	for _, event := range events {
+		coalesced := false
+		for !w.closed && len(w.events) >= w.size {
+			if w.policy == bgp.OverflowCoalesce && w.coalesce(event) {
+				coalesced = true
+				break
+			}
+			if w.policy == bgp.OverflowDropOldest {
+				w.remove(1)
+				w.sequence++ // dropped event leaves gap in sequence numbers
+			} else if w.policy == bgp.OverflowDisconnect {
+				w.sequence += uint64(len(w.events)) + 1
+				w.disconnect()
+				disconnected = true
+			} else {
+				w.changed.Wait()
+			}
+		}
+		if !coalesced && !w.closed {
+			w.events = append(w.events, event)
+			w.changed.Broadcast()
+		}
+	}
+	w.seal()
+	w.Unlock()
+
+	if disconnected && w.onDisconnect != nil {
+		w.onDisconnect()
+	}
+}
+
+// pushAll adds all <events> to the queue regardless of its size (used for RIB snapshots, that must not be blocked
+// by watcher).
+func (w *watcher) pushAll(events []interface{}) {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return
+	}
+	w.events = append(w.events, events...)
+	w.seal()
+	w.changed.Broadcast()
+}
+
+// seal completes group of all currently queued events (events of processed ExaBGP messages), so that they can be passed
+// to batch watcher. It does nothing for watchers that don't receive batches. Caller must hold the watcher lock.
+func (w *watcher) seal() {
+	if w.batchSize == 0 || w.sealed == len(w.events) {
+		return
+	}
+	if w.sealed == 0 {
+		w.sealedAt = time.Now()
+	}
+	w.sealed = len(w.events)
+	w.changed.Broadcast()
+}
+
+// coalesce merges route <event> into the newest queued event of the same route (see bgp.MergeRouteEvents()) unless they
+// are separated by marker event. It returns false if there is no such event. Caller must hold the watcher lock.
+func (w *watcher) coalesce(event interface{}) bool {
+	newer, ok := event.(*bgp.RouteEvent)
+	if !ok || newer.Route == nil {
+		return false
+	}
+	key := routeKey(newer.Route)
+	for i := len(w.events) - 1; i >= 0; i-- {
+		older := w.events[i].(*bgp.RouteEvent)
+		if older.Route == nil {
+			return false
+		}
+		if routeKey(older.Route) != key {
+			continue
+		}
+		if merged := bgp.MergeRouteEvents(older, newer); merged != nil {
+			merged.Stamp = newer.Stamp
+			w.events[i] = merged
+		} else {
+			w.events = append(w.events[:i], w.events[i+1:]...)
+			if i < w.sealed {
+				w.sealed--
+			}
+			w.changed.Broadcast()
+		}
+		return true
+	}
+	return false
+}
+
+// disconnect closes watcher due to overflow. All queued events are dropped and only bgp.WatchDisconnected event is left
+// to be delivered to route watcher. Caller must hold the watcher lock.
+func (w *watcher) disconnect() {
+	w.events = []interface{}{&bgp.RouteEvent{Type: bgp.WatchDisconnected, Stamp: w.newStamp()}}
+	w.sealed = len(w.events)
+	w.closed = true
+	w.changed.Broadcast()
+}
+
+// close ends delivery of notifications to watcher, events waiting in queue are dropped. Event that is currently being
+// delivered is not waited for, so close can be called also from watcher's callback.
+func (w *watcher) close() {
+	w.Lock()
+	defer w.Unlock()
+	w.events = nil
+	w.sealed = 0
+	w.closed = true
+	w.changed.Broadcast()
+}
+
+// routeWatcher is registered route event watcher. Route events passing its filter are passed to its callback one by one
+// or in batches (batch watchers).
+type routeWatcher struct {
+	*watcher
+	filter *bgp.RouteFilter
+}
+
+// peerStateWatcher is registered peer state watcher.
+type peerStateWatcher struct {
+	*watcher
+}
+
+// prepare returns route <events> caused by one ExaBGP message that pass watcher's filter, stamped for delivery to watcher.
+// Caller must hold mu of plugin.
+func (rw *routeWatcher) prepare(events []*bgp.RouteEvent) []interface{} {
+	prepared := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		if passed := rw.filter.FilterEvent(event); passed != nil {
+			copied := *passed // events are shared by all watchers
+			copied.Stamp = rw.newStamp()
+			prepared = append(prepared, &copied)
+		}
+	}
+	return prepared
+}
+
+// mergeRouteEvents merges <events> of the same route into one event (see bgp.MergeRouteEvents()) that keeps stamp
+// of the newest of them. Events are not merged across events without route (markers).
+func mergeRouteEvents(events []*bgp.RouteEvent) []*bgp.RouteEvent {
+	merged := make([]*bgp.RouteEvent, 0, len(events))
+	positions := map[string]int{}
+	for _, event := range events {
+		if event.Route == nil {
+			positions = map[string]int{}
+			merged = append(merged, event)
+			continue
+		}
+		key := routeKey(event.Route)
+		if i, found := positions[key]; found {
+			if merged[i] == nil {
+				merged[i] = event
+			} else if merged[i] = bgp.MergeRouteEvents(merged[i], event); merged[i] != nil {
+				merged[i].Stamp = event.Stamp
+			}
+			continue
+		}
+		positions[key] = len(merged)
+		merged = append(merged, event)
+	}
+
+	result := merged[:0]
+	for _, event := range merged {
+		if event != nil {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+// prepare returns peer state <event> stamped for delivery to watcher. Caller must hold mu of plugin.
+func (pw *peerStateWatcher) prepare(event *bgp.PeerStateEvent) []interface{} {
+	copied := *event // events are shared by all watchers
+	copied.Stamp = pw.newStamp()
+	return []interface{}{&copied}
+}
+
+// routeDeliveries returns route <events> caused by one ExaBGP message prepared for delivery to all registered route
+// watchers. Caller must hold mu.
+func (plugin *Plugin) routeDeliveries(events []*bgp.RouteEvent) []delivery {
+	if len(events) == 0 {
+		return nil
+	}
+	deliveries := make([]delivery, 0, len(plugin.routeWatchers))
+	for _, watcher := range plugin.routeWatchers {
+		if prepared := watcher.prepare(events); len(prepared) > 0 {
+			deliveries = append(deliveries, delivery{watcher: watcher.watcher, events: prepared})
+		}
+	}
+	return deliveries
+}
+
+// deliverAll pushes prepared <deliveries> to queues of their watchers. Caller must not hold mu.
+func deliverAll(deliveries []delivery) {
+	for _, delivery := range deliveries {
+		delivery.watcher.push(delivery.events)
+	}
+}
+
+// WatchIPRoutes register watcher to notifications for any new learned IP-based routes (see bgp.Watcher).
+// Each path received from each neighbor of ExaBGP is passed as separate route. Only announcements are passed to
+// <callback>, withdrawals (including withdrawals of routes of neighbors whose session was lost) are not.
+func (plugin *Plugin) WatchIPRoutes(watcher string, callback func(*bgp.ReachableIPRoute), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	if callback == nil {
+		return nil, bgp.ErrNilCallback
+	}
+	return plugin.registerRouteWatcher(watcher, bgp.NewWatchOptions(opts...), false, func(events []interface{}) {
+		for _, event := range events {
+			if event := event.(*bgp.RouteEvent); event.Type == bgp.RouteAdded || event.Type == bgp.RouteUpdated {
+				callback(event.Route)
+			}
+		}
+	})
+}
+
+// WatchIPRouteEvents register watcher to notifications for any change of IP-based routes (see bgp.Watcher).
+// Registration semantics are the same as for WatchIPRoutes.
+func (plugin *Plugin) WatchIPRouteEvents(watcher string, callback func(*bgp.RouteEvent), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	if callback == nil {
+		return nil, bgp.ErrNilCallback
+	}
+	return plugin.registerRouteWatcher(watcher, bgp.NewWatchOptions(opts...), false, func(events []interface{}) {
+		for _, event := range events {
+			callback(event.(*bgp.RouteEvent))
+		}
+	})
+}
+
+// WatchIPRouteBatches register watcher to notifications for any change of IP-based routes in batches (see bgp.Watcher).
+// Route events caused by one ExaBGP message (i.e. one UPDATE message or loss of session with neighbor) are passed
+// in the same batch unless the batch is full, batch size and flush interval can be set by bgp.WithBatching() option.
+// Registration semantics are the same as for WatchIPRoutes.
+func (plugin *Plugin) WatchIPRouteBatches(watcher string, callback func([]*bgp.RouteEvent), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	if callback == nil {
+		return nil, bgp.ErrNilCallback
+	}
+	return plugin.registerRouteWatcher(watcher, bgp.NewWatchOptions(opts...), true, func(events []interface{}) {
+		batch := make([]*bgp.RouteEvent, len(events))
+		for i, event := range events {
+			batch[i] = event.(*bgp.RouteEvent)
+		}
+		callback(batch)
+	})
+}
+
+// registerRouteWatcher registers route watcher with name <watcher> and <options> whose events are passed to <deliver>
+// one by one or in batches (<batched>). RIB snapshot (if requested) is queued for the watcher before any live event.
+// L3VPN routes are not supported by ExaBGP plugin, so watching of VRF fails.
+func (plugin *Plugin) registerRouteWatcher(watcher string, options *bgp.WatchOptions, batched bool, deliver func([]interface{})) (bgp.WatchRegistration, error) {
+	if options.Vrf != "" {
+		return nil, fmt.Errorf("Can't register watcher %s of VRF %s, ExaBGP plugin doesn't support L3VPN routes", watcher, options.Vrf)
+	}
+	plugin.Log.Infof("Watcher %s registering for watching of routes in %s.", watcher, plugin.PluginName)
+	plugin.mu.Lock()
+	defer plugin.mu.Unlock()
+	if _, found := plugin.routeWatchers[watcher]; found {
+		return nil, &bgp.DuplicateWatcherError{Watcher: watcher}
+	}
+	registered := &routeWatcher{watcher: plugin.newWatcher(options, batched, deliver), filter: options.Filter}
+	registered.onDisconnect = func() {
+		plugin.Log.Warnf("Watcher %s was disconnected from %s, its queue is full", watcher, plugin.PluginName)
+		plugin.mu.Lock()
+		defer plugin.mu.Unlock()
+		if plugin.routeWatchers[watcher] == registered {
+			delete(plugin.routeWatchers, watcher)
+		}
+	}
+	if options.RIBSnapshot {
+		registered.pushAll(registered.prepare(plugin.ribSnapshot()))
+	}
+	plugin.routeWatchers[watcher] = registered
+	return &routeRegistration{name: watcher, plugin: plugin, registered: registered}, nil
+}
+
+// ribSnapshot returns all currently known routes as bgp.RouteAdded events followed by bgp.RIBSnapshotEnd event. Caller
+// must hold mu.
+func (plugin *Plugin) ribSnapshot() []*bgp.RouteEvent {
+	var events []*bgp.RouteEvent
+	for _, address := range sortedKeys(plugin.routes) {
+		routes := plugin.routes[address]
+		for _, key := range sortedKeys(routes) {
+			events = append(events, &bgp.RouteEvent{Type: bgp.RouteAdded, Route: routes[key]})
+		}
+	}
+	return append(events, &bgp.RouteEvent{Type: bgp.RIBSnapshotEnd})
+}
+
+// WatchPeerState register watcher to notifications about changes of BGP session state with neighbors of ExaBGP
+// (see bgp.PeerStateWatcher). ExaBGP reports only connection to neighbor (bgp.SessionOpenSent), established session
+// and loss of session (bgp.SessionIdle). RouterID and LastNotification of events are not filled.
+func (plugin *Plugin) WatchPeerState(watcher string, callback func(*bgp.PeerStateEvent)) (bgp.WatchRegistration, error) {
+	if callback == nil {
+		return nil, bgp.ErrNilCallback
+	}
+	plugin.Log.Infof("Watcher %s registering for watching of peer state in %s.", watcher, plugin.PluginName)
+	plugin.mu.Lock()
+	defer plugin.mu.Unlock()
+	if _, found := plugin.peerStateWatchers[watcher]; found {
+		return nil, &bgp.DuplicateWatcherError{Watcher: watcher}
+	}
+	registered := &peerStateWatcher{watcher: plugin.newWatcher(bgp.NewWatchOptions(), false, func(events []interface{}) {
+		for _, event := range events {
+			callback(event.(*bgp.PeerStateEvent))
+		}
+	})}
+	plugin.peerStateWatchers[watcher] = registered
+	return &peerStateRegistration{name: watcher, plugin: plugin, registered: registered}, nil
+}
+
+// closeWatchers ends registrations of all watchers.
+func (plugin *Plugin) closeWatchers() {
+	plugin.mu.Lock()
+	defer plugin.mu.Unlock()
+	for name, watcher := range plugin.routeWatchers {
+		watcher.close()
+		delete(plugin.routeWatchers, name)
+	}
+	for name, watcher := range plugin.peerStateWatchers {
+		watcher.close()
+		delete(plugin.peerStateWatchers, name)
+	}
+}
+
+// routeRegistration is registration of route watcher.
+type routeRegistration struct {
+	name       string
+	plugin     *Plugin
+	registered *routeWatcher
+}
+
+// ID returns unique identification of the registration.
+func (rr *routeRegistration) ID() uint64 {
+	return rr.registered.id
+}
+
+// Close ends the agreement between Plugin and route watcher. Plugin stops sending watcher any further notifications
+// (events waiting in watcher's queue are dropped). Repeated Close does nothing and Close never unregisters newer
+// registration of watcher with the same name.
+func (rr *routeRegistration) Close() error {
+	rr.registered.close()
+	rr.plugin.mu.Lock()
+	defer rr.plugin.mu.Unlock()
+	if rr.plugin.routeWatchers[rr.name] == rr.registered {
+		delete(rr.plugin.routeWatchers, rr.name)
+	}
+	return nil
+}
+
+// peerStateRegistration is registration of peer state watcher.
+type peerStateRegistration struct {
+	name       string
+	plugin     *Plugin
+	registered *peerStateWatcher
+}
+
+// ID returns unique identification of the registration.
+func (pr *peerStateRegistration) ID() uint64 {
+	return pr.registered.id
+}
+
+// Close ends the agreement between Plugin and peer state watcher. Plugin stops sending watcher any further notifications.
+// Repeated Close does nothing and Close never unregisters newer registration of watcher with the same name.
+func (pr *peerStateRegistration) Close() error {
+	pr.registered.close()
+	pr.plugin.mu.Lock()
+	defer pr.plugin.mu.Unlock()
+	if pr.plugin.peerStateWatchers[pr.name] == pr.registered {
+		delete(pr.plugin.peerStateWatchers, pr.name)
+	}
+	return nil
+}
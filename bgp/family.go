@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import "fmt"
+
+// RouteFamily identifies address family of route by AFI (Address Family Identifier) and SAFI (Subsequent Address
+// Family Identifier) as defined in RFC 4760. Value is encoded as AFI<<16 | SAFI.
+type RouteFamily uint32
+
+// Address family identifiers (AFI) used by supported route families
+const (
+	AfiIP  uint16 = 1
+	AfiIP6 uint16 = 2
+)
+
+// Subsequent address family identifiers (SAFI) used by supported route families
+const (
+	SafiUnicast   uint8 = 1
+	SafiMplsLabel uint8 = 4
+	SafiMplsVpn   uint8 = 128
+	SafiFlowSpec  uint8 = 133
+)
+
+// Route families supported by BGP-Agent plugins
+const (
+	// IPv4Unicast is route family of IPv4 unicast routes
+	IPv4Unicast = RouteFamily(uint32(AfiIP)<<16 | uint32(SafiUnicast))
+	// IPv6Unicast is route family of IPv6 unicast routes
+	IPv6Unicast = RouteFamily(uint32(AfiIP6)<<16 | uint32(SafiUnicast))
+	// IPv4LabeledUnicast is route family of IPv4 labeled unicast (BGP-LU) routes (RFC 8277)
+	IPv4LabeledUnicast = RouteFamily(uint32(AfiIP)<<16 | uint32(SafiMplsLabel))
+	// IPv6LabeledUnicast is route family of IPv6 labeled unicast (BGP-LU) routes (RFC 8277)
+	IPv6LabeledUnicast = RouteFamily(uint32(AfiIP6)<<16 | uint32(SafiMplsLabel))
+	// IPv4VPN is route family of VPNv4 (L3VPN) routes (RFC 4364)
+	IPv4VPN = RouteFamily(uint32(AfiIP)<<16 | uint32(SafiMplsVpn))
+	// IPv6VPN is route family of VPNv6 (L3VPN) routes (RFC 4659)
+	IPv6VPN = RouteFamily(uint32(AfiIP6)<<16 | uint32(SafiMplsVpn))
+	// IPv4FlowSpec is route family of IPv4 FlowSpec rules (RFC 8955)
+	IPv4FlowSpec = RouteFamily(uint32(AfiIP)<<16 | uint32(SafiFlowSpec))
+	// IPv6FlowSpec is route family of IPv6 FlowSpec rules (RFC 8956)
+	IPv6FlowSpec = RouteFamily(uint32(AfiIP6)<<16 | uint32(SafiFlowSpec))
+)
+
+// NewRouteFamily creates route family from its <afi> and <safi>.
+func NewRouteFamily(afi uint16, safi uint8) RouteFamily {
+	return RouteFamily(uint32(afi)<<16 | uint32(safi))
+}
+
+// Afi returns address family identifier of route family.
+func (f RouteFamily) Afi() uint16 {
+	return uint16(f >> 16)
+}
+
+// Safi returns subsequent address family identifier of route family.
+func (f RouteFamily) Safi() uint8 {
+	return uint8(f)
+}
+
+// IsVPN returns true for route families of L3VPN routes (IPv4VPN and IPv6VPN).
+func (f RouteFamily) IsVPN() bool {
+	return f.Safi() == SafiMplsVpn
+}
+
+// IsLabeledUnicast returns true for route families of labeled unicast routes (IPv4LabeledUnicast and IPv6LabeledUnicast).
+func (f RouteFamily) IsLabeledUnicast() bool {
+	return f.Safi() == SafiMplsLabel
+}
+
+// String returns name of route family in the same notation as it is used in afi-safi configuration of GoBGP
+// (i.e. "ipv4-unicast"). Unknown route families are printed by their AFI and SAFI.
+func (f RouteFamily) String() string {
+	switch f {
+	case IPv4Unicast:
+		return "ipv4-unicast"
+	case IPv6Unicast:
+		return "ipv6-unicast"
+	case IPv4LabeledUnicast:
+		return "ipv4-labelled-unicast"
+	case IPv6LabeledUnicast:
+		return "ipv6-labelled-unicast"
+	case IPv4VPN:
+		return "l3vpn-ipv4-unicast"
+	case IPv6VPN:
+		return "l3vpn-ipv6-unicast"
+	case IPv4FlowSpec:
+		return "ipv4-flowspec"
+	case IPv6FlowSpec:
+		return "ipv6-flowspec"
+	default:
+		return fmt.Sprintf("afi-safi(%d,%d)", f.Afi(), f.Safi())
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"net"
+	"regexp"
+)
+
+// RouteFilter is subscription filter of watch registration (see WithFilter()). Route passes the filter if it matches
+// all criteria that are set (nil or empty criteria are ignored). Criterion with multiple values is matched if any
+// of its values matches.
+type RouteFilter struct {
+	// Prefixes is prefix list that route prefix must match
+	Prefixes []PrefixMatch
+	// Families are route families of routes passing the filter
+	Families []RouteFamily
+	// OriginAs are ASes that can originate routes passing the filter (see AsPath.OriginAs())
+	OriginAs []uint32
+	// AnyAs are ASes of which at least one must be present anywhere in AS path of route
+	AnyAs []uint32
+	// AsPathRegex is regular expression that must match string representation of AS path of route (see AsPath.String())
+	AsPathRegex *regexp.Regexp
+	// Communities are standard communities of which at least one must be attached to route
+	Communities []Community
+	// LargeCommunities are large communities of which at least one must be attached to route
+	LargeCommunities []LargeCommunity
+	// NexthopSubnets are subnets of which at least one must contain next hop of route
+	NexthopSubnets []*net.IPNet
+	// RouteTargets are route targets (i.e. "65000:100") of which at least one must be attached to route
+	RouteTargets []string
+}
+
+// PrefixMatch is one entry of prefix list. Route prefix matches the entry if it is covered by Prefix and its length is
+// in range from Ge to Le (both inclusive). Zero Ge means the length of Prefix. Zero Le means exact length of Prefix
+// if Ge is also zero, otherwise it means maximal length of address (32 for IPv4, 128 for IPv6).
+type PrefixMatch struct {
+	Prefix *net.IPNet
+	Ge     uint8
+	Le     uint8
+}
+
+// Matches returns true if <prefix> matches prefix list entry.
+func (m PrefixMatch) Matches(prefix *net.IPNet) bool {
+	if m.Prefix == nil || prefix == nil {
+		return false
+	}
+	entryLen, bits := m.Prefix.Mask.Size()
+	prefixLen, prefixBits := prefix.Mask.Size()
+	if bits != prefixBits || prefixLen < entryLen || !m.Prefix.Contains(prefix.IP) {
+		return false
+	}
+	ge, le := int(m.Ge), int(m.Le)
+	if ge == 0 {
+		ge = entryLen
+	}
+	if le == 0 {
+		if m.Ge == 0 {
+			le = entryLen
+		} else {
+			le = bits
+		}
+	}
+	return prefixLen >= ge && prefixLen <= le
+}
+
+// Match returns true if <route> passes the filter. Nil filter is passed by any route.
+func (f *RouteFilter) Match(route *ReachableIPRoute) bool {
+	if f == nil {
+		return true
+	}
+	if route == nil {
+		return false
+	}
+	if len(f.Prefixes) > 0 && !f.matchPrefix(route) {
+		return false
+	}
+	if len(f.Families) > 0 && !containsFamily(f.Families, route.Family) {
+		return false
+	}
+	if len(f.OriginAs) > 0 && !containsAs(f.OriginAs, route.AsPath.OriginAs()) {
+		return false
+	}
+	if len(f.AnyAs) > 0 && !f.matchAnyAs(route.AsPath) {
+		return false
+	}
+	if f.AsPathRegex != nil && !f.AsPathRegex.MatchString(route.AsPath.String()) {
+		return false
+	}
+	if len(f.Communities) > 0 && !f.matchCommunity(route.Attributes.Communities) {
+		return false
+	}
+	if len(f.LargeCommunities) > 0 && !f.matchLargeCommunity(route.Attributes.LargeCommunities) {
+		return false
+	}
+	if len(f.NexthopSubnets) > 0 && !f.matchNexthop(route.Nexthop) {
+		return false
+	}
+	if len(f.RouteTargets) > 0 && !f.matchRouteTarget(route.RouteTargets) {
+		return false
+	}
+	return true
+}
+
+// FilterEvent applies filter on route <event> in a way that keeps state of watcher consistent. Update of route that
+// starts to pass the filter is turned into RouteAdded event and update of route that stops to pass the filter is turned
+// into RouteWithdrawn event (the same applies to RouteStale events). Withdrawals are matched using the withdrawn (previous) route. Events without route
+// (i.e. RIBSnapshotEnd) always pass. Nil is returned if event doesn't pass the filter.
+func (f *RouteFilter) FilterEvent(event *RouteEvent) *RouteEvent {
+	if f == nil || event.Route == nil {
+		return event
+	}
+	switch event.Type {
+	case RouteAdded:
+		if f.Match(event.Route) {
+			return event
+		}
+	case RouteUpdated, RouteStale:
+		matchesNew, matchesPrevious := f.Match(event.Route), f.Match(event.PreviousRoute)
+		switch {
+		case matchesNew && matchesPrevious:
+			return event
+		case matchesNew:
+			return &RouteEvent{Type: RouteAdded, Route: event.Route}
+		case matchesPrevious:
+			return &RouteEvent{Type: RouteWithdrawn, Route: event.Route, PreviousRoute: event.PreviousRoute}
+		}
+	case RouteWithdrawn:
+		if f.Match(event.PreviousRoute) {
+			return event
+		}
+	default:
+		return event
+	}
+	return nil
+}
+
+// matchPrefix returns true if prefix of <route> matches any entry of prefix list.
+func (f *RouteFilter) matchPrefix(route *ReachableIPRoute) bool {
+	prefix, err := route.IPNet()
+	if err != nil {
+		return false
+	}
+	for _, entry := range f.Prefixes {
+		if entry.Matches(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnyAs returns true if any of filtered ASes is present anywhere in <asPath>.
+func (f *RouteFilter) matchAnyAs(asPath AsPath) bool {
+	for _, segment := range asPath {
+		for _, as := range segment.ASes {
+			if containsAs(f.AnyAs, as) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchCommunity returns true if any of filtered communities is present in <communities>.
+func (f *RouteFilter) matchCommunity(communities []Community) bool {
+	for _, community := range communities {
+		for _, wanted := range f.Communities {
+			if community == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchLargeCommunity returns true if any of filtered large communities is present in <communities>.
+func (f *RouteFilter) matchLargeCommunity(communities []LargeCommunity) bool {
+	for _, community := range communities {
+		for _, wanted := range f.LargeCommunities {
+			if community == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchNexthop returns true if any of filtered subnets contains <nexthop>.
+func (f *RouteFilter) matchNexthop(nexthop net.IP) bool {
+	for _, subnet := range f.NexthopSubnets {
+		if subnet.Contains(nexthop) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRouteTarget returns true if any of filtered route targets is present in <routeTargets>.
+func (f *RouteFilter) matchRouteTarget(routeTargets []string) bool {
+	for _, routeTarget := range routeTargets {
+		for _, wanted := range f.RouteTargets {
+			if routeTarget == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsFamily returns true if <families> contains <family>.
+func containsFamily(families []RouteFamily, family RouteFamily) bool {
+	for _, f := range families {
+		if f == family {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAs returns true if <ases> contains <as>.
+func containsAs(ases []uint32, as uint32) bool {
+	for _, a := range ases {
+		if a == as {
+			return true
+		}
+	}
+	return false
+}
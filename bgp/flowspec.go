@@ -0,0 +1,247 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"fmt"
+)
+
+// NumericOp is comparison operator of FlowSpec numeric match (RFC 8955, section 4.2.1.1). Operators can be combined
+// (i.e. NumericGreater|NumericEqual means "greater or equal").
+type NumericOp uint8
+
+const (
+	// NumericEqual matches values equal to match value
+	NumericEqual NumericOp = 0x01
+	// NumericGreater matches values greater than match value
+	NumericGreater NumericOp = 0x02
+	// NumericLess matches values less than match value
+	NumericLess NumericOp = 0x04
+)
+
+// Compare returns true if <value> is in relation given by operator with <matchValue>.
+func (op NumericOp) Compare(value, matchValue uint64) bool {
+	return (op&NumericLess != 0 && value < matchValue) ||
+		(op&NumericGreater != 0 && value > matchValue) ||
+		(op&NumericEqual != 0 && value == matchValue)
+}
+
+// String returns operator in its usual notation (i.e. ">=").
+func (op NumericOp) String() string {
+	switch op & (NumericLess | NumericGreater | NumericEqual) {
+	case NumericEqual:
+		return "=="
+	case NumericGreater:
+		return ">"
+	case NumericGreater | NumericEqual:
+		return ">="
+	case NumericLess:
+		return "<"
+	case NumericLess | NumericEqual:
+		return "<="
+	case NumericLess | NumericGreater:
+		return "!="
+	case NumericLess | NumericGreater | NumericEqual:
+		return "true"
+	default:
+		return "false"
+	}
+}
+
+// NumericMatch is one term of FlowSpec numeric match component (i.e. of ports or packet length). Term with And set is
+// ANDed with the previous term, otherwise it is ORed with the previous terms (see MatchNumeric()).
+type NumericMatch struct {
+	And   bool
+	Op    NumericOp
+	Value uint64
+}
+
+// String returns term in "[&]operator value" notation (i.e. "&<=1024").
+func (m NumericMatch) String() string {
+	if m.And {
+		return fmt.Sprintf("&%s%d", m.Op, m.Value)
+	}
+	return fmt.Sprintf("%s%d", m.Op, m.Value)
+}
+
+// MatchNumeric evaluates FlowSpec numeric match <terms> on <value>. Terms are evaluated from left to right, term with And
+// set is ANDed with the previous term and term without it starts new alternative (RFC 8955, section 4.2.1.1).
+// Empty terms match any value.
+func MatchNumeric(terms []NumericMatch, value uint64) bool {
+	if len(terms) == 0 {
+		return true
+	}
+	result := false
+	for i, term := range terms {
+		if i == 0 || !term.And {
+			if result {
+				return true
+			}
+			result = term.Op.Compare(value, term.Value)
+		} else {
+			result = result && term.Op.Compare(value, term.Value)
+		}
+	}
+	return result
+}
+
+// BitmaskMatch is one term of FlowSpec bitmask match component (i.e. of TCP flags or fragment). Term with Match set
+// matches if all bits of Value are set, otherwise it matches if any bit of Value is set. Not negates the result.
+// Term with And set is ANDed with the previous term, otherwise it is ORed with the previous terms (see MatchBitmask()).
+type BitmaskMatch struct {
+	And   bool
+	Not   bool
+	Match bool
+	Value uint64
+}
+
+// String returns term in "[&][!][=]value" notation with hexadecimal value (i.e. "&=0x12").
+func (m BitmaskMatch) String() string {
+	prefix := ""
+	if m.And {
+		prefix += "&"
+	}
+	if m.Not {
+		prefix += "!"
+	}
+	if m.Match {
+		prefix += "="
+	}
+	return fmt.Sprintf("%s0x%x", prefix, m.Value)
+}
+
+// matches returns true if bitmask term matches <value>.
+func (m BitmaskMatch) matches(value uint64) bool {
+	var result bool
+	if m.Match {
+		result = value&m.Value == m.Value
+	} else {
+		result = value&m.Value != 0
+	}
+	return result != m.Not
+}
+
+// MatchBitmask evaluates FlowSpec bitmask match <terms> on <value> with the same AND/OR semantics as MatchNumeric
+// (RFC 8955, section 4.2.1.2). Empty terms match any value.
+func MatchBitmask(terms []BitmaskMatch, value uint64) bool {
+	if len(terms) == 0 {
+		return true
+	}
+	result := false
+	for i, term := range terms {
+		if i == 0 || !term.And {
+			if result {
+				return true
+			}
+			result = term.matches(value)
+		} else {
+			result = result && term.matches(value)
+		}
+	}
+	return result
+}
+
+// Bits of FlowSpec fragment match component (RFC 8955, section 4.2.2.12)
+const (
+	// FragmentDontFragment is set for packets with DF bit
+	FragmentDontFragment uint64 = 0x01
+	// FragmentIsFragment is set for fragmented packets
+	FragmentIsFragment uint64 = 0x02
+	// FragmentFirst is set for the first fragment
+	FragmentFirst uint64 = 0x04
+	// FragmentLast is set for the last fragment
+	FragmentLast uint64 = 0x08
+)
+
+// TrafficRate is traffic-rate action of FlowSpec rule (RFC 8955, section 7.3). Rate is in bytes per second, zero rate
+// means that matching traffic is discarded.
+type TrafficRate struct {
+	As   uint16
+	Rate float32
+}
+
+// FlowSpecActions are actions of FlowSpec rule taken from its extended communities (RFC 8955, section 7).
+// Nil TrafficRate and Mark and empty Redirect mean that the action is not present.
+type FlowSpecActions struct {
+	// TrafficRate limits matching traffic
+	TrafficRate *TrafficRate
+	// Redirect is route target of VRF (i.e. "65000:100") where matching traffic is redirected (RFC 7674)
+	Redirect string
+	// Mark is DSCP value that matching traffic is marked with
+	Mark *uint8
+}
+
+// FlowSpecRule is BGP FlowSpec rule (RFC 8955 for IPv4FlowSpec, RFC 8956 for IPv6FlowSpec). Match components that are not
+// present in the rule are empty (they match any packet). Protocols match next header for IPv6 rules.
+// ID is textual form of all match components, it identifies the rule within its route family. Components of the rule that
+// can't be represented by typed fields (i.e. IPv6 prefix offsets or flow label) are kept in textual form in
+// UnknownComponents, such rules match more packets than intended if UnknownComponents are ignored.
+type FlowSpecRule struct {
+	Family            RouteFamily
+	ID                string
+	DestinationPrefix string
+	SourcePrefix      string
+	Protocols         []NumericMatch
+	Ports             []NumericMatch
+	DestinationPorts  []NumericMatch
+	SourcePorts       []NumericMatch
+	ICMPTypes         []NumericMatch
+	ICMPCodes         []NumericMatch
+	TCPFlags          []BitmaskMatch
+	PacketLengths     []NumericMatch
+	DSCP              []NumericMatch
+	Fragments         []BitmaskMatch
+	UnknownComponents []string
+	Actions           FlowSpecActions
+	AsPath            AsPath
+	Attributes        PathAttributes
+}
+
+// FlowSpecEvent represents one change of FlowSpec rule. Type of event and meaning of Rule and PreviousRule are the same
+// as for RouteEvent (rules are identified by their Family and ID). Stamp identifies position of the event in the stream
+// of events sent to watcher (see EventStamp).
+type FlowSpecEvent struct {
+	Type         RouteEventType
+	Rule         *FlowSpecRule
+	PreviousRule *FlowSpecRule
+	Stamp        EventStamp
+}
+
+// MergeFlowSpecEvents merges two consecutive events of the same FlowSpec rule the same way as MergeRouteEvents merges
+// events of IP-based routes. Nil is returned if the events cancel each other.
+func MergeFlowSpecEvents(older, newer *FlowSpecEvent) *FlowSpecEvent {
+	if older.Rule == nil || newer.Rule == nil {
+		return newer
+	}
+	if older.Type == RouteWithdrawn && newer.Type == RouteWithdrawn {
+		return older
+	}
+	merged, cancel := mergeEventTypes(older.Type, newer.Type)
+	if cancel {
+		return nil
+	}
+	return &FlowSpecEvent{Type: merged, Rule: newer.Rule, PreviousRule: older.PreviousRule}
+}
+
+// FlowSpecWatcher provides the ability to have external clients(watchers) that are notified about changes of BGP FlowSpec
+// rules (i.e. DDoS mitigation that turns the rules into local ACLs).
+type FlowSpecWatcher interface {
+	//WatchFlowSpec register watcher to notifications for any change of IPv4 and IPv6 FlowSpec rules.
+	//Watcher have to identify himself by name(<watcher> param) and provide <callback> that receives the changes.
+	//WatchFlowSpec returns <bgp.WatchRegistration> as way how to end the registration in the future.
+	//Registration semantics are the same as for Watcher.WatchIPRouteEvents (names of FlowSpec watchers are independent
+	//of names of other watchers). Only WithRIBSnapshot() and WithQueue() options apply to FlowSpec watchers.
+	WatchFlowSpec(watcher string, callback func(*FlowSpecEvent), opts ...WatchOption) (WatchRegistration, error)
+}
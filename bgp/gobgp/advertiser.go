@@ -0,0 +1,155 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"fmt"
+	"github.com/ligato/bgp-agent/bgp"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/table"
+	"net"
+	"sync"
+	"time"
+)
+
+// AnnouncementExistsError is returned by Plugin.Announce if the prefix is already announced (with any next hop).
+// goBGP keeps only one locally originated path per prefix, so the new announcement would replace the previous one
+// and the previous handle couldn't withdraw it anymore. Prefix can be announced again after withdrawal of the previous
+// announcement.
+type AnnouncementExistsError struct {
+	Prefix string
+}
+
+// Error returns description of AnnouncementExistsError.
+func (err *AnnouncementExistsError) Error() string {
+	return fmt.Sprintf("Prefix %s is already announced", err.Prefix)
+}
+
+// Announce advertises <announcement> to all BGP neighbors by adding locally originated path to goBGP server.
+// It fails if plugin was not started yet (AfterInit was not called), if announcement is not valid (unparsable prefix or next hop
+// of other address family than prefix) and with AnnouncementExistsError if the prefix is already announced.
+// Announced route is also reported to route watchers as any other best path.
+func (plugin *Plugin) Announce(announcement bgp.Announcement) (bgp.AnnouncementHandle, error) {
+	if err := plugin.checkStarted(); err != nil {
+		return nil, err
+	}
+	path, err := plugin.toPath(&announcement)
+	if err != nil {
+		return nil, err
+	}
+	key := path.GetNlri().String() // canonical prefix (the same prefix can be written differently, i.e. "10.1.0.1/16")
+	plugin.announcementsMu.Lock()
+	defer plugin.announcementsMu.Unlock()
+	if _, found := plugin.announcements[key]; found {
+		return nil, &AnnouncementExistsError{Prefix: announcement.Prefix}
+	}
+	if _, err := plugin.server.AddPath("", []*table.Path{path}); err != nil {
+		return nil, fmt.Errorf("Can't announce %s: %v", announcement.Prefix, err)
+	}
+	plugin.Log.Infof("Announced %s via %v", announcement.Prefix, announcement.Nexthop)
+	handle := &announcementHandle{
+		plugin: plugin,
+		prefix: announcement.Prefix,
+		key:    key,
+		uuid:   path.UUID().Bytes(), // goBGP assigns UUID to the added path, but doesn't return it
+		family: path.GetRouteFamily(),
+	}
+	plugin.announcements[key] = handle
+	return handle, nil
+}
+
+// toPath translates <announcement> to goBGP path.
+func (plugin *Plugin) toPath(announcement *bgp.Announcement) (*table.Path, error) {
+	_, prefix, err := net.ParseCIDR(announcement.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("Can't announce invalid prefix %s: %v", announcement.Prefix, err)
+	}
+	ones, _ := prefix.Mask.Size()
+	isIPv4 := prefix.IP.To4() != nil
+	nexthop := announcement.Nexthop
+	if nexthop != nil && (nexthop.To4() != nil) != isIPv4 {
+		return nil, fmt.Errorf("Can't announce %s via next hop %v of other address family", announcement.Prefix, nexthop)
+	}
+
+	attrs := []bgpPacket.PathAttributeInterface{bgpPacket.NewPathAttributeOrigin(bgpPacket.BGP_ORIGIN_ATTR_TYPE_IGP)}
+	var nlri bgpPacket.AddrPrefixInterface
+	if isIPv4 {
+		if nexthop == nil {
+			nexthop = net.IPv4zero
+		}
+		nlri = bgpPacket.NewIPAddrPrefix(uint8(ones), prefix.IP.String())
+		attrs = append(attrs, bgpPacket.NewPathAttributeNextHop(nexthop.String()))
+	} else {
+		if nexthop == nil {
+			nexthop = net.IPv6zero
+		}
+		nlri = bgpPacket.NewIPv6AddrPrefix(uint8(ones), prefix.IP.String())
+		attrs = append(attrs, bgpPacket.NewPathAttributeMpReachNLRI(nexthop.String(), []bgpPacket.AddrPrefixInterface{nlri}))
+	}
+	if announcement.AsPathPrepend > 0 {
+		ases := make([]uint32, announcement.AsPathPrepend)
+		for i := range ases {
+			ases[i] = plugin.SessionConfig.Global.Config.As
+		}
+		attrs = append(attrs, bgpPacket.NewPathAttributeAsPath([]bgpPacket.AsPathParamInterface{
+			bgpPacket.NewAs4PathParam(bgpPacket.BGP_ASPATH_ATTR_TYPE_SEQ, ases),
+		}))
+	}
+	if announcement.Med != nil {
+		attrs = append(attrs, bgpPacket.NewPathAttributeMultiExitDisc(*announcement.Med))
+	}
+	if announcement.LocalPref != nil {
+		attrs = append(attrs, bgpPacket.NewPathAttributeLocalPref(*announcement.LocalPref))
+	}
+	if len(announcement.Communities) > 0 {
+		communities := make([]uint32, len(announcement.Communities))
+		for i, community := range announcement.Communities {
+			communities[i] = uint32(community)
+		}
+		attrs = append(attrs, bgpPacket.NewPathAttributeCommunities(communities))
+	}
+	return table.NewPath(nil, nlri, false, attrs, time.Now(), false), nil
+}
+
+// announcementHandle is Plugin's AnnouncementHandle implementation. It identifies announced path by UUID that goBGP
+// assigned to it.
+type announcementHandle struct {
+	sync.Mutex
+	plugin    *Plugin
+	prefix    string
+	key       string // canonical prefix (key of plugin's announcements)
+	uuid      []byte
+	family    bgpPacket.RouteFamily
+	withdrawn bool
+}
+
+// Withdraw withdraws the announced path from goBGP server (and therefore from all BGP neighbors). Repeated withdrawal
+// does nothing. It fails if goBGP server fails to delete the path. The prefix can be announced again after withdrawal.
+func (handle *announcementHandle) Withdraw() error {
+	handle.Lock()
+	defer handle.Unlock()
+	if handle.withdrawn {
+		return nil
+	}
+	handle.plugin.announcementsMu.Lock()
+	defer handle.plugin.announcementsMu.Unlock()
+	if err := handle.plugin.server.DeletePath(handle.uuid, handle.family, "", nil); err != nil {
+		return fmt.Errorf("Can't withdraw %s: %v", handle.prefix, err)
+	}
+	delete(handle.plugin.announcements, handle.key)
+	handle.withdrawn = true
+	handle.plugin.Log.Infof("Withdrawn %s", handle.prefix)
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	"github.com/ligato/cn-infra/flavors/local"
+	. "github.com/onsi/gomega"
+	"github.com/osrg/gobgp/config"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestDuplicateAnnouncement tests that announcement of already announced prefix is refused (goBGP would replace
+// the announced path, so that its handle couldn't withdraw it) and that the prefix can be announced again after withdrawal.
+func TestDuplicateAnnouncement(x *testing.T) {
+	RegisterTestingT(x)
+	plugin := startedPlugin()
+	defer plugin.Close()
+	events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestEventWatcher", func(event *bgp.RouteEvent) {
+		events <- *event
+	})
+	Expect(err).To(BeNil())
+
+	first, err := plugin.Announce(bgp.Announcement{Prefix: "10.96.0.10/32", Nexthop: net.ParseIP("172.18.0.1")})
+	Expect(err).To(BeNil())
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.RouteAdded))
+	_, err = plugin.Announce(bgp.Announcement{Prefix: "10.96.0.10/32", Nexthop: net.ParseIP("172.18.0.2")})
+	Expect(err).To(Equal(&AnnouncementExistsError{Prefix: "10.96.0.10/32"}))
+	_, err = plugin.Announce(bgp.Announcement{Prefix: "10.96.0.10/32", Nexthop: net.ParseIP("172.18.0.1")})
+	Expect(err).To(HaveOccurred())
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+
+	Expect(first.Withdraw()).To(BeNil())
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.RouteWithdrawn))
+	Expect(first.Withdraw()).To(BeNil())
+
+	second, err := plugin.Announce(bgp.Announcement{Prefix: "10.96.0.10/32", Nexthop: net.ParseIP("172.18.0.2")})
+	Expect(err).To(BeNil())
+	event := receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Nexthop.Equal(net.ParseIP("172.18.0.2"))).To(BeTrue())
+	Expect(first.Withdraw()).To(BeNil()) // withdrawn handle doesn't affect newer announcement
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+	Expect(second.Withdraw()).To(BeNil())
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.RouteWithdrawn))
+}
+
+// startedPlugin creates and starts plugin with goBGP server that has no neighbors.
+func startedPlugin() *Plugin {
+	flavor := &local.FlavorLocal{}
+	plugin := New(Deps{PluginInfraDeps: *flavor.InfraDeps("TestGoBGP"), SessionConfig: &config.Bgp{
+		Global: config.Global{Config: config.GlobalConfig{As: 65000, RouterId: "172.18.0.254", Port: -1}},
+	}})
+	Expect(plugin.Init()).To(BeNil())
+	Expect(plugin.AfterInit()).To(BeNil())
+	return plugin
+}
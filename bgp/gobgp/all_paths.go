@@ -0,0 +1,338 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"fmt"
+	"github.com/ligato/bgp-agent/bgp"
+	"github.com/osrg/gobgp/server"
+	"sort"
+	"time"
+)
+
+// processReceivedPaths translates paths received from peer (after import policy) into bgp.RouteEvent and queues them
+// for all registered watchers of all paths (see bgp.WithAllPaths()). Paths rejected by import policy come as withdrawals.
+// Received paths are tracked only while some watcher of all paths is registered (see trackReceivedPaths()), otherwise
+// they only refresh stale best routes (see toRefreshEvent()).
+func (plugin *Plugin) processReceivedPaths(msg *server.WatchEventUpdate) {
+	var events, refreshes []*bgp.RouteEvent
+	plugin.routesMu.Lock()
+	watchers := plugin.routeWatcherList(true)
+	for _, path := range msg.PathList {
+		if _, supported := supportedFamilies[path.GetRouteFamily()]; !supported {
+			continue
+		}
+		pathInfo := toReachableIPRoute(path)
+		if pathInfo.SourcePeer == nil {
+			continue
+		}
+		if !path.IsWithdraw && !pathInfo.Stale {
+			if refresh := plugin.toRefreshEvent(pathInfo); refresh != nil {
+				refreshes = append(refreshes, refresh)
+			}
+		}
+		if plugin.pathsLoad != nil { // received paths are being loaded for the first watcher of all paths
+			plugin.pathsLoad.changes = append(plugin.pathsLoad.changes, receivedPathChange{route: pathInfo, isWithdraw: path.IsWithdraw})
+			continue
+		}
+		if len(watchers) == 0 {
+			continue
+		}
+		key, err := pathKey(pathInfo)
+		if err != nil {
+			plugin.Log.Warnf("Ignoring received path with unparsable prefix %s: %v", pathInfo.Prefix, err)
+			continue
+		}
+		if event := plugin.toReceivedPathEvent(key, pathInfo, path.IsWithdraw); event != nil {
+			events = append(events, event)
+		}
+	}
+	bestPathWatchers := plugin.routeWatcherList(false)
+	plugin.routesMu.Unlock()
+
+	for _, refresh := range refreshes {
+		plugin.Log.Debugf("Stale route of %s was refreshed by %s", refresh.Route.Prefix, refresh.Route.SourcePeer)
+		for _, watcher := range bestPathWatchers {
+			watcher.notify(refresh)
+		}
+	}
+	for _, event := range events {
+		for _, watcher := range watchers {
+			watcher.notify(event)
+		}
+	}
+}
+
+// receivedPathsLoad is loading of received paths from goBGP RIB that starts tracking of received paths (see
+// loadReceivedPaths()). Changes of received paths processed while the RIB is read are recorded, so that they are
+// applied over loaded paths (see trackReceivedPaths()).
+type receivedPathsLoad struct {
+	paths   []*bgp.ReachableIPRoute // paths read from goBGP RIB
+	changes []receivedPathChange    // changes of received paths processed since the load started (guarded by routesMu)
+}
+
+// receivedPathChange is change of received path recorded during receivedPathsLoad.
+type receivedPathChange struct {
+	route      *bgp.ReachableIPRoute
+	isWithdraw bool
+}
+
+// loadReceivedPaths reads paths currently known to goBGP (after import policy) from its RIB for the first registered
+// watcher of all paths, so that its RIB snapshot contains paths received before its registration. Nil is returned
+// if received paths are already tracked. The RIB is read without holding routesMu (goBGP can wait for delivery
+// of its events whose processing needs routesMu), changes of received paths processed meanwhile are recorded
+// in returned load. Caller must hold pathsLoadMu until the load is passed to trackReceivedPaths().
+func (plugin *Plugin) loadReceivedPaths() *receivedPathsLoad {
+	plugin.routesMu.Lock()
+	if len(plugin.routeWatcherList(true)) > 0 || plugin.checkStarted() != nil {
+		plugin.routesMu.Unlock()
+		return nil
+	}
+	load := &receivedPathsLoad{}
+	plugin.pathsLoad = load
+	plugin.routesMu.Unlock()
+
+	for family := range supportedFamilies {
+		rib, err := plugin.server.GetRib("", family, nil)
+		if err != nil {
+			continue // family is not enabled
+		}
+		for _, destination := range rib.GetDestinations() {
+			for _, path := range destination.GetAllKnownPathList() {
+				if pathInfo := toReachableIPRoute(path); pathInfo.SourcePeer != nil {
+					load.paths = append(load.paths, pathInfo)
+				}
+			}
+		}
+	}
+	return load
+}
+
+// trackReceivedPaths starts tracking of received paths with paths of <load> (see loadReceivedPaths()) and changes
+// recorded during the load applied over them. Stale paths are swept after restart time of their peer
+// (see scheduleStaleSweep()). Caller must hold routesMu.
+func (plugin *Plugin) trackReceivedPaths(load *receivedPathsLoad) {
+	plugin.pathsLoad = nil
+	changes := make([]receivedPathChange, 0, len(load.paths)+len(load.changes))
+	for _, path := range load.paths {
+		changes = append(changes, receivedPathChange{route: path})
+	}
+	for _, change := range append(changes, load.changes...) {
+		if key, err := pathKey(change.route); err == nil {
+			plugin.toReceivedPathEvent(key, change.route, change.isWithdraw)
+		}
+	}
+	for peer, paths := range plugin.receivedPaths {
+		for _, path := range paths {
+			if !path.Stale {
+				continue
+			}
+			if _, sweepAfter := plugin.retainedFamilies(peer); sweepAfter > 0 {
+				plugin.scheduleStaleSweep(peer, sweepAfter)
+			}
+			break
+		}
+	}
+}
+
+// untrackReceivedPaths stops tracking of received paths (see trackReceivedPaths()) if no watcher of all paths
+// remains registered. Caller must hold routesMu.
+func (plugin *Plugin) untrackReceivedPaths() {
+	if len(plugin.routeWatcherList(true)) > 0 {
+		return
+	}
+	plugin.stopStaleSweeps()
+	plugin.receivedPaths = map[string]map[string]*bgp.ReachableIPRoute{}
+}
+
+// toReceivedPathEvent classifies change of received <route> (stored under <key>, see pathKey()) against last known
+// received paths and updates them accordingly. Path withdrawal is signalled by <isWithdraw>. Nil is returned
+// for withdrawal of unknown path. Caller must hold routesMu.
+func (plugin *Plugin) toReceivedPathEvent(key string, route *bgp.ReachableIPRoute, isWithdraw bool) *bgp.RouteEvent {
+	peer := route.SourcePeer.String()
+	paths := plugin.receivedPaths[peer]
+	previous, known := paths[key]
+	if isWithdraw {
+		if !known {
+			return nil
+		}
+		delete(paths, key)
+		if len(paths) == 0 {
+			delete(plugin.receivedPaths, peer)
+		}
+		return &bgp.RouteEvent{Type: bgp.RouteWithdrawn, Route: route, PreviousRoute: previous}
+	}
+	if paths == nil {
+		paths = map[string]*bgp.ReachableIPRoute{}
+		plugin.receivedPaths[peer] = paths
+	}
+	paths[key] = route
+	if !known {
+		return &bgp.RouteEvent{Type: bgp.RouteAdded, Route: route}
+	}
+	if route.Stale {
+		return &bgp.RouteEvent{Type: bgp.RouteStale, Route: route, PreviousRoute: previous}
+	}
+	return &bgp.RouteEvent{Type: bgp.RouteUpdated, Route: route, PreviousRoute: previous}
+}
+
+// dropReceivedPaths withdraws paths received from <peer> after loss of session with the peer and sends the withdrawals
+// to all registered watchers of all paths. Paths of route families <retained> by goBGP for gracefully restarting peer
+// are marked stale (and sent as bgp.RouteStale events) instead. Stale paths that are not refreshed in <sweepAfter>
+// are withdrawn (see sweepStaleReceivedPaths()). GoBGP doesn't notify post-policy watchers about paths dropped together
+// with session or after expiration of restart time.
+func (plugin *Plugin) dropReceivedPaths(peer string, retained map[bgp.RouteFamily]bool, sweepAfter time.Duration) {
+	plugin.routesMu.Lock()
+	paths := plugin.receivedPaths[peer]
+	var events []*bgp.RouteEvent
+	for _, key := range sortedPathKeys(paths) {
+		route := paths[key]
+		if !retained[route.Family] {
+			delete(paths, key)
+			events = append(events, &bgp.RouteEvent{Type: bgp.RouteWithdrawn, Route: route, PreviousRoute: route})
+		} else if !route.Stale {
+			stale := *route
+			stale.Stale = true
+			paths[key] = &stale
+			events = append(events, &bgp.RouteEvent{Type: bgp.RouteStale, Route: &stale, PreviousRoute: route})
+		}
+	}
+	if len(paths) == 0 {
+		delete(plugin.receivedPaths, peer)
+	} else {
+		plugin.scheduleStaleSweep(peer, sweepAfter)
+	}
+	watchers := plugin.routeWatcherList(true)
+	plugin.routesMu.Unlock()
+
+	if len(events) > 0 {
+		plugin.Log.Debugf("Sending %d events for paths received from %s after loss of session", len(events), peer)
+	}
+	for _, event := range events {
+		for _, watcher := range watchers {
+			watcher.notify(event)
+		}
+	}
+}
+
+// staleSweep is scheduled sweep of stale paths received from peer (see scheduleStaleSweep()).
+type staleSweep struct {
+	peer  string
+	timer *time.Timer
+}
+
+// scheduleStaleSweep schedules sweep of stale paths received from <peer> (see sweepStaleReceivedPaths()) after <delay>.
+// Previously scheduled sweep of the peer is cancelled. The sweep is passed to goroutine that processes goBGP events
+// (see watchChanges()), so that it is ordered with refreshes of stale paths. Caller must hold routesMu.
+func (plugin *Plugin) scheduleStaleSweep(peer string, delay time.Duration) {
+	if scheduled, found := plugin.staleSweeps[peer]; found {
+		scheduled.timer.Stop()
+	}
+	sweep := &staleSweep{peer: peer}
+	sweep.timer = time.AfterFunc(delay, func() {
+		select {
+		case plugin.staleSweepsDue <- sweep:
+		case <-plugin.stopWatch:
+		}
+	})
+	plugin.staleSweeps[peer] = sweep
+}
+
+// sweepStaleReceivedPaths withdraws paths received from peer of due <sweep> that are still stale and sends
+// the withdrawals to all registered watchers of all paths. Sweep that was cancelled or rescheduled after it became due
+// is ignored.
+func (plugin *Plugin) sweepStaleReceivedPaths(sweep *staleSweep) {
+	plugin.routesMu.Lock()
+	if plugin.staleSweeps[sweep.peer] != sweep {
+		plugin.routesMu.Unlock()
+		return
+	}
+	peer := sweep.peer
+	delete(plugin.staleSweeps, peer)
+	paths := plugin.receivedPaths[peer]
+	var events []*bgp.RouteEvent
+	for _, key := range sortedPathKeys(paths) {
+		if route := paths[key]; route.Stale {
+			delete(paths, key)
+			events = append(events, &bgp.RouteEvent{Type: bgp.RouteWithdrawn, Route: route, PreviousRoute: route})
+		}
+	}
+	if len(paths) == 0 {
+		delete(plugin.receivedPaths, peer)
+	}
+	watchers := plugin.routeWatcherList(true)
+	plugin.routesMu.Unlock()
+
+	if len(events) > 0 {
+		plugin.Log.Debugf("Withdrawing %d stale paths received from %s", len(events), peer)
+	}
+	for _, event := range events {
+		for _, watcher := range watchers {
+			watcher.notify(event)
+		}
+	}
+}
+
+// stopStaleSweeps cancels all scheduled sweeps of stale received paths. Caller must hold routesMu.
+func (plugin *Plugin) stopStaleSweeps() {
+	for peer, sweep := range plugin.staleSweeps {
+		sweep.timer.Stop()
+		delete(plugin.staleSweeps, peer)
+	}
+}
+
+// receivedPathList returns all currently received paths ordered by source peer and path key. Caller must hold routesMu.
+func (plugin *Plugin) receivedPathList() []*bgp.ReachableIPRoute {
+	peers := make([]string, 0, len(plugin.receivedPaths))
+	for peer := range plugin.receivedPaths {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	var routes []*bgp.ReachableIPRoute
+	for _, peer := range peers {
+		routes = append(routes, sortedPaths(plugin.receivedPaths[peer])...)
+	}
+	return routes
+}
+
+// sortedPaths returns <paths> ordered by their keys.
+func sortedPaths(paths map[string]*bgp.ReachableIPRoute) []*bgp.ReachableIPRoute {
+	keys := sortedPathKeys(paths)
+	routes := make([]*bgp.ReachableIPRoute, 0, len(keys))
+	for _, key := range keys {
+		routes = append(routes, paths[key])
+	}
+	return routes
+}
+
+// sortedPathKeys returns keys of <paths> in ascending order.
+func sortedPathKeys(paths map[string]*bgp.ReachableIPRoute) []string {
+	keys := make([]string, 0, len(paths))
+	for key := range paths {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pathKey returns key of received path that identifies the path among all paths of its prefix received from the same peer,
+// i.e. route key (see routeKey()) qualified by path identifier.
+func pathKey(route *bgp.ReachableIPRoute) (string, error) {
+	key, err := routeKey(route)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s|%d", key, route.PathID), nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	. "github.com/onsi/gomega"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestAllPathsWatching tests that watcher of all paths receives every received path of prefix (told apart by source peer
+// and path identifier), that best path watchers don't receive them and that paths of peer are withdrawn when session
+// with the peer is lost.
+func TestAllPathsWatching(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, bestPaths := pluginWithEventWatcher()
+	allPaths := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestAllPathsWatcher", func(event *bgp.RouteEvent) {
+		allPaths <- *event
+	}, bgp.WithAllPaths())
+	Expect(err).To(BeNil())
+
+	plugin.processReceivedPaths(&server.WatchEventUpdate{PostPolicy: true, PathList: []*table.Path{
+		receivedPath("10.0.0.1", 1, "10.0.0.1", false),
+		receivedPath("10.0.0.1", 2, "10.0.0.11", false),
+		receivedPath("10.0.0.2", 1, "10.0.0.2", false),
+	}})
+	for _, expected := range []struct {
+		peer    string
+		pathID  uint32
+		nexthop string
+	}{{"10.0.0.1", 1, "10.0.0.1"}, {"10.0.0.1", 2, "10.0.0.11"}, {"10.0.0.2", 1, "10.0.0.2"}} {
+		event := receiveRouteEvent(allPaths)
+		Expect(event.Type).To(Equal(bgp.RouteAdded))
+		Expect(event.Route.Prefix).To(Equal("10.7.0.0/24"))
+		Expect(event.Route.SourcePeer.String()).To(Equal(expected.peer))
+		Expect(event.Route.PathID).To(Equal(expected.pathID))
+		Expect(event.Route.Nexthop.String()).To(Equal(expected.nexthop))
+	}
+	Consistently(bestPaths, 100*time.Millisecond).ShouldNot(Receive())
+
+	plugin.processReceivedPaths(&server.WatchEventUpdate{PostPolicy: true, PathList: []*table.Path{
+		receivedPath("10.0.0.1", 2, "10.0.0.12", false),
+	}})
+	event := receiveRouteEvent(allPaths)
+	Expect(event.Type).To(Equal(bgp.RouteUpdated))
+	Expect(event.Route.Nexthop.String()).To(Equal("10.0.0.12"))
+	Expect(event.PreviousRoute.Nexthop.String()).To(Equal("10.0.0.11"))
+
+	snapshot := make(chan bgp.RouteEvent, 10)
+	_, err = plugin.WatchIPRouteEvents("TestSnapshotWatcher", func(event *bgp.RouteEvent) {
+		snapshot <- *event
+	}, bgp.WithAllPaths(), bgp.WithRIBSnapshot())
+	Expect(err).To(BeNil())
+	for i := 0; i < 3; i++ {
+		Expect(receiveRouteEvent(snapshot).Type).To(Equal(bgp.RouteAdded))
+	}
+	Expect(receiveRouteEvent(snapshot).Type).To(Equal(bgp.RIBSnapshotEnd))
+
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: net.ParseIP("10.0.0.1"), State: bgpPacket.BGP_FSM_ESTABLISHED})
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: net.ParseIP("10.0.0.1"), State: bgpPacket.BGP_FSM_IDLE})
+	for _, pathID := range []uint32{1, 2} {
+		event := receiveRouteEvent(allPaths)
+		Expect(event.Type).To(Equal(bgp.RouteWithdrawn))
+		Expect(event.Route.SourcePeer.String()).To(Equal("10.0.0.1"))
+		Expect(event.Route.PathID).To(Equal(pathID))
+	}
+
+	plugin.processReceivedPaths(&server.WatchEventUpdate{PostPolicy: true, PathList: []*table.Path{
+		receivedPath("10.0.0.2", 1, "10.0.0.2", true),
+		receivedPath("10.0.0.2", 3, "10.0.0.2", true),
+	}})
+	event = receiveRouteEvent(allPaths)
+	Expect(event.Type).To(Equal(bgp.RouteWithdrawn))
+	Expect(event.Route.SourcePeer.String()).To(Equal("10.0.0.2"))
+	Consistently(allPaths, 100*time.Millisecond).ShouldNot(Receive())
+}
+
+// TestReceivedPathsTrackedOnlyForAllPathsWatcher tests that received paths are stored only while some watcher of all paths
+// is registered.
+func TestReceivedPathsTrackedOnlyForAllPathsWatcher(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, _ := pluginWithEventWatcher()
+	received := &server.WatchEventUpdate{PostPolicy: true, PathList: []*table.Path{receivedPath("10.0.0.1", 1, "10.0.0.1", false)}}
+
+	plugin.processReceivedPaths(received)
+	Expect(plugin.receivedPaths).To(BeEmpty())
+
+	registration, err := plugin.WatchIPRouteEvents("TestAllPathsWatcher", func(event *bgp.RouteEvent) {}, bgp.WithAllPaths())
+	Expect(err).To(BeNil())
+	plugin.processReceivedPaths(received)
+	Expect(plugin.receivedPaths).To(HaveKey("10.0.0.1"))
+
+	Expect(registration.Close()).To(BeNil())
+	Expect(plugin.receivedPaths).To(BeEmpty())
+}
+
+// TestAllPathsSnapshotOfPathsReceivedBeforeRegistration tests that RIB snapshot of the first watcher of all paths contains
+// paths that goBGP received before the registration.
+func TestAllPathsSnapshotOfPathsReceivedBeforeRegistration(x *testing.T) {
+	RegisterTestingT(x)
+	plugin := startedPlugin()
+	defer plugin.Close()
+	_, err := plugin.server.AddPath("", []*table.Path{receivedPath("10.0.0.1", 1, "10.0.0.1", false)})
+	Expect(err).To(BeNil())
+
+	snapshot := make(chan bgp.RouteEvent, 10)
+	_, err = plugin.WatchIPRouteEvents("TestSnapshotWatcher", func(event *bgp.RouteEvent) {
+		snapshot <- *event
+	}, bgp.WithAllPaths(), bgp.WithRIBSnapshot())
+	Expect(err).To(BeNil())
+	event := receiveRouteEvent(snapshot)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Prefix).To(Equal("10.7.0.0/24"))
+	Expect(event.Route.SourcePeer.String()).To(Equal("10.0.0.1"))
+	Expect(receiveRouteEvent(snapshot).Type).To(Equal(bgp.RIBSnapshotEnd))
+}
+
+// TestReceivedPathChangesDuringLoad tests that changes of received paths processed while goBGP RIB is read for the first
+// watcher of all paths are applied over paths read from the RIB.
+func TestReceivedPathChangesDuringLoad(x *testing.T) {
+	RegisterTestingT(x)
+	plugin := startedPlugin()
+	defer plugin.Close()
+	_, err := plugin.server.AddPath("", []*table.Path{receivedPath("10.0.0.1", 1, "10.0.0.1", false)})
+	Expect(err).To(BeNil())
+
+	load := plugin.loadReceivedPaths()
+	Expect(load.paths).To(HaveLen(1))
+	plugin.processReceivedPaths(&server.WatchEventUpdate{PathList: []*table.Path{
+		receivedPath("10.0.0.1", 1, "10.0.0.1", true),
+		receivedPath("10.0.0.2", 1, "10.0.0.2", false),
+	}})
+	Expect(plugin.receivedPaths).To(BeEmpty())
+	plugin.routesMu.Lock()
+	plugin.trackReceivedPaths(load)
+	plugin.routesMu.Unlock()
+	Expect(plugin.pathsLoad).To(BeNil())
+	Expect(plugin.receivedPaths).To(HaveLen(1))
+	Expect(plugin.receivedPaths).To(HaveKey("10.0.0.2"))
+}
+
+// receivedPath creates goBGP path of prefix 10.7.0.0/24 via <nexthop> received from <peer> with path identifier <pathID>.
+func receivedPath(peer string, pathID uint32, nexthop string, isWithdraw bool) *table.Path {
+	nlri := bgpPacket.NewIPAddrPrefix(24, "10.7.0.0")
+	nlri.SetPathIdentifier(pathID)
+	source := &table.PeerInfo{AS: 65001, Address: net.ParseIP(peer), ID: net.ParseIP(peer)}
+	return table.NewPath(source, nlri, isWithdraw, []bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(0),
+		bgpPacket.NewPathAttributeNextHop(nexthop),
+	}, time.Now(), false)
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	"sync"
+	"time"
+)
+
+// WatchIPRouteBatches register watcher to notifications for any change of IP-based routes like WatchIPRouteEvents, but
+// route events are passed to <callback> in batches. Events caused by one goBGP event (i.e. best path changes of one
+// received update) are passed in the same batch unless the batch is full, batch size and flush interval can be set
+// by bgp.WithBatching() option. Within one batch, the latest event of each prefix wins (earlier events of the prefix
+// are merged into it, see bgp.MergeRouteEvents()). RIB snapshot (see bgp.WithRIBSnapshot()) is passed in batches too.
+// Registration semantics are the same as for WatchIPRouteEvents.
+func (plugin *Plugin) WatchIPRouteBatches(watcher string, callback func([]*bgp.RouteEvent), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	if callback == nil {
+		return nil, bgp.ErrNilCallback
+	}
+	plugin.Log.Infof("Watcher %s registering for watching of IPRoute batches in %s.", watcher, plugin.PluginName)
+	options := bgp.NewWatchOptions(opts...)
+	return plugin.registerRouteWatcher(watcher, options, func() *deliveryQueue {
+		return newRouteBatchQueue(options, callback)
+	})
+}
+
+// newRouteBatchQueue creates deliveryQueue for route events (coalesced by route, see routeEventKey()) that are passed
+// to <callback> in batches.
+func newRouteBatchQueue(options *bgp.WatchOptions, callback func([]*bgp.RouteEvent)) *deliveryQueue {
+	queue := newBatchDeliveryQueue(options.QueueSize, options.OverflowPolicy, options.BatchSize, options.FlushInterval,
+		func(events []interface{}) {
+			batch := make([]*bgp.RouteEvent, len(events))
+			for i, event := range events {
+				batch[i] = event.(*bgp.RouteEvent)
+			}
+			callback(batch)
+		})
+	return withRouteEventMerging(queue, options)
+}
+
+// newBatchDeliveryQueue creates deliveryQueue with given maximal <size> and overflow <policy> and starts its goroutine
+// that passes events to <deliver> in batches of at most <batchSize> events. Events are grouped by seal() and events
+// of completed groups wait at most <flushInterval> for more events (see batchReady()).
+func newBatchDeliveryQueue(size int, policy bgp.OverflowPolicy, batchSize int, flushInterval time.Duration,
+	deliver func(events []interface{})) *deliveryQueue {
+	queue := &deliveryQueue{
+		pending:       map[string]*queuedEvent{},
+		size:          size,
+		policy:        policy,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		deliverBatch:  deliver,
+		key:           func(interface{}) string { return "" },
+	}
+	queue.changed = sync.NewCond(queue)
+	go queue.runBatches()
+	return queue
+}
+
+// endGroup completes group of all currently queued events, so that they can be passed to batch watcher. Events pushed
+// later belong to the next group. It does nothing for queues that don't pass events in batches.
+func (queue *deliveryQueue) endGroup() {
+	queue.Lock()
+	defer queue.Unlock()
+	queue.seal()
+}
+
+// seal completes group of all currently queued events (see endGroup()). Caller must hold the queue lock.
+func (queue *deliveryQueue) seal() {
+	if queue.batchSize == 0 || queue.sealed == len(queue.events) {
+		return
+	}
+	if queue.sealed == 0 {
+		queue.sealedAt = time.Now()
+	}
+	queue.sealed = len(queue.events)
+	queue.changed.Broadcast()
+}
+
+// batchReady returns true if batch of events should be passed to watcher, i.e. if the queue is closed, if there are enough
+// events to fill the batch (or the queue) or if sealed events waited for flush interval. Caller must hold the queue lock.
+func (queue *deliveryQueue) batchReady() bool {
+	switch {
+	case queue.closed || len(queue.events) >= queue.batchSize || len(queue.events) >= queue.size:
+		return true
+	case queue.sealed == 0:
+		return false
+	default:
+		return !time.Now().Before(queue.sealedAt.Add(queue.flushInterval))
+	}
+}
+
+// waitForBatch waits for change of queued events or (if there are sealed events) for end of their flush interval.
+// Caller must hold the queue lock.
+func (queue *deliveryQueue) waitForBatch() {
+	if queue.sealed > 0 {
+		deadline := queue.sealedAt.Add(queue.flushInterval)
+		if queue.flushTimer == nil {
+			queue.flushTimer = time.AfterFunc(time.Until(deadline), queue.wakeUp)
+		} else if !queue.flushDeadline.Equal(deadline) {
+			queue.flushTimer.Reset(time.Until(deadline))
+		}
+		queue.flushDeadline = deadline
+	}
+	queue.changed.Wait()
+}
+
+// wakeUp wakes up goroutine of the queue waiting for batch.
+func (queue *deliveryQueue) wakeUp() {
+	queue.Lock()
+	defer queue.Unlock()
+	queue.changed.Broadcast()
+}
+
+// takeBatch removes the oldest events from the queue and returns them as batch. Sealed events are taken, unless
+// the queue is closed or full (then the oldest events are taken regardless of their group). Events with the same
+// coalescing key are merged into one event (placed at position of the oldest one) unless they are separated by marker
+// event, events that cancel each other are left out. Events of the batch are stamped for delivery. Caller must hold
+// the queue lock.
+func (queue *deliveryQueue) takeBatch() []interface{} {
+	count := queue.sealed
+	if queue.closed || len(queue.events) >= queue.batchSize || len(queue.events) >= queue.size {
+		count = len(queue.events)
+	}
+	if count > queue.batchSize {
+		count = queue.batchSize
+	}
+	batch := make([]*queuedEvent, 0, count)
+	positions := make(map[string]int, count)
+	for _, queued := range queue.events[:count] {
+		if queued.key == "" { // events are not merged across markers (i.e. into resync)
+			positions = map[string]int{}
+			batch = append(batch, queued)
+			continue
+		}
+		if i, found := positions[queued.key]; found {
+			if batch[i].event == nil {
+				batch[i] = queued
+			} else {
+				batch[i] = &queuedEvent{event: queue.merge(batch[i].event, queued.event), key: queued.key, stamp: queued.stamp}
+				queue.stats.Coalesced++
+			}
+			continue
+		}
+		positions[queued.key] = len(batch)
+		batch = append(batch, queued)
+	}
+	for i := 0; i < count; i++ {
+		queue.remove(0)
+	}
+	if queue.sealed == 0 {
+		queue.sealedAt = time.Time{}
+	}
+
+	events := make([]interface{}, 0, len(batch))
+	for _, queued := range batch {
+		if queued.event != nil {
+			events = append(events, queue.stamped(queued))
+		}
+	}
+	return events
+}
+
+// runBatches passes queued events to watcher in batches (see takeBatch()) until the queue is closed and empty.
+func (queue *deliveryQueue) runBatches() {
+	for {
+		queue.Lock()
+		for !queue.batchReady() {
+			queue.waitForBatch()
+		}
+		if len(queue.events) == 0 {
+			if queue.flushTimer != nil {
+				queue.flushTimer.Stop()
+			}
+			queue.Unlock()
+			return
+		}
+		batch := queue.takeBatch()
+		queue.Unlock()
+
+		if len(batch) == 0 {
+			continue
+		}
+		queue.deliverBatch(batch)
+
+		queue.Lock()
+		queue.stats.Delivered += uint64(len(batch))
+		queue.Unlock()
+	}
+}
+
+// endEventGroup ends group of route events sent to watchers for one goBGP event, so that batch watchers can receive
+// them (see deliveryQueue.endGroup()).
+func (plugin *Plugin) endEventGroup() {
+	plugin.routesMu.Lock()
+	defer plugin.routesMu.Unlock()
+	for _, watcher := range plugin.routeWatchers {
+		watcher.queue.endGroup()
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"encoding/binary"
+	"github.com/ligato/bgp-agent/bgp"
+	"github.com/ligato/cn-infra/flavors/local"
+	. "github.com/onsi/gomega"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// benchmarkFeedSizes are counts of prefixes of full-table feeds used by delivery benchmarks (sub-benchmark of each
+// size). Feed of 1M prefixes (size of full Internet table) is skipped in short mode.
+var benchmarkFeedSizes = []struct {
+	name     string
+	prefixes int
+	long     bool
+}{
+	{"100k", 100000, false},
+	{"1M", 1000000, true},
+}
+
+// benchmarkUpdateSize is count of best path changes in one goBGP event of full-table feed used by delivery benchmarks.
+const benchmarkUpdateSize = 1000
+
+// TestRouteBatchWatching tests that route events of one goBGP event are passed to batch watcher together (split only
+// by batch size) and that the latest event of prefix wins within the batch.
+func TestRouteBatchWatching(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, batches := pluginWithBatchWatcher(bgp.WithBatching(2, 0))
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.8.1.0", false),
+	}})
+	Consistently(batches, 100*time.Millisecond).ShouldNot(Receive())
+	plugin.endEventGroup()
+	batch := receiveBatch(batches)
+	Expect(batch).To(HaveLen(1))
+	Expect(batch[0].Type).To(Equal(bgp.RouteAdded))
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.8.2.0", false),
+		peerPath("10.0.0.2", "10.8.2.0", false),
+		peerPath("10.0.0.1", "10.8.3.0", false),
+	}})
+	batch = receiveBatch(batches)
+	Expect(batch).To(HaveLen(1))
+	Expect(batch[0].Type).To(Equal(bgp.RouteAdded))
+	Expect(batch[0].Route.Prefix).To(Equal("10.8.2.0/24"))
+	Expect(batch[0].Route.SourcePeer.String()).To(Equal("10.0.0.2"))
+	Consistently(batches, 100*time.Millisecond).ShouldNot(Receive())
+	plugin.endEventGroup()
+	batch = receiveBatch(batches)
+	Expect(batch).To(HaveLen(1))
+	Expect(batch[0].Route.Prefix).To(Equal("10.8.3.0/24"))
+
+	stats, _ := plugin.WatcherStats("TestBatchWatcher")
+	Expect(stats).To(Equal(bgp.WatchStats{Delivered: 3, Coalesced: 1}))
+}
+
+// TestRouteBatchFlushInterval tests that route events of more goBGP events are gathered into one batch until flush
+// interval passes and that route events that cancel each other within the batch are left out.
+func TestRouteBatchFlushInterval(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, batches := pluginWithBatchWatcher(bgp.WithBatching(10, 300*time.Millisecond))
+
+	for _, path := range []*table.Path{
+		peerPath("10.0.0.1", "10.8.1.0", false),
+		peerPath("10.0.0.1", "10.8.2.0", false),
+		peerPath("10.0.0.1", "10.8.1.0", true),
+	} {
+		plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{path}})
+		plugin.endEventGroup()
+	}
+	Consistently(batches, 100*time.Millisecond).ShouldNot(Receive())
+	batch := receiveBatch(batches)
+	Expect(batch).To(HaveLen(1))
+	Expect(batch[0].Type).To(Equal(bgp.RouteAdded))
+	Expect(batch[0].Route.Prefix).To(Equal("10.8.2.0/24"))
+}
+
+// BenchmarkRouteEventDelivery measures processing of full-table feed until all route events are delivered to watcher
+// that receives them one by one.
+func BenchmarkRouteEventDelivery(b *testing.B) {
+	runFeedSizes(b, func(b *testing.B, prefixes int) {
+		benchmarkFullTableDelivery(b, prefixes, watchEvents)
+	})
+}
+
+// BenchmarkRouteBatchDelivery measures processing of full-table feed until all route events are delivered to watcher
+// that receives them in batches.
+func BenchmarkRouteBatchDelivery(b *testing.B) {
+	runFeedSizes(b, func(b *testing.B, prefixes int) {
+		benchmarkFullTableDelivery(b, prefixes, watchBatches)
+	})
+}
+
+// BenchmarkRIBSnapshotEventDelivery measures delivery of RIB snapshot of full table to watcher that receives route events
+// one by one.
+func BenchmarkRIBSnapshotEventDelivery(b *testing.B) {
+	runFeedSizes(b, func(b *testing.B, prefixes int) {
+		benchmarkSnapshotDelivery(b, prefixes, watchEvents)
+	})
+}
+
+// BenchmarkRIBSnapshotBatchDelivery measures delivery of RIB snapshot of full table to watcher that receives route events
+// in batches.
+func BenchmarkRIBSnapshotBatchDelivery(b *testing.B) {
+	runFeedSizes(b, func(b *testing.B, prefixes int) {
+		benchmarkSnapshotDelivery(b, prefixes, watchBatches)
+	})
+}
+
+// runFeedSizes runs <benchmark> as sub-benchmark for each of benchmarkFeedSizes.
+func runFeedSizes(b *testing.B, benchmark func(b *testing.B, prefixes int)) {
+	for _, size := range benchmarkFeedSizes {
+		b.Run(size.name, func(b *testing.B) {
+			if size.long && testing.Short() {
+				b.Skip("skipping feed of full Internet table in short mode")
+			}
+			benchmark(b, size.prefixes)
+		})
+	}
+}
+
+// benchmarkWatch registers benchmark watcher of given <name> and <opts>. Watcher passes route events to its consumer
+// through channel and consumer signals delivery of each route event to <delivered> wait group.
+type benchmarkWatch func(plugin *Plugin, name string, delivered *sync.WaitGroup, opts ...bgp.WatchOption) (bgp.WatchRegistration, error)
+
+// watchEvents is benchmarkWatch of watcher that receives route events one by one.
+func watchEvents(plugin *Plugin, name string, delivered *sync.WaitGroup, opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	events := make(chan *bgp.RouteEvent, bgp.DefaultQueueSize)
+	go func() {
+		for event := range events {
+			if event.Route != nil {
+				delivered.Done()
+			}
+		}
+	}()
+	return plugin.WatchIPRouteEvents(name, func(event *bgp.RouteEvent) {
+		events <- event
+	}, opts...)
+}
+
+// watchBatches is benchmarkWatch of watcher that receives route events in batches.
+func watchBatches(plugin *Plugin, name string, delivered *sync.WaitGroup, opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	batches := make(chan []*bgp.RouteEvent, bgp.DefaultQueueSize)
+	go func() {
+		for batch := range batches {
+			for _, event := range batch {
+				if event.Route != nil {
+					delivered.Done()
+				}
+			}
+		}
+	}()
+	return plugin.WatchIPRouteBatches(name, func(batch []*bgp.RouteEvent) {
+		batches <- batch
+	}, opts...)
+}
+
+// benchmarkFullTableDelivery measures processing of full-table feed (<prefixes> announced by goBGP events
+// of benchmarkUpdateSize best path changes) until all route events are delivered to watcher registered by <watch>.
+func benchmarkFullTableDelivery(b *testing.B, prefixes int, watch benchmarkWatch) {
+	flavor := &local.FlavorLocal{}
+	plugin := New(Deps{PluginInfraDeps: *flavor.InfraDeps("BenchmarkGoBGP")})
+	delivered := &sync.WaitGroup{}
+	registration, err := watch(plugin, "BenchmarkWatcher", delivered)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer registration.Close()
+	updates := fullTableUpdates(prefixes)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		plugin.routesMu.Lock()
+		plugin.rib = newRIBIndex()
+		plugin.routesMu.Unlock()
+		delivered.Add(prefixes)
+		b.StartTimer()
+
+		for _, update := range updates {
+			plugin.processBestPaths(update)
+			plugin.endEventGroup()
+		}
+		delivered.Wait()
+	}
+}
+
+// benchmarkSnapshotDelivery measures delivery of RIB snapshot of full table (<prefixes>) to late watcher registered
+// by <watch>.
+func benchmarkSnapshotDelivery(b *testing.B, prefixes int, watch benchmarkWatch) {
+	flavor := &local.FlavorLocal{}
+	plugin := New(Deps{PluginInfraDeps: *flavor.InfraDeps("BenchmarkGoBGP")})
+	for _, update := range fullTableUpdates(prefixes) {
+		plugin.processBestPaths(update)
+	}
+	delivered := &sync.WaitGroup{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		delivered.Add(prefixes)
+		registration, err := watch(plugin, "BenchmarkWatcher", delivered, bgp.WithRIBSnapshot())
+		if err != nil {
+			b.Fatal(err)
+		}
+		delivered.Wait()
+		registration.Close()
+	}
+}
+
+// fullTableUpdates creates goBGP events that announce <prefixes> distinct /24 prefixes.
+func fullTableUpdates(prefixes int) []*server.WatchEventBestPath {
+	source := &table.PeerInfo{AS: 65001, Address: net.ParseIP("10.0.0.1"), ID: net.ParseIP("10.0.0.1")}
+	attributes := []bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(0),
+		bgpPacket.NewPathAttributeNextHop("10.0.0.1"),
+	}
+	updates := make([]*server.WatchEventBestPath, 0, prefixes/benchmarkUpdateSize)
+	for i := 0; i < prefixes; i += benchmarkUpdateSize {
+		paths := make([]*table.Path, 0, benchmarkUpdateSize)
+		for j := i; j < i+benchmarkUpdateSize; j++ {
+			prefix := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(prefix, uint32(0x01000000+j<<8))
+			paths = append(paths, table.NewPath(source, bgpPacket.NewIPAddrPrefix(24, prefix.String()), false, attributes, time.Now(), false))
+		}
+		updates = append(updates, &server.WatchEventBestPath{PathList: paths})
+	}
+	return updates
+}
+
+// pluginWithBatchWatcher creates plugin (without goBGP server) with registered batch watcher that forwards received
+// batches to returned channel. Batch watcher is registered with given <opts>.
+func pluginWithBatchWatcher(opts ...bgp.WatchOption) (*Plugin, chan []*bgp.RouteEvent) {
+	flavor := &local.FlavorLocal{}
+	plugin := New(Deps{PluginInfraDeps: *flavor.InfraDeps("TestGoBGP")})
+	batches := make(chan []*bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteBatches("TestBatchWatcher", func(batch []*bgp.RouteEvent) {
+		batches <- batch
+	}, opts...)
+	Expect(err).To(BeNil())
+	return plugin, batches
+}
+
+// receiveBatch waits for batch of route events from <batches> channel (see pluginWithBatchWatcher()).
+func receiveBatch(batches chan []*bgp.RouteEvent) []*bgp.RouteEvent {
+	var batch []*bgp.RouteEvent
+	Eventually(batches, time.Second).Should(Receive(&batch))
+	return batch
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// dampeningReuseInterval is period of checks whether prefixes suppressed by dampening can be reused.
+const dampeningReuseInterval = time.Second
+
+// dampener implements route flap dampening (RFC 2439) of route events sent to best path watchers. Each withdrawal or update
+// of prefix is penalized and events of prefix whose penalty exceeds suppress threshold are held back until the penalty
+// decays below reuse threshold (or until max suppress time passes). The change of prefix that happened meanwhile is then
+// sent to watchers as one event. dampener is not thread-safe.
+type dampener struct {
+	config   bgp.DampeningConfig
+	prefixes map[string]*dampenedPrefix // by route key (see routeKey())
+}
+
+// dampenedPrefix is dampening state of one penalized prefix.
+type dampenedPrefix struct {
+	penalty      float64               // penalty at updatedAt
+	updatedAt    time.Time             // time of last penalty update
+	suppressedAt time.Time             // zero if prefix is not suppressed
+	delivered    *bgp.ReachableIPRoute // route known to watchers when suppression started (nil if prefix wasn't reachable)
+	route        *bgp.ReachableIPRoute // last route of prefix (identifies the prefix)
+}
+
+// newDampener creates dampener with given (valid) <config>.
+func newDampener(config bgp.DampeningConfig) *dampener {
+	return &dampener{config: config, prefixes: map[string]*dampenedPrefix{}}
+}
+
+// penalize penalizes change of prefix stored under <key> (see routeKey()) that is described by <event> at time <now>.
+// Withdrawals and updates are penalized, additions are not. It returns true if the event must be held back, because
+// the prefix is suppressed.
+func (d *dampener) penalize(key string, event *bgp.RouteEvent, now time.Time) bool {
+	state, found := d.prefixes[key]
+	if !found {
+		if event.Type == bgp.RouteAdded {
+			return false
+		}
+		state = &dampenedPrefix{updatedAt: now}
+		d.prefixes[key] = state
+	}
+	state.penalty = d.config.Decay(state.penalty, now.Sub(state.updatedAt))
+	state.updatedAt = now
+	if event.Type != bgp.RouteAdded {
+		state.penalty = math.Min(state.penalty+float64(d.config.Penalty), d.config.MaxPenalty())
+	}
+	state.route = event.Route
+	if !state.suppressedAt.IsZero() {
+		return true
+	}
+	if state.penalty > float64(d.config.SuppressThreshold) {
+		state.suppressedAt = now
+		state.delivered = event.PreviousRoute
+		return true
+	}
+	return false
+}
+
+// held returns true if events of prefix stored under <key> are held back, because the prefix is suppressed.
+func (d *dampener) held(key string) bool {
+	state, found := d.prefixes[key]
+	return found && !state.suppressedAt.IsZero()
+}
+
+// reuse ends suppression of prefixes whose penalty decayed below reuse threshold or that are suppressed longer than
+// max suppress time at <now>. It returns routes known to watchers when suppression of reused prefixes started
+// by their keys. Prefixes whose penalty decayed below half of reuse threshold are forgotten.
+func (d *dampener) reuse(now time.Time) map[string]*bgp.ReachableIPRoute {
+	reused := map[string]*bgp.ReachableIPRoute{}
+	for key, state := range d.prefixes {
+		penalty := d.config.Decay(state.penalty, now.Sub(state.updatedAt))
+		if state.suppressedAt.IsZero() {
+			if penalty < float64(d.config.ReuseThreshold)/2 {
+				delete(d.prefixes, key)
+			}
+			continue
+		}
+		if penalty < float64(d.config.ReuseThreshold) || now.Sub(state.suppressedAt) >= d.config.MaxSuppressTime {
+			reused[key] = state.delivered
+			state.suppressedAt = time.Time{}
+			state.delivered = nil
+		}
+	}
+	return reused
+}
+
+// suppressed returns routes known to watchers for all currently suppressed prefixes by their keys.
+func (d *dampener) suppressed() map[string]*bgp.ReachableIPRoute {
+	suppressed := map[string]*bgp.ReachableIPRoute{}
+	for key, state := range d.prefixes {
+		if !state.suppressedAt.IsZero() {
+			suppressed[key] = state.delivered
+		}
+	}
+	return suppressed
+}
+
+// suppressedPrefixes returns all currently suppressed prefixes (ordered by their keys) with their penalty at <now>.
+func (d *dampener) suppressedPrefixes(now time.Time) []bgp.SuppressedPrefix {
+	keys := make([]string, 0, len(d.prefixes))
+	for key, state := range d.prefixes {
+		if !state.suppressedAt.IsZero() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	prefixes := make([]bgp.SuppressedPrefix, 0, len(keys))
+	for _, key := range keys {
+		state := d.prefixes[key]
+		penalty := d.config.Decay(state.penalty, now.Sub(state.updatedAt))
+		reuseAt := now.Add(d.config.ReuseDelay(penalty))
+		if maxReuseAt := state.suppressedAt.Add(d.config.MaxSuppressTime); maxReuseAt.Before(reuseAt) {
+			reuseAt = maxReuseAt
+		}
+		prefixes = append(prefixes, bgp.SuppressedPrefix{
+			Family:             state.route.Family,
+			RouteDistinguisher: state.route.RouteDistinguisher,
+			Prefix:             state.route.Prefix,
+			Penalty:            uint32(penalty),
+			SuppressedSince:    state.suppressedAt,
+			ReuseAt:            reuseAt,
+		})
+	}
+	return prefixes
+}
+
+// dampen penalizes change of prefix stored under <key> described by best path route <event> if dampening is enabled
+// (see dampener.penalize()). It returns true if the event must be held back. Caller must hold routesMu.
+func (plugin *Plugin) dampen(key string, event *bgp.RouteEvent) bool {
+	return plugin.dampener != nil && plugin.dampener.penalize(key, event, time.Now())
+}
+
+// suppressed returns true if events of prefix stored under <key> are held back by dampening. Caller must hold routesMu.
+func (plugin *Plugin) suppressed(key string) bool {
+	return plugin.dampener != nil && plugin.dampener.held(key)
+}
+
+// reuseDampenedRoutes ends suppression of prefixes that can be reused at <now> (see dampener.reuse()) and sends
+// the change of each reused prefix that happened during its suppression to all registered best path watchers.
+func (plugin *Plugin) reuseDampenedRoutes(now time.Time) {
+	plugin.routesMu.Lock()
+	reused := plugin.dampener.reuse(now)
+	keys := make([]string, 0, len(reused))
+	for key := range reused {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var events []*bgp.RouteEvent
+	for _, key := range keys {
+		current, _ := plugin.rib.get(key)
+		if event := toReuseEvent(reused[key], current); event != nil {
+			events = append(events, event)
+		}
+	}
+	watchers := plugin.routeWatcherList(false)
+	plugin.routesMu.Unlock()
+
+	for _, event := range events {
+		plugin.Log.Debugf("Reusing dampened prefix %s, sending %v route event", event.Route.Prefix, event.Type)
+		for _, watcher := range watchers {
+			watcher.notify(event)
+		}
+	}
+}
+
+// toReuseEvent returns route event that describes change from <delivered> route (known to watchers when suppression
+// of prefix started) to <current> route of the prefix (nil means that prefix is not reachable). Nil is returned
+// if nothing changed.
+func toReuseEvent(delivered, current *bgp.ReachableIPRoute) *bgp.RouteEvent {
+	switch {
+	case delivered == nil && current == nil:
+		return nil
+	case delivered == nil:
+		return &bgp.RouteEvent{Type: bgp.RouteAdded, Route: current}
+	case current == nil:
+		return &bgp.RouteEvent{Type: bgp.RouteWithdrawn, Route: delivered, PreviousRoute: delivered}
+	case reflect.DeepEqual(delivered, current):
+		return nil
+	case current.Stale:
+		return &bgp.RouteEvent{Type: bgp.RouteStale, Route: current, PreviousRoute: delivered}
+	default:
+		return &bgp.RouteEvent{Type: bgp.RouteUpdated, Route: current, PreviousRoute: delivered}
+	}
+}
+
+// deliveredRoutes returns currently reachable routes as they are known to best path watchers, i.e. with routes
+// of suppressed prefixes replaced by their routes known to watchers. Caller must hold routesMu.
+func (plugin *Plugin) deliveredRoutes() []*bgp.ReachableIPRoute {
+	if plugin.dampener == nil {
+		return plugin.rib.routes()
+	}
+	suppressed := plugin.dampener.suppressed()
+	if len(suppressed) == 0 {
+		return plugin.rib.routes()
+	}
+	delivered := plugin.rib.clone()
+	for key, route := range suppressed {
+		if route == nil {
+			delivered.delete(key)
+		} else {
+			delivered.put(key, route)
+		}
+	}
+	return delivered.routes()
+}
+
+// SuppressedPrefixes returns all prefixes whose route events are currently suppressed by route flap dampening (ordered
+// by prefix). Nil is returned if dampening is disabled (see Deps.Dampening).
+func (plugin *Plugin) SuppressedPrefixes() []bgp.SuppressedPrefix {
+	plugin.routesMu.Lock()
+	defer plugin.routesMu.Unlock()
+	if plugin.dampener == nil {
+		return nil
+	}
+	return plugin.dampener.suppressedPrefixes(time.Now())
+}
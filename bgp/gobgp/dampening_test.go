@@ -0,0 +1,89 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	. "github.com/onsi/gomega"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"testing"
+	"time"
+)
+
+// TestDampening tests that route events of flapping prefix are suppressed once its penalty exceeds suppress threshold,
+// that suppressed prefix is listed with its penalty and that the change of prefix is sent to watchers when it is reused.
+func TestDampening(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, events := pluginWithEventWatcher()
+	config := bgp.DefaultDampeningConfig()
+	config.SuppressThreshold = 1500
+	Expect(config.Validate()).To(BeNil())
+	plugin.dampener = newDampener(config)
+	Expect(plugin.SuppressedPrefixes()).To(BeEmpty())
+
+	flap := func(isWithdraw bool) {
+		plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+			peerPath("10.0.0.1", "10.8.1.0", isWithdraw),
+		}})
+	}
+	flap(false)
+	flap(true)
+	flap(false)
+	for _, eventType := range []bgp.RouteEventType{bgp.RouteAdded, bgp.RouteWithdrawn, bgp.RouteAdded} {
+		Expect(receiveRouteEvent(events).Type).To(Equal(eventType))
+	}
+	flap(true)
+	flap(false)
+	flap(true)
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+
+	suppressed := plugin.SuppressedPrefixes()
+	Expect(suppressed).To(HaveLen(1))
+	Expect(suppressed[0].Prefix).To(Equal("10.8.1.0/24"))
+	Expect(suppressed[0].Penalty).To(BeNumerically("~", 3000, 10))
+	Expect(suppressed[0].ReuseAt).To(BeTemporally(">", suppressed[0].SuppressedSince))
+
+	snapshot := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestLateWatcher", func(event *bgp.RouteEvent) {
+		snapshot <- *event
+	}, bgp.WithRIBSnapshot())
+	Expect(err).To(BeNil())
+	event := receiveRouteEvent(snapshot)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Prefix).To(Equal("10.8.1.0/24"))
+	Expect(receiveRouteEvent(snapshot).Type).To(Equal(bgp.RIBSnapshotEnd))
+
+	plugin.reuseDampenedRoutes(time.Now().Add(time.Minute))
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+	plugin.reuseDampenedRoutes(time.Now().Add(config.HalfLife * 3))
+	event = receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteWithdrawn))
+	Expect(event.PreviousRoute.Prefix).To(Equal("10.8.1.0/24"))
+	Expect(plugin.SuppressedPrefixes()).To(BeEmpty())
+}
+
+// TestDampeningConfigValidation tests that dampening configuration that can't suppress any prefix is refused.
+func TestDampeningConfigValidation(x *testing.T) {
+	RegisterTestingT(x)
+	Expect(bgp.DefaultDampeningConfig().Validate()).To(BeNil())
+
+	config := bgp.DefaultDampeningConfig()
+	config.ReuseThreshold = config.SuppressThreshold
+	Expect(config.Validate()).NotTo(BeNil())
+	config = bgp.DefaultDampeningConfig()
+	config.MaxSuppressTime = config.HalfLife
+	Expect(config.Validate()).NotTo(BeNil())
+}
@@ -0,0 +1,372 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// deliveryQueue is bounded queue of events for one watcher. Dedicated goroutine (see run()) takes events from the queue
+// and passes them to watcher, so that slow watcher doesn't delay processing of goBGP events. What happens when the queue
+// is full is given by overflow policy.
+type deliveryQueue struct {
+	sync.Mutex
+	changed *sync.Cond // signals change of queued events or closing of queue
+	events  []*queuedEvent
+	pending map[string]*queuedEvent // queued events by coalescing key
+	size    int
+	policy  bgp.OverflowPolicy
+	closed  bool
+	stats   bgp.WatchStats
+
+	batchSize     int           // maximal count of events passed to watcher at once (0 if events are passed one by one)
+	flushInterval time.Duration // maximal time that events of completed groups wait for more events (batches only)
+	sealed        int           // count of queued events (from the oldest) whose group is completed (batches only)
+	sealedAt      time.Time     // time when the oldest sealed event was sealed (batches only)
+	flushTimer    *time.Timer   // wakes up goroutine of the queue when sealed events should be flushed (batches only)
+	flushDeadline time.Time     // time for which flushTimer is set
+
+	deliver         func(event interface{})                    // passes event to watcher
+	deliverBatch    func(events []interface{})                 // passes batch of events to watcher (batches only)
+	key             func(event interface{}) string             // coalescing key of event ("" for events that can't be coalesced)
+	merge           func(older, newer interface{}) interface{} // merges events with the same key (nil if they cancel each other)
+	disconnectEvent interface{}                                // last event delivered to disconnected watcher
+	onDisconnect    func()                                     // called after disconnection of watcher due to full queue
+
+	sequence uint64                                                    // sequence number of the last delivered (or dropped) event (see bgp.EventStamp)
+	stamp    func(event interface{}, stamp bgp.EventStamp) interface{} // returns copy of event with stamp (nil if events are not stamped)
+	epoch    func() uint64                                             // returns current session epoch of plugin (nil means epoch 0)
+}
+
+// queuedEvent is event waiting in deliveryQueue together with its coalescing key and stamp (sequence number of stamp
+// is assigned on delivery).
+type queuedEvent struct {
+	event interface{}
+	key   string
+	stamp bgp.EventStamp
+}
+
+// newDeliveryQueue creates deliveryQueue with given maximal <size> and overflow <policy> and starts its goroutine that passes
+// events to <deliver>.
+func newDeliveryQueue(size int, policy bgp.OverflowPolicy, deliver func(event interface{})) *deliveryQueue {
+	queue := &deliveryQueue{
+		pending: map[string]*queuedEvent{},
+		size:    size,
+		policy:  policy,
+		deliver: deliver,
+		key:     func(interface{}) string { return "" },
+	}
+	queue.changed = sync.NewCond(queue)
+	go queue.run()
+	return queue
+}
+
+// newRouteEventQueue creates deliveryQueue for route events (coalesced by route, see routeEventKey()) that are passed
+// to <callback>.
+func newRouteEventQueue(options *bgp.WatchOptions, callback func(*bgp.RouteEvent)) *deliveryQueue {
+	queue := newDeliveryQueue(options.QueueSize, options.OverflowPolicy, func(event interface{}) {
+		callback(event.(*bgp.RouteEvent))
+	})
+	return withRouteEventMerging(queue, options)
+}
+
+// withRouteEventMerging sets coalescing of route events (by route, see routeEventKey()) and disconnect event of route
+// watcher for <queue>.
+func withRouteEventMerging(queue *deliveryQueue, options *bgp.WatchOptions) *deliveryQueue {
+	queue.key = func(event interface{}) string {
+		if route := event.(*bgp.RouteEvent).Route; route != nil {
+			return routeEventKey(route, options.AllPaths)
+		}
+		return ""
+	}
+	queue.merge = func(older, newer interface{}) interface{} {
+		if merged := bgp.MergeRouteEvents(older.(*bgp.RouteEvent), newer.(*bgp.RouteEvent)); merged != nil {
+			return merged
+		}
+		return nil
+	}
+	queue.stamp = func(event interface{}, stamp bgp.EventStamp) interface{} {
+		stamped := *event.(*bgp.RouteEvent)
+		stamped.Stamp = stamp
+		return &stamped
+	}
+	queue.disconnectEvent = &bgp.RouteEvent{Type: bgp.WatchDisconnected}
+	return queue
+}
+
+// routeEventKey returns coalescing key of <route> events, i.e. its prefix qualified by route family and route
+// distinguisher. Routes of watcher of all paths (<allPaths>) are further qualified by source peer and path identifier.
+func routeEventKey(route *bgp.ReachableIPRoute, allPaths bool) string {
+	key := route.Family.String() + "|" + route.RouteDistinguisher + "|" + route.Prefix
+	if allPaths {
+		key += "|" + route.SourcePeer.String() + "|" + strconv.FormatUint(uint64(route.PathID), 10)
+	}
+	return key
+}
+
+// newEVPNEventQueue creates deliveryQueue for EVPN events (coalesced by EVPN route) that are passed to <callback>.
+func newEVPNEventQueue(options *bgp.WatchOptions, callback func(*bgp.EVPNEvent)) *deliveryQueue {
+	queue := newDeliveryQueue(options.QueueSize, options.OverflowPolicy, func(event interface{}) {
+		callback(event.(*bgp.EVPNEvent))
+	})
+	queue.key = func(event interface{}) string {
+		if route := event.(*bgp.EVPNEvent).Route; route != nil {
+			return evpnRouteKey(route)
+		}
+		return ""
+	}
+	queue.merge = func(older, newer interface{}) interface{} {
+		if merged := bgp.MergeEVPNEvents(older.(*bgp.EVPNEvent), newer.(*bgp.EVPNEvent)); merged != nil {
+			return merged
+		}
+		return nil
+	}
+	queue.stamp = func(event interface{}, stamp bgp.EventStamp) interface{} {
+		stamped := *event.(*bgp.EVPNEvent)
+		stamped.Stamp = stamp
+		return &stamped
+	}
+	queue.disconnectEvent = &bgp.EVPNEvent{Type: bgp.WatchDisconnected}
+	return queue
+}
+
+// newFlowSpecEventQueue creates deliveryQueue for FlowSpec events (coalesced by FlowSpec rule) that are passed to <callback>.
+func newFlowSpecEventQueue(options *bgp.WatchOptions, callback func(*bgp.FlowSpecEvent)) *deliveryQueue {
+	queue := newDeliveryQueue(options.QueueSize, options.OverflowPolicy, func(event interface{}) {
+		callback(event.(*bgp.FlowSpecEvent))
+	})
+	queue.key = func(event interface{}) string {
+		if rule := event.(*bgp.FlowSpecEvent).Rule; rule != nil {
+			return flowSpecRuleKey(rule)
+		}
+		return ""
+	}
+	queue.merge = func(older, newer interface{}) interface{} {
+		if merged := bgp.MergeFlowSpecEvents(older.(*bgp.FlowSpecEvent), newer.(*bgp.FlowSpecEvent)); merged != nil {
+			return merged
+		}
+		return nil
+	}
+	queue.stamp = func(event interface{}, stamp bgp.EventStamp) interface{} {
+		stamped := *event.(*bgp.FlowSpecEvent)
+		stamped.Stamp = stamp
+		return &stamped
+	}
+	queue.disconnectEvent = &bgp.FlowSpecEvent{Type: bgp.WatchDisconnected}
+	return queue
+}
+
+// newPeerStateEventQueue creates deliveryQueue for peer state events that are passed to <callback>.
+func newPeerStateEventQueue(callback func(*bgp.PeerStateEvent)) *deliveryQueue {
+	queue := newDeliveryQueue(bgp.DefaultQueueSize, bgp.OverflowBlock, func(event interface{}) {
+		callback(event.(*bgp.PeerStateEvent))
+	})
+	queue.stamp = func(event interface{}, stamp bgp.EventStamp) interface{} {
+		stamped := *event.(*bgp.PeerStateEvent)
+		stamped.Stamp = stamp
+		return &stamped
+	}
+	return queue
+}
+
+// push adds <event> to the queue applying overflow policy if the queue is full. Events pushed to closed queue are ignored.
+func (queue *deliveryQueue) push(event interface{}) {
+	queue.Lock()
+	disconnected := false
+	for !queue.closed && len(queue.events) >= queue.size {
+		if queue.policy == bgp.OverflowCoalesce && queue.coalesce(event) {
+			queue.Unlock()
+			return
+		}
+		if queue.policy == bgp.OverflowDropOldest {
+			queue.remove(0)
+			queue.stats.Dropped++
+			queue.sequence++ // dropped event leaves gap in sequence numbers
+		} else if queue.policy == bgp.OverflowDisconnect {
+			queue.stats.Dropped += uint64(len(queue.events)) + 1
+			queue.sequence += uint64(len(queue.events)) + 1
+			queue.disconnect()
+			disconnected = true
+		} else {
+			queue.changed.Wait()
+		}
+	}
+	if !queue.closed {
+		queue.append(event)
+	}
+	queue.Unlock()
+
+	if disconnected && queue.onDisconnect != nil {
+		queue.onDisconnect()
+	}
+}
+
+// pushAll adds all <events> to the queue regardless of its size (used for RIB snapshots, that must not be blocked by watcher).
+func (queue *deliveryQueue) pushAll(events []interface{}) {
+	queue.Lock()
+	defer queue.Unlock()
+	if queue.closed {
+		return
+	}
+	for _, event := range events {
+		queue.append(event)
+	}
+	queue.seal()
+}
+
+// coalesce merges <event> into queued event with the same coalescing key. It returns false if there is no such event.
+func (queue *deliveryQueue) coalesce(event interface{}) bool {
+	key := queue.key(event)
+	older, found := queue.pending[key]
+	if key == "" || !found {
+		return false
+	}
+	queue.stats.Coalesced++
+	older.stamp = queue.newStamp()
+	if older.event = queue.merge(older.event, event); older.event == nil {
+		for i, queued := range queue.events {
+			if queued == older {
+				queue.remove(i)
+				break
+			}
+		}
+	}
+	return true
+}
+
+// append adds <event> to the end of the queue. Caller must hold the queue lock.
+func (queue *deliveryQueue) append(event interface{}) {
+	queued := &queuedEvent{event: event, key: queue.key(event), stamp: queue.newStamp()}
+	queue.events = append(queue.events, queued)
+	if queued.key != "" {
+		queue.pending[queued.key] = queued
+	}
+	queue.changed.Broadcast()
+}
+
+// newStamp returns stamp of event emitted now (without sequence number that is assigned on delivery).
+func (queue *deliveryQueue) newStamp() bgp.EventStamp {
+	stamp := bgp.EventStamp{Timestamp: time.Now()}
+	if queue.epoch != nil {
+		stamp.Epoch = queue.epoch()
+	}
+	return stamp
+}
+
+// stamped assigns the next sequence number to <queued> event and returns the event stamped for delivery.
+// Caller must hold the queue lock.
+func (queue *deliveryQueue) stamped(queued *queuedEvent) interface{} {
+	queue.sequence++
+	queued.stamp.Sequence = queue.sequence
+	if queue.stamp == nil {
+		return queued.event
+	}
+	return queue.stamp(queued.event, queued.stamp)
+}
+
+// remove removes i-th event from the queue. Caller must hold the queue lock.
+func (queue *deliveryQueue) remove(i int) {
+	queued := queue.events[i]
+	if i == 0 {
+		queue.events[0] = nil // the oldest event is removed by reslicing, so that large snapshots are not copied for each event
+		queue.events = queue.events[1:]
+	} else {
+		queue.events = append(queue.events[:i], queue.events[i+1:]...)
+	}
+	if queue.pending[queued.key] == queued {
+		delete(queue.pending, queued.key)
+	}
+	if i < queue.sealed {
+		queue.sealed--
+	}
+	queue.changed.Broadcast()
+}
+
+// disconnect closes the queue due to overflow. All queued events are dropped and only disconnect event is left to be delivered.
+// Caller must hold the queue lock.
+func (queue *deliveryQueue) disconnect() {
+	queue.events = nil
+	queue.pending = map[string]*queuedEvent{}
+	if queue.disconnectEvent != nil {
+		queue.events = append(queue.events, &queuedEvent{event: queue.disconnectEvent})
+	}
+	queue.sealed = len(queue.events)
+	queue.closed = true
+	queue.changed.Broadcast()
+}
+
+// end disconnects the queue regardless of its size (i.e. because watched VRF was deleted). All queued events are dropped
+// and only disconnect event is left to be delivered.
+func (queue *deliveryQueue) end() {
+	queue.Lock()
+	defer queue.Unlock()
+	if queue.closed {
+		return
+	}
+	queue.stats.Dropped += uint64(len(queue.events))
+	queue.sequence += uint64(len(queue.events))
+	queue.disconnect()
+}
+
+// close closes the queue and drops all queued events. Goroutine of the queue ends after delivery of event that is
+// currently being delivered (close doesn't wait for it, so it can be called also from watcher's callback).
+func (queue *deliveryQueue) close() {
+	queue.Lock()
+	defer queue.Unlock()
+	if queue.closed {
+		return
+	}
+	queue.events = nil
+	queue.pending = map[string]*queuedEvent{}
+	queue.sealed = 0
+	queue.closed = true
+	queue.changed.Broadcast()
+}
+
+// statistics returns current delivery statistics of the queue.
+func (queue *deliveryQueue) statistics() bgp.WatchStats {
+	queue.Lock()
+	defer queue.Unlock()
+	stats := queue.stats
+	stats.Queued = len(queue.events)
+	return stats
+}
+
+// run passes queued events to watcher one by one until the queue is closed and empty.
+func (queue *deliveryQueue) run() {
+	for {
+		queue.Lock()
+		for len(queue.events) == 0 && !queue.closed {
+			queue.changed.Wait()
+		}
+		if len(queue.events) == 0 {
+			queue.Unlock()
+			return
+		}
+		queued := queue.events[0]
+		queue.remove(0)
+		event := queue.stamped(queued)
+		queue.Unlock()
+
+		queue.deliver(event)
+
+		queue.Lock()
+		queue.stats.Delivered++
+		queue.Unlock()
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	. "github.com/onsi/gomega"
+	"testing"
+	"time"
+)
+
+// TestDeliveryQueueDropOldest tests that full queue with drop-oldest policy drops the oldest waiting events and counts them.
+func TestDeliveryQueueDropOldest(x *testing.T) {
+	RegisterTestingT(x)
+	queue, delivered, release := blockedQueue(2, bgp.OverflowDropOldest)
+	for _, event := range []string{"e2", "e3", "e4", "e5"} {
+		queue.push(event)
+	}
+	Expect(queue.statistics()).To(Equal(bgp.WatchStats{Queued: 2, Dropped: 2}))
+
+	close(release)
+	Expect(receiveAll(delivered, 3)).To(Equal([]interface{}{"e1", "e4", "e5"}))
+}
+
+// TestDeliveryQueueCoalesce tests that full queue with coalesce policy merges route events of the same prefix and removes
+// events that cancel each other.
+func TestDeliveryQueueCoalesce(x *testing.T) {
+	RegisterTestingT(x)
+	options := bgp.NewWatchOptions(bgp.WithQueue(2, bgp.OverflowCoalesce))
+	delivered := make(chan interface{}, 10)
+	release := make(chan struct{})
+	queue := newRouteEventQueue(options, func(event *bgp.RouteEvent) {
+		<-release
+		delivered <- event
+	})
+	first := &bgp.RouteEvent{Type: bgp.RIBSnapshotEnd}
+	queue.push(first)
+	Eventually(func() int { return queue.statistics().Queued }).Should(BeZero()) // first event is being delivered
+
+	route1 := &bgp.ReachableIPRoute{Prefix: "10.0.0.0/24"}
+	route1Updated := &bgp.ReachableIPRoute{Prefix: "10.0.0.0/24", As: 65001}
+	route2 := &bgp.ReachableIPRoute{Prefix: "10.0.1.0/24"}
+	queue.push(&bgp.RouteEvent{Type: bgp.RouteAdded, Route: route1})
+	queue.push(&bgp.RouteEvent{Type: bgp.RouteAdded, Route: route2})
+	queue.push(&bgp.RouteEvent{Type: bgp.RouteUpdated, Route: route1Updated, PreviousRoute: route1})
+	queue.push(&bgp.RouteEvent{Type: bgp.RouteWithdrawn, Route: route2, PreviousRoute: route2})
+	Expect(queue.statistics()).To(Equal(bgp.WatchStats{Queued: 1, Coalesced: 2}))
+
+	close(release)
+	events := receiveAll(delivered, 2)
+	Expect(events).To(HaveLen(2))
+	for i, event := range events {
+		Expect(event.(*bgp.RouteEvent).Stamp.Sequence).To(Equal(uint64(i + 1))) // merged events leave no gap
+		event.(*bgp.RouteEvent).Stamp = bgp.EventStamp{}
+	}
+	Expect(events).To(Equal([]interface{}{first, &bgp.RouteEvent{Type: bgp.RouteAdded, Route: route1Updated}}))
+}
+
+// TestDeliveryQueueDisconnect tests that full queue with disconnect policy drops all waiting events, delivers disconnect
+// event as the last event and reports the disconnection.
+func TestDeliveryQueueDisconnect(x *testing.T) {
+	RegisterTestingT(x)
+	queue, delivered, release := blockedQueue(1, bgp.OverflowDisconnect)
+	queue.disconnectEvent = "disconnected"
+	disconnected := make(chan struct{})
+	queue.onDisconnect = func() { close(disconnected) }
+	queue.push("e2")
+	queue.push("e3")
+	queue.push("e4") // ignored, queue is already closed
+	Eventually(disconnected).Should(BeClosed())
+	Expect(queue.statistics()).To(Equal(bgp.WatchStats{Queued: 1, Dropped: 2}))
+
+	close(release)
+	Expect(receiveAll(delivered, 2)).To(Equal([]interface{}{"e1", "disconnected"}))
+	Consistently(delivered).ShouldNot(Receive())
+}
+
+// TestDeliveryQueueBlock tests that full queue with block policy blocks pushing of events until there is free space again.
+func TestDeliveryQueueBlock(x *testing.T) {
+	RegisterTestingT(x)
+	queue, delivered, release := blockedQueue(1, bgp.OverflowBlock)
+	queue.push("e2")
+	pushed := make(chan struct{})
+	go func() {
+		queue.push("e3")
+		close(pushed)
+	}()
+	Consistently(pushed).ShouldNot(BeClosed())
+
+	close(release)
+	Eventually(pushed).Should(BeClosed())
+	Expect(receiveAll(delivered, 3)).To(Equal([]interface{}{"e1", "e2", "e3"}))
+	Expect(queue.statistics()).To(Equal(bgp.WatchStats{Delivered: 3}))
+}
+
+// blockedQueue creates deliveryQueue of given <size> and <policy> whose delivery is blocked until <release> channel
+// is closed. Event "e1" is already taken from the queue (it is being delivered), delivered events are sent to <delivered> channel.
+func blockedQueue(size int, policy bgp.OverflowPolicy) (queue *deliveryQueue, delivered chan interface{}, release chan struct{}) {
+	delivered = make(chan interface{}, 10)
+	release = make(chan struct{})
+	queue = newDeliveryQueue(size, policy, func(event interface{}) {
+		<-release
+		delivered <- event
+	})
+	queue.push("e1")
+	Eventually(func() int { return queue.statistics().Queued }).Should(BeZero())
+	return queue, delivered, release
+}
+
+// receiveAll receives <count> events from <delivered> channel.
+func receiveAll(delivered chan interface{}, count int) []interface{} {
+	events := make([]interface{}, 0, count)
+	for i := 0; i < count; i++ {
+		select {
+		case event := <-delivered:
+			events = append(events, event)
+		case <-time.After(time.Second):
+			return events
+		}
+	}
+	return events
+}
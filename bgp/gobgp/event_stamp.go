@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	"sync/atomic"
+)
+
+// currentEpoch returns current session epoch of plugin (see bgp.EventStamp).
+func (plugin *Plugin) currentEpoch() uint64 {
+	return atomic.LoadUint64(&plugin.epoch)
+}
+
+// RequestSnapshot sends all currently known routes to route, EVPN and FlowSpec watchers registered under the name <watcher>
+// enclosed in bgp.ResyncStart and bgp.ResyncEnd markers, i.e. after the watcher detected gap in sequence numbers
+// of received events (see bgp.EventStamp). Snapshot is queued after events that wait for delivery to the watcher.
+// It fails with bgp.UnknownWatcherError if there is no such watcher.
+func (plugin *Plugin) RequestSnapshot(watcher string) error {
+	found := false
+	plugin.routesMu.Lock()
+	if registered, registeredFound := plugin.routeWatchers[watcherName(watcher)]; registeredFound {
+		plugin.sendRIBSnapshot(registered, resyncStartEnd)
+		found = true
+	}
+	plugin.routesMu.Unlock()
+
+	plugin.evpnMu.Lock()
+	if registered, registeredFound := plugin.evpnWatchers[watcherName(watcher)]; registeredFound {
+		plugin.sendEVPNSnapshot(registered, resyncStartEnd)
+		found = true
+	}
+	plugin.evpnMu.Unlock()
+
+	plugin.flowSpecMu.Lock()
+	if registered, registeredFound := plugin.flowSpecWatchers[watcherName(watcher)]; registeredFound {
+		plugin.sendFlowSpecSnapshot(registered, resyncStartEnd)
+		found = true
+	}
+	plugin.flowSpecMu.Unlock()
+
+	if !found {
+		return &bgp.UnknownWatcherError{Watcher: watcher}
+	}
+	plugin.Log.Infof("Watcher %s requested snapshot", watcher)
+	return nil
+}
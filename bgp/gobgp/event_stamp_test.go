@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	"github.com/ligato/cn-infra/flavors/local"
+	. "github.com/onsi/gomega"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestEventStamping tests that events sent to watchers are stamped by consecutive sequence numbers, session epoch
+// and time of emission and that the epoch changes when watchers are resynchronized.
+func TestEventStamping(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, events := pluginWithEventWatcher()
+	peerStates := make(chan bgp.PeerStateEvent, 10)
+	_, err := plugin.WatchPeerState("TestPeerStateWatcher", func(event *bgp.PeerStateEvent) {
+		peerStates <- *event
+	})
+	Expect(err).To(BeNil())
+	peer := net.ParseIP("10.0.0.1")
+	epoch := plugin.currentEpoch()
+	emittedAfter := time.Now()
+
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ESTABLISHED})
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.9.1.0", false),
+		peerPath("10.0.0.1", "10.9.2.0", false),
+	}})
+	var previous bgp.EventStamp
+	for i := 1; i <= 2; i++ {
+		stamp := receiveRouteEvent(events).Stamp
+		Expect(stamp.Sequence).To(Equal(uint64(i)))
+		Expect(stamp.Follows(previous)).To(BeTrue())
+		Expect(stamp.Epoch).To(Equal(epoch))
+		Expect(stamp.Timestamp).To(BeTemporally(">=", emittedAfter))
+		previous = stamp
+	}
+	var peerState bgp.PeerStateEvent
+	Eventually(peerStates).Should(Receive(&peerState))
+	Expect(peerState.Stamp.Sequence).To(Equal(uint64(1)))
+	Expect(peerState.Stamp.Epoch).To(Equal(epoch))
+
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ACTIVE})
+	for i := 0; i < 2; i++ {
+		Expect(receiveRouteEvent(events).Stamp.Epoch).To(Equal(epoch)) // stale routes of restarting peer
+	}
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ESTABLISHED})
+	resyncStart := receiveRouteEvent(events)
+	Expect(resyncStart.Type).To(Equal(bgp.ResyncStart))
+	Expect(resyncStart.Stamp.Sequence).To(Equal(uint64(5)))
+	Expect(resyncStart.Stamp.Epoch).To(BeNumerically(">", epoch))
+}
+
+// TestSnapshotRequestAfterGap tests that events dropped due to full queue leave gap in sequence numbers and that watcher
+// can re-request snapshot after it detected the gap.
+func TestSnapshotRequestAfterGap(x *testing.T) {
+	RegisterTestingT(x)
+	flavor := &local.FlavorLocal{}
+	plugin := New(Deps{PluginInfraDeps: *flavor.InfraDeps("TestGoBGP")})
+	events := make(chan bgp.RouteEvent, 10)
+	release := make(chan struct{})
+	_, err := plugin.WatchIPRouteEvents("TestSlowWatcher", func(event *bgp.RouteEvent) {
+		<-release
+		events <- *event
+	}, bgp.WithQueue(1, bgp.OverflowDropOldest))
+	Expect(err).To(BeNil())
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{peerPath("10.0.0.1", "10.9.1.0", false)}})
+	Eventually(func() int { return plugin.routeWatchers["TestSlowWatcher"].queue.statistics().Queued }).Should(BeZero())
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.9.2.0", false),
+		peerPath("10.0.0.1", "10.9.3.0", false),
+	}})
+	close(release)
+	first := receiveRouteEvent(events)
+	Expect(first.Route.Prefix).To(Equal("10.9.1.0/24"))
+	last := receiveRouteEvent(events)
+	Expect(last.Route.Prefix).To(Equal("10.9.3.0/24"))
+	Expect(last.Stamp.Follows(first.Stamp)).To(BeFalse())
+
+	Expect(plugin.RequestSnapshot("TestSlowWatcher")).To(BeNil())
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.ResyncStart))
+	for _, prefix := range []string{"10.9.1.0/24", "10.9.2.0/24", "10.9.3.0/24"} {
+		Expect(receiveRouteEvent(events).Route.Prefix).To(Equal(prefix))
+	}
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.ResyncEnd))
+
+	err = plugin.RequestSnapshot("TestUnknownWatcher")
+	Expect(err).To(BeAssignableToTypeOf(&bgp.UnknownWatcherError{}))
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"fmt"
+	"github.com/ligato/bgp-agent/bgp"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/table"
+	"net"
+	"sort"
+)
+
+// evpnWatcher is registered EVPN watcher. EVPN events are queued for delivery to watcher's callback.
+type evpnWatcher struct {
+	registrationInfo
+	queue *deliveryQueue
+}
+
+// processEVPNPath translates best path change of EVPN route from goBGP server into bgp.EVPNEvent and queues it for all
+// registered EVPN watchers. Paths of EVPN route types other than 2, 3 and 5 are ignored.
+func (plugin *Plugin) processEVPNPath(path *table.Path) {
+	route := toEVPNRoute(path)
+	if route == nil {
+		plugin.Log.Debugf("Ignoring EVPN path of unsupported route type %v", path.GetNlri())
+		return
+	}
+	key := evpnRouteKey(route)
+
+	plugin.evpnMu.Lock()
+	event := plugin.toEVPNEvent(key, route, path.IsWithdraw)
+	queues := make([]*deliveryQueue, 0, len(plugin.evpnWatchers))
+	for _, watcher := range plugin.evpnWatchers {
+		queues = append(queues, watcher.queue)
+	}
+	plugin.evpnMu.Unlock()
+
+	if event == nil {
+		plugin.Log.Debugf("Ignoring withdrawal of unknown EVPN route %s", key)
+		return
+	}
+	plugin.Log.Debugf("Sending %v EVPN event for %s", event.Type, key)
+	for _, queue := range queues {
+		queue.push(event)
+	}
+}
+
+// toEVPNEvent classifies best path change for EVPN <route> (identified by <key>) against last known best EVPN routes
+// and updates them accordingly. Path withdrawal is signalled by <isWithdraw>. Nil is returned for withdrawal of route
+// that was never announced. Caller must hold evpnMu.
+func (plugin *Plugin) toEVPNEvent(key string, route *bgp.EVPNRoute, isWithdraw bool) *bgp.EVPNEvent {
+	previous, known := plugin.evpnRoutes[key]
+	if isWithdraw {
+		if !known {
+			return nil
+		}
+		delete(plugin.evpnRoutes, key)
+		return &bgp.EVPNEvent{Type: bgp.RouteWithdrawn, Route: route, PreviousRoute: previous}
+	}
+	plugin.evpnRoutes[key] = route
+	if !known {
+		return &bgp.EVPNEvent{Type: bgp.RouteAdded, Route: route}
+	}
+	return &bgp.EVPNEvent{Type: bgp.RouteUpdated, Route: route, PreviousRoute: previous}
+}
+
+// evpnRouteKey identifies EVPN route by the fields of its NLRI (route type, route distinguisher, Ethernet tag and MAC/IP
+// address or IP prefix).
+func evpnRouteKey(route *bgp.EVPNRoute) string {
+	return fmt.Sprintf("%d|%s|%d|%s|%s|%s", route.Type, route.RouteDistinguisher, route.EthernetTag, route.MAC, route.IP, route.Prefix)
+}
+
+// toEVPNRoute translates goBGP path of EVPN route into bgp.EVPNRoute. Nil is returned for other paths and for paths
+// of EVPN route types other than 2, 3 and 5.
+func toEVPNRoute(path *table.Path) *bgp.EVPNRoute {
+	nlri, ok := path.GetNlri().(*bgpPacket.EVPNNLRI)
+	if !ok {
+		return nil
+	}
+	route := &bgp.EVPNRoute{
+		Type:         bgp.EVPNRouteType(nlri.RouteType),
+		VTEP:         path.GetNexthop(),
+		RouteTargets: toRouteTargets(path.GetExtCommunities()),
+		AsPath:       toAsPath(path.GetAsPath()),
+		Attributes:   toPathAttributes(path),
+	}
+	if rd := nlri.RD(); rd != nil {
+		route.RouteDistinguisher = rd.String()
+	}
+	switch data := nlri.RouteTypeData.(type) {
+	case *bgpPacket.EVPNMacIPAdvertisementRoute:
+		route.ESI = toEthernetSegmentID(data.ESI)
+		route.EthernetTag = data.ETag
+		route.MAC = data.MacAddress
+		if len(data.IPAddress) > 0 {
+			route.IP = data.IPAddress
+		}
+		if len(data.Labels) > 0 {
+			route.VNI = data.Labels[0]
+		}
+		if len(data.Labels) > 1 {
+			route.L3VNI = data.Labels[1]
+		}
+	case *bgpPacket.EVPNMulticastEthernetTagRoute:
+		route.EthernetTag = data.ETag
+		route.IP = data.IPAddress
+		setPmsiTunnel(route, path)
+	case *bgpPacket.EVPNIPPrefixRoute:
+		route.ESI = toEthernetSegmentID(data.ESI)
+		route.EthernetTag = data.ETag
+		route.Prefix = toPrefix(data.IPPrefix, data.IPPrefixLength)
+		if len(data.GWIPAddress) > 0 && !data.GWIPAddress.IsUnspecified() {
+			route.GatewayIP = data.GWIPAddress
+		}
+		route.VNI = data.Label
+	default:
+		return nil
+	}
+	for _, community := range route.Attributes.ExtendedCommunities {
+		if mac, ok := community.RouterMAC(); ok {
+			route.RouterMAC = mac
+			break
+		}
+	}
+	return route
+}
+
+// setPmsiTunnel fills VNI and VTEP of inclusive multicast EVPN <route> from PMSI tunnel attribute of <path> (RFC 6514).
+// Tunnel endpoint is taken only from ingress replication tunnels, VTEP of other routes stays the next hop of the path.
+func setPmsiTunnel(route *bgp.EVPNRoute, path *table.Path) {
+	for _, attr := range path.GetPathAttrs() {
+		pmsi, ok := attr.(*bgpPacket.PathAttributePmsiTunnel)
+		if !ok {
+			continue
+		}
+		route.VNI = pmsi.Label
+		if tunnel, ok := pmsi.TunnelID.(*bgpPacket.IngressReplTunnelID); ok && len(tunnel.Value) > 0 {
+			route.VTEP = tunnel.Value
+		}
+		return
+	}
+}
+
+// toEthernetSegmentID translates goBGP Ethernet segment identifier into bgp.EthernetSegmentID.
+func toEthernetSegmentID(esi bgpPacket.EthernetSegmentIdentifier) bgp.EthernetSegmentID {
+	var id bgp.EthernetSegmentID
+	id[0] = byte(esi.Type)
+	copy(id[1:], esi.Value)
+	return id
+}
+
+// toPrefix creates prefix in CIDR notation from IP address <ip> and prefix <length>.
+func toPrefix(ip net.IP, length uint8) string {
+	bits := 8 * net.IPv6len
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip, bits = ipv4, 8*net.IPv4len
+	}
+	mask := net.CIDRMask(int(length), bits)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+// WatchEVPNRoutes register watcher to notifications for any change of EVPN routes (MAC/IP advertisement, inclusive multicast
+// and IP prefix routes). Registration semantics are the same as for WatchIPRouteEvents, names of EVPN watchers are independent
+// of names of route and peer state watchers. Only bgp.WithRIBSnapshot() and bgp.WithQueue() options are applied. Snapshot
+// contains all currently known EVPN routes (followed by bgp.RIBSnapshotEnd event).
+func (plugin *Plugin) WatchEVPNRoutes(watcher string, callback func(*bgp.EVPNEvent), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	if callback == nil {
+		return nil, bgp.ErrNilCallback
+	}
+	plugin.Log.Infof("Watcher %s registering for watching of EVPN routes in %s.", watcher, plugin.PluginName)
+	options := bgp.NewWatchOptions(opts...)
+
+	plugin.evpnMu.Lock()
+	defer plugin.evpnMu.Unlock()
+	if _, found := plugin.evpnWatchers[watcherName(watcher)]; found {
+		return nil, &bgp.DuplicateWatcherError{Watcher: watcher}
+	}
+	registered := &evpnWatcher{
+		registrationInfo: plugin.newRegistrationInfo(),
+		queue:            newEVPNEventQueue(options, callback),
+	}
+	registration := &evpnRegistration{watcher: watcherName(watcher), plugin: plugin, registered: registered}
+	registered.queue.epoch = plugin.currentEpoch
+	registered.queue.onDisconnect = func() {
+		plugin.Log.Warnf("EVPN watcher %s disconnected, because it didn't keep up with route changes", watcher)
+		registration.Close()
+	}
+	if options.RIBSnapshot {
+		plugin.sendEVPNSnapshot(registered, snapshotEnd)
+	}
+	plugin.evpnWatchers[watcherName(watcher)] = registered
+	return registration, nil
+}
+
+// sendEVPNSnapshot queues all currently known EVPN routes (ordered by their key) as bgp.RouteAdded events for <watcher>
+// and marks the end of snapshot by bgp.RIBSnapshotEnd event. Snapshot sent for resynchronization of watcher is enclosed
+// in bgp.ResyncStart and bgp.ResyncEnd <markers> instead. Caller must hold evpnMu.
+func (plugin *Plugin) sendEVPNSnapshot(watcher *evpnWatcher, markers snapshotMarkers) {
+	keys := make([]string, 0, len(plugin.evpnRoutes))
+	for key := range plugin.evpnRoutes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	events := make([]interface{}, 0, len(keys)+2)
+	if markers != snapshotEnd {
+		events = append(events, &bgp.EVPNEvent{Type: bgp.ResyncStart})
+	}
+	for _, key := range keys {
+		events = append(events, &bgp.EVPNEvent{Type: bgp.RouteAdded, Route: plugin.evpnRoutes[key]})
+	}
+	switch markers {
+	case snapshotEnd:
+		events = append(events, &bgp.EVPNEvent{Type: bgp.RIBSnapshotEnd})
+	case resyncStartEnd:
+		events = append(events, &bgp.EVPNEvent{Type: bgp.ResyncEnd})
+	}
+	watcher.queue.pushAll(events)
+}
+
+// evpnRegistration is Plugin's WatchRegistration implementation for EVPN watchers.
+type evpnRegistration struct {
+	watcher    watcherName
+	plugin     *Plugin
+	registered *evpnWatcher
+}
+
+// ID returns unique identification of the registration.
+func (er *evpnRegistration) ID() uint64 {
+	return er.registered.id
+}
+
+// Close ends the agreement between Plugin and EVPN watcher. Plugin stops sending watcher any further notifications.
+// Repeated Close does nothing and Close never unregisters newer registration of watcher with the same name.
+func (er *evpnRegistration) Close() error {
+	er.plugin.evpnMu.Lock()
+	defer er.plugin.evpnMu.Unlock()
+	if er.plugin.evpnWatchers[er.watcher] == er.registered {
+		delete(er.plugin.evpnWatchers, er.watcher)
+	}
+	er.registered.queue.close()
+	return nil
+}
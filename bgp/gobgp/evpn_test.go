@@ -0,0 +1,152 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	. "github.com/onsi/gomega"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestEVPNRouteWatching tests that EVPN routes of types 2, 3 and 5 are translated into typed EVPN events (with VNI,
+// router MAC and VTEP), that they are sent only to EVPN watchers and that late EVPN watchers receive snapshot of them.
+func TestEVPNRouteWatching(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, routeEvents := pluginWithEventWatcher()
+	events := make(chan bgp.EVPNEvent, 10)
+	_, err := plugin.WatchEVPNRoutes("TestEVPNWatcher", func(event *bgp.EVPNEvent) {
+		events <- *event
+	})
+	Expect(err).To(BeNil())
+	_, err = plugin.WatchEVPNRoutes("TestEVPNWatcher", func(event *bgp.EVPNEvent) {})
+	Expect(err).To(BeAssignableToTypeOf(&bgp.DuplicateWatcherError{}))
+
+	routerMAC, _ := net.ParseMAC("00:00:5e:00:53:01")
+	macIPRoute := &bgpPacket.EVPNMacIPAdvertisementRoute{
+		RD:               evpnRouteDistinguisher(),
+		ESI:              bgpPacket.EthernetSegmentIdentifier{Type: bgpPacket.ESI_ARBITRARY, Value: make([]byte, 9)},
+		MacAddressLength: 48,
+		MacAddress:       net.HardwareAddr{0x02, 0x42, 0xac, 0x11, 0x00, 0x02},
+		IPAddressLength:  32,
+		IPAddress:        net.ParseIP("10.3.0.2").To4(),
+		Labels:           []uint32{10100, 50000},
+	}
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		evpnPath(bgpPacket.EVPN_ROUTE_TYPE_MAC_IP_ADVERTISEMENT, macIPRoute, false, routerMACCommunity(routerMAC)),
+	}})
+	event := receiveEVPNEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Type).To(Equal(bgp.EVPNMacIPAdvertisement))
+	Expect(event.Route.RouteDistinguisher).To(Equal("65000:10"))
+	Expect(event.Route.ESI.IsZero()).To(BeTrue())
+	Expect(event.Route.MAC.String()).To(Equal("02:42:ac:11:00:02"))
+	Expect(event.Route.IP.String()).To(Equal("10.3.0.2"))
+	Expect(event.Route.VNI).To(Equal(uint32(10100)))
+	Expect(event.Route.L3VNI).To(Equal(uint32(50000)))
+	Expect(event.Route.RouterMAC).To(Equal(routerMAC))
+	Expect(event.Route.VTEP.String()).To(Equal("192.168.0.2"))
+	Expect(event.Route.RouteTargets).To(Equal([]string{"65000:100"}))
+
+	multicastRoute := &bgpPacket.EVPNMulticastEthernetTagRoute{
+		RD:              evpnRouteDistinguisher(),
+		IPAddressLength: 32,
+		IPAddress:       net.ParseIP("192.168.0.2").To4(),
+	}
+	pmsiTunnel := bgpPacket.NewPathAttributePmsiTunnel(bgpPacket.PMSI_TUNNEL_TYPE_INGRESS_REPL, false, 10100,
+		&bgpPacket.IngressReplTunnelID{Value: net.ParseIP("192.168.0.3").To4()})
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		evpnPath(bgpPacket.EVPN_INCLUSIVE_MULTICAST_ETHERNET_TAG, multicastRoute, false, pmsiTunnel),
+	}})
+	event = receiveEVPNEvent(events)
+	Expect(event.Route.Type).To(Equal(bgp.EVPNInclusiveMulticast))
+	Expect(event.Route.IP.String()).To(Equal("192.168.0.2"))
+	Expect(event.Route.VNI).To(Equal(uint32(10100)))
+	Expect(event.Route.VTEP.String()).To(Equal("192.168.0.3"))
+	Expect(event.Route.RouterMAC).To(BeNil())
+
+	prefixRoute := &bgpPacket.EVPNIPPrefixRoute{
+		RD:             evpnRouteDistinguisher(),
+		ESI:            bgpPacket.EthernetSegmentIdentifier{Type: bgpPacket.ESI_ARBITRARY, Value: make([]byte, 9)},
+		IPPrefixLength: 24,
+		IPPrefix:       net.ParseIP("10.4.0.0").To4(),
+		GWIPAddress:    net.IPv4zero.To4(),
+		Label:          50000,
+	}
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		evpnPath(bgpPacket.EVPN_IP_PREFIX, prefixRoute, false, routerMACCommunity(routerMAC)),
+	}})
+	event = receiveEVPNEvent(events)
+	Expect(event.Route.Type).To(Equal(bgp.EVPNIPPrefix))
+	Expect(event.Route.Prefix).To(Equal("10.4.0.0/24"))
+	Expect(event.Route.GatewayIP).To(BeNil())
+	Expect(event.Route.VNI).To(Equal(uint32(50000)))
+	Expect(event.Route.RouterMAC).To(Equal(routerMAC))
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		evpnPath(bgpPacket.EVPN_ROUTE_TYPE_MAC_IP_ADVERTISEMENT, macIPRoute, true),
+	}})
+	event = receiveEVPNEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteWithdrawn))
+	Expect(event.PreviousRoute.MAC.String()).To(Equal("02:42:ac:11:00:02"))
+	Consistently(routeEvents, 100*time.Millisecond).ShouldNot(Receive())
+
+	lateEvents := make(chan bgp.EVPNEvent, 10)
+	_, err = plugin.WatchEVPNRoutes("TestLateEVPNWatcher", func(event *bgp.EVPNEvent) {
+		lateEvents <- *event
+	}, bgp.WithRIBSnapshot())
+	Expect(err).To(BeNil())
+	Expect(receiveEVPNEvent(lateEvents).Type).To(Equal(bgp.RouteAdded))
+	Expect(receiveEVPNEvent(lateEvents).Type).To(Equal(bgp.RouteAdded))
+	Expect(receiveEVPNEvent(lateEvents).Type).To(Equal(bgp.RIBSnapshotEnd))
+	Expect(plugin.ListWatchers()).To(HaveLen(3))
+}
+
+// evpnRouteDistinguisher returns route distinguisher 65000:10 of EVPN routes used in tests.
+func evpnRouteDistinguisher() bgpPacket.RouteDistinguisherInterface {
+	rd, _ := bgpPacket.ParseRouteDistinguisher("65000:10")
+	return rd
+}
+
+// routerMACCommunity creates path attribute with route target 65000:100 and router's MAC extended community carrying <mac>.
+// goBGP can't decode router's MAC community, so it is created as unknown extended community with the same encoding.
+func routerMACCommunity(mac net.HardwareAddr) bgpPacket.PathAttributeInterface {
+	rt, _ := bgpPacket.ParseRouteTarget("65000:100")
+	return bgpPacket.NewPathAttributeExtendedCommunities([]bgpPacket.ExtendedCommunityInterface{
+		rt,
+		&bgpPacket.UnknownExtended{Type: 0x06, Value: append([]byte{0x03}, mac...)},
+	})
+}
+
+// evpnPath creates goBGP path of EVPN route of given <routeType> (with <data>) via VTEP 192.168.0.2 with additional
+// path attributes <attrs>. Path withdrawal is given by <isWithdraw>.
+func evpnPath(routeType uint8, data bgpPacket.EVPNRouteTypeInterface, isWithdraw bool, attrs ...bgpPacket.PathAttributeInterface) *table.Path {
+	nlri := bgpPacket.NewEVPNNLRI(routeType, 0, data)
+	return table.NewPath(nil, nlri, isWithdraw, append([]bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(0),
+		bgpPacket.NewPathAttributeMpReachNLRI("192.168.0.2", []bgpPacket.AddrPrefixInterface{nlri}),
+	}, attrs...), time.Now(), false)
+}
+
+// receiveEVPNEvent waits for EVPN event sent to <events> channel. If nothing comes in one second, test fails.
+func receiveEVPNEvent(events chan bgp.EVPNEvent) bgp.EVPNEvent {
+	var event bgp.EVPNEvent
+	Eventually(events, time.Second).Should(Receive(&event))
+	return event
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/table"
+	"sort"
+)
+
+// flowSpecFamilies maps goBGP route families of FlowSpec rules that can be translated into bgp.FlowSpecRule
+// to their bgp.RouteFamily.
+var flowSpecFamilies = map[bgpPacket.RouteFamily]bgp.RouteFamily{
+	bgpPacket.RF_FS_IPv4_UC: bgp.IPv4FlowSpec,
+	bgpPacket.RF_FS_IPv6_UC: bgp.IPv6FlowSpec,
+}
+
+// Operator bits of FlowSpec match component items (RFC 8955, section 4.2.1)
+const (
+	flowSpecOpAnd         = 0x40
+	flowSpecNumericOpMask = 0x07
+	flowSpecBitmaskNot    = 0x02
+	flowSpecBitmaskMatch  = 0x01
+)
+
+// flowSpecWatcher is registered FlowSpec watcher. FlowSpec events are queued for delivery to watcher's callback.
+type flowSpecWatcher struct {
+	registrationInfo
+	queue *deliveryQueue
+}
+
+// processFlowSpecPath translates best path change of FlowSpec rule from goBGP server into bgp.FlowSpecEvent and queues it
+// for all registered FlowSpec watchers.
+func (plugin *Plugin) processFlowSpecPath(path *table.Path) {
+	rule := toFlowSpecRule(path)
+	if rule == nil {
+		plugin.Log.Debugf("Ignoring unsupported FlowSpec path %v", path.GetNlri())
+		return
+	}
+	key := flowSpecRuleKey(rule)
+
+	plugin.flowSpecMu.Lock()
+	event := plugin.toFlowSpecEvent(key, rule, path.IsWithdraw)
+	queues := make([]*deliveryQueue, 0, len(plugin.flowSpecWatchers))
+	for _, watcher := range plugin.flowSpecWatchers {
+		queues = append(queues, watcher.queue)
+	}
+	plugin.flowSpecMu.Unlock()
+
+	if event == nil {
+		plugin.Log.Debugf("Ignoring withdrawal of unknown FlowSpec rule %s", key)
+		return
+	}
+	plugin.Log.Debugf("Sending %v FlowSpec event for %s", event.Type, key)
+	for _, queue := range queues {
+		queue.push(event)
+	}
+}
+
+// toFlowSpecEvent classifies best path change for FlowSpec <rule> (identified by <key>) against last known FlowSpec rules
+// and updates them accordingly. Path withdrawal is signalled by <isWithdraw>. Nil is returned for withdrawal of rule
+// that was never announced. Caller must hold flowSpecMu.
+func (plugin *Plugin) toFlowSpecEvent(key string, rule *bgp.FlowSpecRule, isWithdraw bool) *bgp.FlowSpecEvent {
+	previous, known := plugin.flowSpecRules[key]
+	if isWithdraw {
+		if !known {
+			return nil
+		}
+		delete(plugin.flowSpecRules, key)
+		return &bgp.FlowSpecEvent{Type: bgp.RouteWithdrawn, Rule: rule, PreviousRule: previous}
+	}
+	plugin.flowSpecRules[key] = rule
+	if !known {
+		return &bgp.FlowSpecEvent{Type: bgp.RouteAdded, Rule: rule}
+	}
+	return &bgp.FlowSpecEvent{Type: bgp.RouteUpdated, Rule: rule, PreviousRule: previous}
+}
+
+// flowSpecRuleKey identifies FlowSpec rule by its route family and match components.
+func flowSpecRuleKey(rule *bgp.FlowSpecRule) string {
+	return rule.Family.String() + "|" + rule.ID
+}
+
+// toFlowSpecRule translates goBGP path of IPv4 or IPv6 unicast FlowSpec rule into bgp.FlowSpecRule. Nil is returned
+// for other paths.
+func toFlowSpecRule(path *table.Path) *bgp.FlowSpecRule {
+	family, supported := flowSpecFamilies[path.GetRouteFamily()]
+	if !supported {
+		return nil
+	}
+	var components []bgpPacket.FlowSpecComponentInterface
+	switch nlri := path.GetNlri().(type) {
+	case *bgpPacket.FlowSpecIPv4Unicast:
+		components = nlri.Value
+	case *bgpPacket.FlowSpecIPv6Unicast:
+		components = nlri.Value
+	default:
+		return nil
+	}
+	rule := &bgp.FlowSpecRule{
+		Family:     family,
+		ID:         path.GetNlri().String(),
+		Actions:    toFlowSpecActions(path.GetExtCommunities()),
+		AsPath:     toAsPath(path.GetAsPath()),
+		Attributes: toPathAttributes(path),
+	}
+	for _, component := range components {
+		if !setFlowSpecComponent(rule, component) {
+			rule.UnknownComponents = append(rule.UnknownComponents, component.String())
+		}
+	}
+	return rule
+}
+
+// setFlowSpecComponent fills typed field of <rule> from match <component>. It returns false for components that have
+// no typed field in bgp.FlowSpecRule.
+func setFlowSpecComponent(rule *bgp.FlowSpecRule, component bgpPacket.FlowSpecComponentInterface) bool {
+	switch c := component.(type) {
+	case *bgpPacket.FlowSpecDestinationPrefix:
+		rule.DestinationPrefix = c.Prefix.String()
+	case *bgpPacket.FlowSpecSourcePrefix:
+		rule.SourcePrefix = c.Prefix.String()
+	case *bgpPacket.FlowSpecDestinationPrefix6:
+		if c.Offset != 0 {
+			return false
+		}
+		rule.DestinationPrefix = c.Prefix.String()
+	case *bgpPacket.FlowSpecSourcePrefix6:
+		if c.Offset != 0 {
+			return false
+		}
+		rule.SourcePrefix = c.Prefix.String()
+	case *bgpPacket.FlowSpecComponent:
+		switch c.Type() {
+		case bgpPacket.FLOW_SPEC_TYPE_IP_PROTO:
+			rule.Protocols = toNumericMatches(c.Items)
+		case bgpPacket.FLOW_SPEC_TYPE_PORT:
+			rule.Ports = toNumericMatches(c.Items)
+		case bgpPacket.FLOW_SPEC_TYPE_DST_PORT:
+			rule.DestinationPorts = toNumericMatches(c.Items)
+		case bgpPacket.FLOW_SPEC_TYPE_SRC_PORT:
+			rule.SourcePorts = toNumericMatches(c.Items)
+		case bgpPacket.FLOW_SPEC_TYPE_ICMP_TYPE:
+			rule.ICMPTypes = toNumericMatches(c.Items)
+		case bgpPacket.FLOW_SPEC_TYPE_ICMP_CODE:
+			rule.ICMPCodes = toNumericMatches(c.Items)
+		case bgpPacket.FLOW_SPEC_TYPE_TCP_FLAG:
+			rule.TCPFlags = toBitmaskMatches(c.Items)
+		case bgpPacket.FLOW_SPEC_TYPE_PKT_LEN:
+			rule.PacketLengths = toNumericMatches(c.Items)
+		case bgpPacket.FLOW_SPEC_TYPE_DSCP:
+			rule.DSCP = toNumericMatches(c.Items)
+		case bgpPacket.FLOW_SPEC_TYPE_FRAGMENT:
+			rule.Fragments = toBitmaskMatches(c.Items)
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// toNumericMatches translates items of goBGP numeric match component into bgp.NumericMatch terms.
+func toNumericMatches(items []*bgpPacket.FlowSpecComponentItem) []bgp.NumericMatch {
+	terms := make([]bgp.NumericMatch, 0, len(items))
+	for _, item := range items {
+		terms = append(terms, bgp.NumericMatch{
+			And:   item.Op&flowSpecOpAnd != 0,
+			Op:    bgp.NumericOp(item.Op & flowSpecNumericOpMask),
+			Value: uint64(item.Value),
+		})
+	}
+	return terms
+}
+
+// toBitmaskMatches translates items of goBGP bitmask match component into bgp.BitmaskMatch terms.
+func toBitmaskMatches(items []*bgpPacket.FlowSpecComponentItem) []bgp.BitmaskMatch {
+	terms := make([]bgp.BitmaskMatch, 0, len(items))
+	for _, item := range items {
+		terms = append(terms, bgp.BitmaskMatch{
+			And:   item.Op&flowSpecOpAnd != 0,
+			Not:   item.Op&flowSpecBitmaskNot != 0,
+			Match: item.Op&flowSpecBitmaskMatch != 0,
+			Value: uint64(item.Value),
+		})
+	}
+	return terms
+}
+
+// toFlowSpecActions translates FlowSpec action extended communities (traffic-rate, redirect and traffic-marking)
+// from <communities> into bgp.FlowSpecActions. Other extended communities are skipped.
+func toFlowSpecActions(communities []bgpPacket.ExtendedCommunityInterface) bgp.FlowSpecActions {
+	var actions bgp.FlowSpecActions
+	for _, community := range communities {
+		switch c := community.(type) {
+		case *bgpPacket.TrafficRateExtended:
+			actions.TrafficRate = &bgp.TrafficRate{As: c.AS, Rate: c.Rate}
+		case *bgpPacket.RedirectTwoOctetAsSpecificExtended:
+			actions.Redirect = c.TwoOctetAsSpecificExtended.String()
+		case *bgpPacket.RedirectIPv4AddressSpecificExtended:
+			actions.Redirect = c.IPv4AddressSpecificExtended.String()
+		case *bgpPacket.RedirectFourOctetAsSpecificExtended:
+			actions.Redirect = c.FourOctetAsSpecificExtended.String()
+		case *bgpPacket.RedirectIPv6AddressSpecificExtended:
+			actions.Redirect = c.IPv6AddressSpecificExtended.String()
+		case *bgpPacket.TrafficRemarkExtended:
+			dscp := c.DSCP
+			actions.Mark = &dscp
+		}
+	}
+	return actions
+}
+
+// WatchFlowSpec register watcher to notifications for any change of IPv4 and IPv6 FlowSpec rules (including withdrawals).
+// Registration semantics are the same as for WatchIPRouteEvents, names of FlowSpec watchers are independent of names
+// of other watchers. Only bgp.WithRIBSnapshot() and bgp.WithQueue() options are applied. Snapshot contains all currently
+// known FlowSpec rules (followed by bgp.RIBSnapshotEnd event).
+func (plugin *Plugin) WatchFlowSpec(watcher string, callback func(*bgp.FlowSpecEvent), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	if callback == nil {
+		return nil, bgp.ErrNilCallback
+	}
+	plugin.Log.Infof("Watcher %s registering for watching of FlowSpec rules in %s.", watcher, plugin.PluginName)
+	options := bgp.NewWatchOptions(opts...)
+
+	plugin.flowSpecMu.Lock()
+	defer plugin.flowSpecMu.Unlock()
+	if _, found := plugin.flowSpecWatchers[watcherName(watcher)]; found {
+		return nil, &bgp.DuplicateWatcherError{Watcher: watcher}
+	}
+	registered := &flowSpecWatcher{
+		registrationInfo: plugin.newRegistrationInfo(),
+		queue:            newFlowSpecEventQueue(options, callback),
+	}
+	registration := &flowSpecRegistration{watcher: watcherName(watcher), plugin: plugin, registered: registered}
+	registered.queue.epoch = plugin.currentEpoch
+	registered.queue.onDisconnect = func() {
+		plugin.Log.Warnf("FlowSpec watcher %s disconnected, because it didn't keep up with rule changes", watcher)
+		registration.Close()
+	}
+	if options.RIBSnapshot {
+		plugin.sendFlowSpecSnapshot(registered, snapshotEnd)
+	}
+	plugin.flowSpecWatchers[watcherName(watcher)] = registered
+	return registration, nil
+}
+
+// sendFlowSpecSnapshot queues all currently known FlowSpec rules (ordered by their key) as bgp.RouteAdded events
+// for <watcher> and marks the end of snapshot by bgp.RIBSnapshotEnd event. Snapshot sent for resynchronization of watcher
+// is enclosed in bgp.ResyncStart and bgp.ResyncEnd <markers> instead. Caller must hold flowSpecMu.
+func (plugin *Plugin) sendFlowSpecSnapshot(watcher *flowSpecWatcher, markers snapshotMarkers) {
+	keys := make([]string, 0, len(plugin.flowSpecRules))
+	for key := range plugin.flowSpecRules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	events := make([]interface{}, 0, len(keys)+2)
+	if markers != snapshotEnd {
+		events = append(events, &bgp.FlowSpecEvent{Type: bgp.ResyncStart})
+	}
+	for _, key := range keys {
+		events = append(events, &bgp.FlowSpecEvent{Type: bgp.RouteAdded, Rule: plugin.flowSpecRules[key]})
+	}
+	switch markers {
+	case snapshotEnd:
+		events = append(events, &bgp.FlowSpecEvent{Type: bgp.RIBSnapshotEnd})
+	case resyncStartEnd:
+		events = append(events, &bgp.FlowSpecEvent{Type: bgp.ResyncEnd})
+	}
+	watcher.queue.pushAll(events)
+}
+
+// flowSpecRegistration is Plugin's WatchRegistration implementation for FlowSpec watchers.
+type flowSpecRegistration struct {
+	watcher    watcherName
+	plugin     *Plugin
+	registered *flowSpecWatcher
+}
+
+// ID returns unique identification of the registration.
+func (fr *flowSpecRegistration) ID() uint64 {
+	return fr.registered.id
+}
+
+// Close ends the agreement between Plugin and FlowSpec watcher. Plugin stops sending watcher any further notifications.
+// Repeated Close does nothing and Close never unregisters newer registration of watcher with the same name.
+func (fr *flowSpecRegistration) Close() error {
+	fr.plugin.flowSpecMu.Lock()
+	defer fr.plugin.flowSpecMu.Unlock()
+	if fr.plugin.flowSpecWatchers[fr.watcher] == fr.registered {
+		delete(fr.plugin.flowSpecWatchers, fr.watcher)
+	}
+	fr.registered.queue.close()
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	. "github.com/onsi/gomega"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"testing"
+	"time"
+)
+
+// TestFlowSpecRuleWatching tests that FlowSpec rules are translated into typed match components and actions, that they
+// are sent only to FlowSpec watchers and that their withdrawals are sent too.
+func TestFlowSpecRuleWatching(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, routeEvents := pluginWithEventWatcher()
+	events := make(chan bgp.FlowSpecEvent, 10)
+	_, err := plugin.WatchFlowSpec("TestFlowSpecWatcher", func(event *bgp.FlowSpecEvent) {
+		events <- *event
+	})
+	Expect(err).To(BeNil())
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{flowSpecPath(false)}})
+	event := receiveFlowSpecEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	rule := event.Rule
+	Expect(rule.Family).To(Equal(bgp.IPv4FlowSpec))
+	Expect(rule.ID).NotTo(BeEmpty())
+	Expect(rule.DestinationPrefix).To(Equal("10.5.0.0/24"))
+	Expect(rule.SourcePrefix).To(BeEmpty())
+	Expect(rule.Protocols).To(Equal([]bgp.NumericMatch{{Op: bgp.NumericEqual, Value: 6}}))
+	Expect(rule.DestinationPorts).To(Equal([]bgp.NumericMatch{
+		{Op: bgp.NumericGreater | bgp.NumericEqual, Value: 1024},
+		{And: true, Op: bgp.NumericLess | bgp.NumericEqual, Value: 2048},
+	}))
+	Expect(bgp.MatchNumeric(rule.DestinationPorts, 1500)).To(BeTrue())
+	Expect(bgp.MatchNumeric(rule.DestinationPorts, 80)).To(BeFalse())
+	Expect(rule.TCPFlags).To(Equal([]bgp.BitmaskMatch{{Match: true, Value: bgpPacket.TCP_FLAG_SYN}}))
+	Expect(bgp.MatchBitmask(rule.TCPFlags, bgpPacket.TCP_FLAG_SYN|bgpPacket.TCP_FLAG_ACK)).To(BeTrue())
+	Expect(bgp.MatchBitmask(rule.TCPFlags, bgpPacket.TCP_FLAG_ACK)).To(BeFalse())
+	Expect(rule.Fragments).To(Equal([]bgp.BitmaskMatch{{Not: true, Value: bgp.FragmentIsFragment}}))
+	Expect(rule.UnknownComponents).To(BeEmpty())
+	Expect(rule.Actions.TrafficRate).To(Equal(&bgp.TrafficRate{As: 65000, Rate: 0}))
+	Expect(rule.Actions.Redirect).To(Equal("65000:100"))
+	Expect(*rule.Actions.Mark).To(Equal(uint8(46)))
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{flowSpecPath(true)}})
+	event = receiveFlowSpecEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteWithdrawn))
+	Expect(event.PreviousRule).To(Equal(rule))
+	Consistently(routeEvents, 100*time.Millisecond).ShouldNot(Receive())
+	Expect(plugin.flowSpecRules).To(BeEmpty())
+}
+
+// flowSpecPath creates goBGP path of IPv4 FlowSpec rule matching not fragmented TCP SYN packets to ports 1024-2048
+// of 10.5.0.0/24 with traffic-rate 0 (discard), redirect to 65000:100 and DSCP marking 46 actions. Path withdrawal
+// is given by <isWithdraw>.
+func flowSpecPath(isWithdraw bool) *table.Path {
+	nlri := bgpPacket.NewFlowSpecIPv4Unicast([]bgpPacket.FlowSpecComponentInterface{
+		bgpPacket.NewFlowSpecDestinationPrefix(bgpPacket.NewIPAddrPrefix(24, "10.5.0.0")),
+		bgpPacket.NewFlowSpecComponent(bgpPacket.FLOW_SPEC_TYPE_IP_PROTO, []*bgpPacket.FlowSpecComponentItem{
+			bgpPacket.NewFlowSpecComponentItem(0x01, 6),
+		}),
+		bgpPacket.NewFlowSpecComponent(bgpPacket.FLOW_SPEC_TYPE_DST_PORT, []*bgpPacket.FlowSpecComponentItem{
+			bgpPacket.NewFlowSpecComponentItem(0x03, 1024),
+			bgpPacket.NewFlowSpecComponentItem(0x45, 2048),
+		}),
+		bgpPacket.NewFlowSpecComponent(bgpPacket.FLOW_SPEC_TYPE_TCP_FLAG, []*bgpPacket.FlowSpecComponentItem{
+			bgpPacket.NewFlowSpecComponentItem(bgpPacket.BITMASK_FLAG_OP_MATCH, bgpPacket.TCP_FLAG_SYN),
+		}),
+		bgpPacket.NewFlowSpecComponent(bgpPacket.FLOW_SPEC_TYPE_FRAGMENT, []*bgpPacket.FlowSpecComponentItem{
+			bgpPacket.NewFlowSpecComponentItem(bgpPacket.BITMASK_FLAG_OP_NOT, 0x02),
+		}),
+	})
+	return table.NewPath(nil, nlri, isWithdraw, []bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(0),
+		bgpPacket.NewPathAttributeMpReachNLRI("0.0.0.0", []bgpPacket.AddrPrefixInterface{nlri}),
+		bgpPacket.NewPathAttributeExtendedCommunities([]bgpPacket.ExtendedCommunityInterface{
+			bgpPacket.NewTrafficRateExtended(65000, 0),
+			bgpPacket.NewRedirectTwoOctetAsSpecificExtended(65000, 100),
+			bgpPacket.NewTrafficRemarkExtended(46),
+		}),
+	}, time.Now(), false)
+}
+
+// receiveFlowSpecEvent waits for FlowSpec event sent to <events> channel. If nothing comes in one second, test fails.
+func receiveFlowSpecEvent(events chan bgp.FlowSpecEvent) bgp.FlowSpecEvent {
+	var event bgp.FlowSpecEvent
+	Eventually(events, time.Second).Should(Receive(&event))
+	return event
+}
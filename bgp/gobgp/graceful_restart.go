@@ -0,0 +1,152 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	"github.com/osrg/gobgp/config"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"net"
+	"time"
+)
+
+// GracefulRestart is graceful restart configuration of neighbor (see EnableGracefulRestart()).
+// RestartTime is time (in seconds) that the peer has to re-establish lost session. Routes received from the peer
+// are retained as stale meanwhile (0 means default restart time, i.e. hold time). NotificationEnabled enables graceful
+// restart also for sessions closed by NOTIFICATION message (RFC 8538). LongLivedStaleTime is time (in seconds) that
+// stale routes are further retained after restart time expires (long-lived graceful restart), 0 disables long-lived
+// graceful restart.
+type GracefulRestart struct {
+	RestartTime         uint16
+	NotificationEnabled bool
+	LongLivedStaleTime  uint32
+}
+
+// EnableGracefulRestart enables graceful restart (RFC 4724) with <restart> configuration for <neighbor> and all its afi-safis.
+// If <neighbor> has no afi-safis configured, all route families supported by this plugin are enabled first. Neighbor
+// configured this way can be used in SessionConfig or added at runtime by AddNeighbor().
+func EnableGracefulRestart(neighbor *config.Neighbor, restart GracefulRestart) {
+	withDefaultAfiSafis(neighbor)
+	neighbor.GracefulRestart.Config.Enabled = true
+	neighbor.GracefulRestart.Config.RestartTime = restart.RestartTime
+	neighbor.GracefulRestart.Config.NotificationEnabled = restart.NotificationEnabled
+	neighbor.GracefulRestart.Config.LongLivedEnabled = restart.LongLivedStaleTime > 0
+	for i := range neighbor.AfiSafis {
+		neighbor.AfiSafis[i].MpGracefulRestart.Config.Enabled = true
+		if restart.LongLivedStaleTime > 0 {
+			neighbor.AfiSafis[i].LongLivedGracefulRestart.Config = config.LongLivedGracefulRestartConfig{
+				Enabled:     true,
+				RestartTime: restart.LongLivedStaleTime,
+			}
+		}
+	}
+}
+
+// processSessionLoss handles loss of established session with <peer>. GoBGP withdraws best routes of the peer before
+// it reports the loss of session unless it retains them for gracefully restarting peer, so best routes of the peer that
+// are still known are marked stale (see markStaleRoutes()). GoBGP withdraws them later if they are not refreshed
+// until End-of-RIB marker of the peer or until restart time expires. Paths received from the peer are handled
+// by dropReceivedPaths().
+func (plugin *Plugin) processSessionLoss(peer string) {
+	plugin.markStaleRoutes(peer)
+	retained, sweepAfter := plugin.retainedFamilies(peer)
+	plugin.dropReceivedPaths(peer, retained, sweepAfter)
+}
+
+// markStaleRoutes marks best routes received from <peer> as stale and sends them to best path watchers as bgp.RouteStale events.
+func (plugin *Plugin) markStaleRoutes(peer string) {
+	plugin.routesMu.Lock()
+	var events []*bgp.RouteEvent
+	for _, key := range plugin.rib.keysFrom(net.ParseIP(peer)) {
+		route, _ := plugin.rib.get(key)
+		if route.Stale {
+			continue
+		}
+		stale := *route
+		stale.Stale = true
+		plugin.rib.put(key, &stale)
+		if plugin.suppressed(key) {
+			continue
+		}
+		events = append(events, &bgp.RouteEvent{Type: bgp.RouteStale, Route: &stale, PreviousRoute: route})
+	}
+	watchers := plugin.routeWatcherList(false)
+	plugin.routesMu.Unlock()
+
+	if len(events) > 0 {
+		plugin.Log.Infof("Peer %s is restarting, %d routes are stale", peer, len(events))
+	}
+	for _, event := range events {
+		for _, watcher := range watchers {
+			watcher.notify(event)
+		}
+	}
+}
+
+// toRefreshEvent returns bgp.RouteUpdated event for best path watchers if received <route> refreshes stale best route
+// of the same prefix received from the same peer and updates the best route accordingly. GoBGP doesn't report refreshed
+// best path that is equal to the stale one. Nil is returned if the route doesn't refresh stale best route or if its prefix
+// is suppressed by dampening. Caller must hold routesMu.
+func (plugin *Plugin) toRefreshEvent(route *bgp.ReachableIPRoute) *bgp.RouteEvent {
+	key, err := routeKey(route)
+	if err != nil {
+		return nil
+	}
+	previous, known := plugin.rib.get(key)
+	if !known || !previous.Stale || !previous.SourcePeer.Equal(route.SourcePeer) || previous.PathID != route.PathID {
+		return nil
+	}
+	refreshed := *route
+	refreshed.Multipath = previous.Multipath
+	plugin.rib.put(key, &refreshed)
+	if plugin.suppressed(key) {
+		return nil
+	}
+	return &bgp.RouteEvent{Type: bgp.RouteUpdated, Route: &refreshed, PreviousRoute: previous}
+}
+
+// retainedFamilies returns route families whose routes goBGP retains for gracefully restarting <peer> and the time after
+// which goBGP drops them at the latest (restart time plus the longest stale time of long-lived graceful restart).
+// Nil is returned if the peer is not restarting (or plugin was not started yet).
+func (plugin *Plugin) retainedFamilies(peer string) (families map[bgp.RouteFamily]bool, sweepAfter time.Duration) {
+	if plugin.checkStarted() != nil {
+		return nil, 0
+	}
+	neighbors := plugin.server.GetNeighbor(peer, false)
+	if len(neighbors) == 0 || !neighbors[0].GracefulRestart.State.PeerRestarting {
+		return nil, 0
+	}
+	restart := neighbors[0].GracefulRestart.State
+	families = map[bgp.RouteFamily]bool{}
+	var longLivedStaleTime uint32
+	for _, afiSafi := range neighbors[0].AfiSafis {
+		rf, err := bgpPacket.GetRouteFamily(string(afiSafi.Config.AfiSafiName))
+		family, supported := supportedFamilies[rf]
+		if err != nil || !supported {
+			continue
+		}
+		if state := afiSafi.MpGracefulRestart.State; state.Enabled && state.Received {
+			families[family] = true
+		}
+		if state := afiSafi.LongLivedGracefulRestart.State; restart.LongLivedEnabled && state.Enabled {
+			families[family] = true
+			if state.PeerRestartTime > longLivedStaleTime {
+				longLivedStaleTime = state.PeerRestartTime
+			}
+		}
+	}
+	sweepAfter = time.Duration(uint32(restart.PeerRestartTime)+longLivedStaleTime) * time.Second
+	return families, sweepAfter
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	. "github.com/onsi/gomega"
+	"github.com/osrg/gobgp/config"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestStaleRouteHandling tests that best routes retained after loss of session with gracefully restarting peer are sent
+// to watchers as stale instead of withdrawn and that they are later refreshed or swept.
+func TestStaleRouteHandling(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, events := pluginWithEventWatcher()
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.8.1.0", false),
+		peerPath("10.0.0.2", "10.8.2.0", false),
+		peerPath("10.0.0.1", "10.8.3.0", false),
+	}})
+	for i := 0; i < 3; i++ {
+		receiveRouteEvent(events)
+	}
+
+	sessionLost(plugin, "10.0.0.1")
+	for _, prefix := range []string{"10.8.1.0/24", "10.8.3.0/24"} {
+		event := receiveRouteEvent(events)
+		Expect(event.Type).To(Equal(bgp.RouteStale))
+		Expect(event.Route.Prefix).To(Equal(prefix))
+		Expect(event.Route.Stale).To(BeTrue())
+		Expect(event.PreviousRoute.Stale).To(BeFalse())
+	}
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+
+	plugin.processReceivedPaths(&server.WatchEventUpdate{PostPolicy: true, PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.8.1.0", false),
+	}})
+	event := receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteUpdated))
+	Expect(event.Route.Stale).To(BeFalse())
+	Expect(event.PreviousRoute.Stale).To(BeTrue())
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.8.3.0", true),
+	}})
+	event = receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteWithdrawn))
+	Expect(event.PreviousRoute.Stale).To(BeTrue())
+
+	llgrStale := peerPath("10.0.0.2", "10.8.2.0", false)
+	llgrStale.SetCommunities([]uint32{bgpPacket.COMMUNITY_LLGR_STALE}, false)
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{llgrStale}})
+	event = receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteStale))
+	Expect(event.Route.Stale).To(BeTrue())
+	Expect(event.Route.Attributes.Communities).To(ContainElement(bgp.LLGRStale))
+}
+
+// TestStaleReceivedPathHandling tests that paths of retained route families are sent to watchers of all paths as stale
+// after loss of session with gracefully restarting peer, that refreshed paths are not swept and that paths that were
+// not refreshed are withdrawn after the restart time.
+func TestStaleReceivedPathHandling(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, _ := pluginWithEventWatcher()
+	events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestAllPathsWatcher", func(event *bgp.RouteEvent) {
+		events <- *event
+	}, bgp.WithAllPaths())
+	Expect(err).To(BeNil())
+
+	plugin.processReceivedPaths(&server.WatchEventUpdate{PostPolicy: true, PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.8.1.0", false),
+		peerPath("10.0.0.1", "10.8.2.0", false),
+	}})
+	receiveRouteEvent(events)
+	receiveRouteEvent(events)
+
+	plugin.dropReceivedPaths("10.0.0.1", map[bgp.RouteFamily]bool{bgp.IPv4Unicast: true}, 300*time.Millisecond)
+	for _, prefix := range []string{"10.8.1.0/24", "10.8.2.0/24"} {
+		event := receiveRouteEvent(events)
+		Expect(event.Type).To(Equal(bgp.RouteStale))
+		Expect(event.Route.Prefix).To(Equal(prefix))
+		Expect(event.Route.Stale).To(BeTrue())
+	}
+	plugin.processReceivedPaths(&server.WatchEventUpdate{PostPolicy: true, PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.8.2.0", false),
+	}})
+	event := receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteUpdated))
+	Expect(event.Route.Stale).To(BeFalse())
+
+	plugin.sweepStaleReceivedPaths(dueStaleSweep(plugin)) // plugin is not started, so there is no watchChanges()
+	event = receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteWithdrawn))
+	Expect(event.Route.Prefix).To(Equal("10.8.1.0/24"))
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+	Expect(plugin.receivedPathList()).To(HaveLen(1))
+}
+
+// TestStaleSweepCancellation tests that sweep of stale received paths that was rescheduled after it became due is ignored
+// and that scheduled sweeps are cancelled by Close.
+func TestStaleSweepCancellation(x *testing.T) {
+	RegisterTestingT(x)
+	plugin := startedPlugin()
+	events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestAllPathsWatcher", func(event *bgp.RouteEvent) {
+		events <- *event
+	}, bgp.WithAllPaths())
+	Expect(err).To(BeNil())
+	retained := map[bgp.RouteFamily]bool{bgp.IPv4Unicast: true}
+
+	plugin.processReceivedPaths(&server.WatchEventUpdate{PostPolicy: true, PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.8.1.0", false),
+	}})
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.RouteAdded))
+	plugin.dropReceivedPaths("10.0.0.1", retained, time.Hour)
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.RouteStale))
+
+	plugin.routesMu.Lock()
+	cancelled := plugin.staleSweeps["10.0.0.1"]
+	plugin.scheduleStaleSweep("10.0.0.1", time.Hour)
+	scheduled := plugin.staleSweeps["10.0.0.1"]
+	plugin.routesMu.Unlock()
+	plugin.sweepStaleReceivedPaths(cancelled)
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+
+	Expect(plugin.Close()).To(BeNil())
+	Expect(scheduled.timer.Stop()).To(BeFalse())
+	Expect(plugin.staleSweeps).To(BeEmpty())
+}
+
+// TestEnableGracefulRestart tests that graceful restart configuration is applied to neighbor and all its afi-safis.
+func TestEnableGracefulRestart(x *testing.T) {
+	RegisterTestingT(x)
+	neighbor := config.Neighbor{Config: config.NeighborConfig{NeighborAddress: "10.0.0.1", PeerAs: 65001}}
+
+	EnableGracefulRestart(&neighbor, GracefulRestart{RestartTime: 120, LongLivedStaleTime: 3600})
+	Expect(neighbor.GracefulRestart.Config.Enabled).To(BeTrue())
+	Expect(neighbor.GracefulRestart.Config.RestartTime).To(BeEquivalentTo(120))
+	Expect(neighbor.GracefulRestart.Config.LongLivedEnabled).To(BeTrue())
+	Expect(neighbor.AfiSafis).NotTo(BeEmpty())
+	for _, afiSafi := range neighbor.AfiSafis {
+		Expect(afiSafi.MpGracefulRestart.Config.Enabled).To(BeTrue())
+		Expect(afiSafi.LongLivedGracefulRestart.Config.Enabled).To(BeTrue())
+		Expect(afiSafi.LongLivedGracefulRestart.Config.RestartTime).To(BeEquivalentTo(3600))
+	}
+}
+
+// dueStaleSweep waits until sweep of stale received paths scheduled by <plugin> becomes due and returns it.
+func dueStaleSweep(plugin *Plugin) *staleSweep {
+	var sweep *staleSweep
+	Eventually(plugin.staleSweepsDue, time.Second).Should(Receive(&sweep))
+	return sweep
+}
+
+// sessionLost simulates loss of established session with <peer>.
+func sessionLost(plugin *Plugin, peer string) {
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: net.ParseIP(peer), State: bgpPacket.BGP_FSM_ESTABLISHED})
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: net.ParseIP(peer), State: bgpPacket.BGP_FSM_IDLE})
+}
+
+// peerPath creates goBGP path of /24 <prefix> received from <peer> (that is also its next hop).
+func peerPath(peer string, prefix string, isWithdraw bool) *table.Path {
+	source := &table.PeerInfo{AS: 65001, Address: net.ParseIP(peer), ID: net.ParseIP(peer)}
+	return table.NewPath(source, bgpPacket.NewIPAddrPrefix(24, prefix), isWithdraw, []bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(0),
+		bgpPacket.NewPathAttributeNextHop(peer),
+	}, time.Now(), false)
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+)
+
+// processBestPaths translates best path changes from goBGP server into route events. If multipath is enabled in goBGP
+// (UseMultiplePaths), the event carries also changed ECMP path sets. Change of ECMP set of prefix whose best path
+// didn't change is sent to watchers as bgp.RouteUpdated event of the current best route with the new set.
+// EVPN paths are sent to EVPN watchers (see processEVPNPath()) and FlowSpec paths to FlowSpec watchers
+// (see processFlowSpecPath()).
+func (plugin *Plugin) processBestPaths(msg *server.WatchEventBestPath) {
+	multipaths := plugin.toMultipathSets(msg.MultiPathList)
+	for _, path := range msg.PathList {
+		if path.GetRouteFamily() == bgpPacket.RF_EVPN {
+			plugin.processEVPNPath(path)
+			continue
+		}
+		if _, flowSpec := flowSpecFamilies[path.GetRouteFamily()]; flowSpec {
+			plugin.processFlowSpecPath(path)
+			continue
+		}
+		if _, supported := supportedFamilies[path.GetRouteFamily()]; !supported {
+			plugin.Log.Debugf("Ignoring path of unsupported route family %v", path.GetRouteFamily())
+			continue
+		}
+		pathInfo := toReachableIPRoute(path)
+		key, err := routeKey(pathInfo)
+		if err != nil {
+			plugin.Log.Warnf("Ignoring path with unparsable prefix %s: %v", pathInfo.Prefix, err)
+			continue
+		}
+		plugin.processPath(key, pathInfo, path.IsWithdraw, multipaths[key])
+		delete(multipaths, key)
+	}
+	for key, multipath := range multipaths {
+		plugin.processMultipath(key, multipath)
+	}
+}
+
+// toMultipathSets translates ECMP path sets (one set per changed prefix) from goBGP into next hop sets indexed by route key
+// (see routeKey()). Sets of unsupported route families and sets of withdrawn prefixes are skipped (withdrawal is part
+// of best path changes).
+func (plugin *Plugin) toMultipathSets(multiPathList [][]*table.Path) map[string][]bgp.MultipathNexthop {
+	sets := make(map[string][]bgp.MultipathNexthop, len(multiPathList))
+	for _, paths := range multiPathList {
+		if len(paths) == 0 || paths[0].IsWithdraw {
+			continue
+		}
+		if _, supported := supportedFamilies[paths[0].GetRouteFamily()]; !supported {
+			continue
+		}
+		key, err := routeKey(toReachableIPRoute(paths[0]))
+		if err != nil {
+			plugin.Log.Warnf("Ignoring multipath set with unparsable prefix %v: %v", paths[0].GetNlri(), err)
+			continue
+		}
+		sets[key] = toMultipathNexthops(paths)
+	}
+	return sets
+}
+
+// setMultipath sets ECMP next hop set of <route> (stored under <key> in route table) to changed <multipath> set.
+// If the set didn't change (<multipath> is nil), the set of last known best route is kept. Caller must hold routesMu.
+func (plugin *Plugin) setMultipath(key string, route *bgp.ReachableIPRoute, multipath []bgp.MultipathNexthop) {
+	if multipath != nil {
+		route.Multipath = multipath
+		return
+	}
+	if previous, known := plugin.rib.get(key); known {
+		route.Multipath = previous.Multipath
+	}
+}
+
+// processMultipath sends change of ECMP next hop set of route stored under <key> in route table (with unchanged best path)
+// to all registered best path watchers as bgp.RouteUpdated event.
+func (plugin *Plugin) processMultipath(key string, multipath []bgp.MultipathNexthop) {
+	plugin.routesMu.Lock()
+	previous, known := plugin.rib.get(key)
+	if !known || sameMultipath(previous.Multipath, multipath) {
+		plugin.routesMu.Unlock()
+		return
+	}
+	route := *previous
+	route.Multipath = multipath
+	plugin.rib.put(key, &route)
+	event := &bgp.RouteEvent{Type: bgp.RouteUpdated, Route: &route, PreviousRoute: previous}
+	held := plugin.dampen(key, event)
+	watchers := plugin.routeWatcherList(false)
+	plugin.routesMu.Unlock()
+
+	if held {
+		plugin.Log.Debugf("Suppressing multipath change of flapping prefix %s", route.Prefix)
+		return
+	}
+	plugin.Log.Debugf("Sending %v route event for multipath change of %v", event.Type, route.Prefix)
+	for _, watcher := range watchers {
+		watcher.notify(event)
+	}
+}
+
+// sameMultipath returns true if next hop sets <a> and <b> contain the same next hops with the same weights in the same order.
+func sameMultipath(a, b []bgp.MultipathNexthop) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Nexthop.Equal(b[i].Nexthop) || a[i].Weight != b[i].Weight {
+			return false
+		}
+	}
+	return true
+}
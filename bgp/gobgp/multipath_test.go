@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	"github.com/ligato/cn-infra/flavors/local"
+	. "github.com/onsi/gomega"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestMultipathMembershipChanges tests that watchers receive ECMP next hop set (with link bandwidth weights) of prefix
+// and updates of the set when members join or leave it.
+func TestMultipathMembershipChanges(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, events := pluginWithEventWatcher()
+	first := multipathMember("10.0.0.1", 100)
+	second := multipathMember("10.0.0.2", 300)
+
+	plugin.processBestPaths(&server.WatchEventBestPath{
+		PathList:      []*table.Path{first},
+		MultiPathList: [][]*table.Path{{first, second}},
+	})
+	event := receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Multipath).To(Equal([]bgp.MultipathNexthop{
+		{Nexthop: net.ParseIP("10.0.0.1").To4(), Weight: 100},
+		{Nexthop: net.ParseIP("10.0.0.2").To4(), Weight: 300},
+	}))
+
+	// second member leaves the set, best path stays the same
+	plugin.processBestPaths(&server.WatchEventBestPath{MultiPathList: [][]*table.Path{{first}}})
+	event = receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteUpdated))
+	Expect(event.Route.Nexthop.String()).To(Equal("10.0.0.1"))
+	Expect(event.Route.Multipath).To(HaveLen(1))
+	Expect(event.PreviousRoute.Multipath).To(HaveLen(2))
+
+	// best path changes without change of the set
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{first}})
+	event = receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteUpdated))
+	Expect(event.Route.Multipath).To(HaveLen(1))
+
+	withdrawn := first.Clone(true)
+	plugin.processBestPaths(&server.WatchEventBestPath{
+		PathList:      []*table.Path{withdrawn},
+		MultiPathList: [][]*table.Path{{withdrawn}},
+	})
+	event = receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteWithdrawn))
+	Expect(events).To(BeEmpty())
+}
+
+// pluginWithEventWatcher creates (not started) GoBGP plugin with registered route event watcher whose events are sent
+// to returned channel.
+func pluginWithEventWatcher() (*Plugin, chan bgp.RouteEvent) {
+	flavor := &local.FlavorLocal{}
+	plugin := New(Deps{PluginInfraDeps: *flavor.InfraDeps("TestGoBGP")})
+	events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestEventWatcher", func(event *bgp.RouteEvent) {
+		events <- *event
+	})
+	Expect(err).To(BeNil())
+	return plugin, events
+}
+
+// multipathMember creates goBGP path of prefix 10.1.0.0/16 via <nexthop> with link bandwidth extended community
+// carrying <bandwidth>.
+func multipathMember(nexthop string, bandwidth float32) *table.Path {
+	linkBandwidth := bgpPacket.NewTwoOctetAsSpecificExtended(bgpPacket.EC_SUBTYPE_LINK_BANDWIDTH, 65001, math.Float32bits(bandwidth), false)
+	return table.NewPath(nil, bgpPacket.NewIPAddrPrefix(16, "10.1.0.0"), false, []bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(0),
+		bgpPacket.NewPathAttributeNextHop(nexthop),
+		bgpPacket.NewPathAttributeExtendedCommunities([]bgpPacket.ExtendedCommunityInterface{linkBandwidth}),
+	}, time.Now(), false)
+}
+
+// receiveRouteEvent waits for route event sent to <events> channel. If nothing comes in one second, test fails.
+func receiveRouteEvent(events chan bgp.RouteEvent) bgp.RouteEvent {
+	var event bgp.RouteEvent
+	Eventually(events, time.Second).Should(Receive(&event))
+	return event
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"fmt"
+	"github.com/ligato/bgp-agent/bgp"
+	"github.com/osrg/gobgp/config"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"net"
+	"time"
+)
+
+// NeighborNotFoundError is returned by neighbor management methods of Plugin if there is no neighbor with given address.
+type NeighborNotFoundError struct {
+	Address string
+}
+
+// Error returns description of NeighborNotFoundError.
+func (err *NeighborNotFoundError) Error() string {
+	return fmt.Sprintf("Neighbor %s is not configured", err.Address)
+}
+
+// NeighborExistsError is returned by Plugin.AddNeighbor if neighbor with given address is already configured.
+type NeighborExistsError struct {
+	Address string
+}
+
+// Error returns description of NeighborExistsError.
+func (err *NeighborExistsError) Error() string {
+	return fmt.Sprintf("Neighbor %s is already configured", err.Address)
+}
+
+// NeighborStatus is configuration and current state of session with one BGP neighbor. RouterID and prefix counts
+// are known only for established sessions. Uptime is the time of last session establishment (zero if session was never established).
+type NeighborStatus struct {
+	Address          net.IP
+	PeerAs           uint32
+	RouterID         net.IP
+	SessionState     bgp.SessionState
+	AdminState       bgp.AdminState
+	Uptime           time.Time
+	ReceivedPrefixes uint32
+	AcceptedPrefixes uint32
+	Config           config.Neighbor
+}
+
+// AddNeighbor configures new BGP <neighbor> at runtime. If <neighbor> has no afi-safis configured, all route families
+// supported by this plugin are enabled. Runtime changes of neighbors are not stored in plugin's SessionConfig.
+// It fails with NeighborExistsError if neighbor with the same address is already configured.
+func (plugin *Plugin) AddNeighbor(neighbor config.Neighbor) error {
+	if err := plugin.checkStarted(); err != nil {
+		return err
+	}
+	if err := validateNeighbor(&neighbor); err != nil {
+		return err
+	}
+	if _, err := plugin.findNeighbor(neighbor.Config.NeighborAddress); err == nil {
+		return &NeighborExistsError{Address: neighbor.Config.NeighborAddress}
+	}
+	withDefaultAfiSafis(&neighbor)
+	if err := plugin.server.AddNeighbor(&neighbor); err != nil {
+		return fmt.Errorf("Can't add neighbor %s: %v", neighbor.Config.NeighborAddress, err)
+	}
+	plugin.Log.Infof("Neighbor %s added", neighbor.Config.NeighborAddress)
+	return nil
+}
+
+// DeleteNeighbor removes BGP neighbor with given <address> (session with it is closed).
+// It fails with NeighborNotFoundError if there is no such neighbor.
+func (plugin *Plugin) DeleteNeighbor(address string) error {
+	neighbor, err := plugin.lookupNeighbor(address)
+	if err != nil {
+		return err
+	}
+	if err := plugin.server.DeleteNeighbor(neighbor); err != nil {
+		return fmt.Errorf("Can't delete neighbor %s: %v", address, err)
+	}
+	plugin.Log.Infof("Neighbor %s deleted", address)
+	return nil
+}
+
+// UpdateNeighbor changes configuration of already configured BGP <neighbor> (identified by its address). If the change
+// requires it (i.e. changed policies), routes received from neighbor are re-evaluated by soft reset.
+// It fails with NeighborNotFoundError if there is no such neighbor.
+func (plugin *Plugin) UpdateNeighbor(neighbor config.Neighbor) error {
+	if err := validateNeighbor(&neighbor); err != nil {
+		return err
+	}
+	current, err := plugin.lookupNeighbor(neighbor.Config.NeighborAddress)
+	if err != nil {
+		return err
+	}
+	neighbor.Config.NeighborAddress = current.Config.NeighborAddress
+	withDefaultAfiSafis(&neighbor)
+	needsSoftResetIn, err := plugin.server.UpdateNeighbor(&neighbor)
+	if err != nil {
+		return fmt.Errorf("Can't update neighbor %s: %v", neighbor.Config.NeighborAddress, err)
+	}
+	if needsSoftResetIn {
+		if err := plugin.server.SoftResetIn(neighbor.Config.NeighborAddress, 0); err != nil {
+			return fmt.Errorf("Can't apply update of neighbor %s: %v", neighbor.Config.NeighborAddress, err)
+		}
+	}
+	plugin.Log.Infof("Neighbor %s updated", neighbor.Config.NeighborAddress)
+	return nil
+}
+
+// EnableNeighbor administratively enables BGP neighbor with given <address> (session with it can be established again).
+// It fails with NeighborNotFoundError if there is no such neighbor.
+func (plugin *Plugin) EnableNeighbor(address string) error {
+	neighbor, err := plugin.lookupNeighbor(address)
+	if err != nil {
+		return err
+	}
+	if err := plugin.server.EnableNeighbor(neighbor.Config.NeighborAddress); err != nil {
+		return fmt.Errorf("Can't enable neighbor %s: %v", address, err)
+	}
+	return nil
+}
+
+// DisableNeighbor administratively disables BGP neighbor with given <address>. Established session is closed by CEASE NOTIFICATION
+// message that carries <communication> (shutdown communication, RFC 8203), which can be empty.
+// It fails with NeighborNotFoundError if there is no such neighbor.
+func (plugin *Plugin) DisableNeighbor(address string, communication string) error {
+	neighbor, err := plugin.lookupNeighbor(address)
+	if err != nil {
+		return err
+	}
+	if err := plugin.server.DisableNeighbor(neighbor.Config.NeighborAddress, communication); err != nil {
+		return fmt.Errorf("Can't disable neighbor %s: %v", address, err)
+	}
+	return nil
+}
+
+// ResetNeighbor closes session with BGP neighbor with given <address> (hard reset) by CEASE NOTIFICATION message that carries
+// <communication>, which can be empty. The session is established again afterwards.
+// It fails with NeighborNotFoundError if there is no such neighbor.
+func (plugin *Plugin) ResetNeighbor(address string, communication string) error {
+	neighbor, err := plugin.lookupNeighbor(address)
+	if err != nil {
+		return err
+	}
+	if err := plugin.server.ResetNeighbor(neighbor.Config.NeighborAddress, communication); err != nil {
+		return fmt.Errorf("Can't reset neighbor %s: %v", address, err)
+	}
+	return nil
+}
+
+// SoftResetNeighbor re-evaluates routes received from BGP neighbor with given <address> and re-sends routes advertised to it
+// without closing of the session (soft reset in both directions).
+// It fails with NeighborNotFoundError if there is no such neighbor.
+func (plugin *Plugin) SoftResetNeighbor(address string) error {
+	neighbor, err := plugin.lookupNeighbor(address)
+	if err != nil {
+		return err
+	}
+	if err := plugin.server.SoftReset(neighbor.Config.NeighborAddress, 0); err != nil {
+		return fmt.Errorf("Can't soft reset neighbor %s: %v", address, err)
+	}
+	return nil
+}
+
+// Neighbors returns configuration and current state of all configured BGP neighbors.
+func (plugin *Plugin) Neighbors() ([]NeighborStatus, error) {
+	if err := plugin.checkStarted(); err != nil {
+		return nil, err
+	}
+	neighbors := plugin.server.GetNeighbor("", false)
+	statuses := make([]NeighborStatus, 0, len(neighbors))
+	for _, neighbor := range neighbors {
+		statuses = append(statuses, toNeighborStatus(neighbor))
+	}
+	return statuses, nil
+}
+
+// toNeighborStatus translates goBGP neighbor configuration (with filled state) to NeighborStatus.
+func toNeighborStatus(neighbor *config.Neighbor) NeighborStatus {
+	state := neighbor.State
+	status := NeighborStatus{
+		Address:          net.ParseIP(neighbor.Config.NeighborAddress),
+		PeerAs:           neighbor.Config.PeerAs,
+		RouterID:         net.ParseIP(state.RemoteRouterId),
+		SessionState:     toSessionState(bgpPacket.FSMState(state.SessionState.ToInt())),
+		AdminState:       toAdminState(server.AdminState(state.AdminState.ToInt())),
+		ReceivedPrefixes: state.AdjTable.Received,
+		AcceptedPrefixes: state.AdjTable.Accepted,
+		Config:           *neighbor,
+	}
+	if uptime := neighbor.Timers.State.Uptime; uptime > 0 {
+		status.Uptime = time.Unix(uptime, 0)
+	}
+	return status
+}
+
+// lookupNeighbor returns configuration of neighbor with given <address> from running goBGP server.
+func (plugin *Plugin) lookupNeighbor(address string) (*config.Neighbor, error) {
+	if err := plugin.checkStarted(); err != nil {
+		return nil, err
+	}
+	if net.ParseIP(address) == nil {
+		return nil, fmt.Errorf("Invalid neighbor address %q", address)
+	}
+	return plugin.findNeighbor(address)
+}
+
+// findNeighbor finds neighbor with given <address> (address is compared as IP address, not as string).
+func (plugin *Plugin) findNeighbor(address string) (*config.Neighbor, error) {
+	ip := net.ParseIP(address)
+	for _, neighbor := range plugin.server.GetNeighbor("", false) {
+		if ip.Equal(net.ParseIP(neighbor.Config.NeighborAddress)) {
+			return neighbor, nil
+		}
+	}
+	return nil, &NeighborNotFoundError{Address: address}
+}
+
+// validateNeighbor checks that <neighbor> configuration has valid neighbor address and peer AS.
+func validateNeighbor(neighbor *config.Neighbor) error {
+	if net.ParseIP(neighbor.Config.NeighborAddress) == nil {
+		return fmt.Errorf("Invalid neighbor address %q", neighbor.Config.NeighborAddress)
+	}
+	if neighbor.Config.PeerAs == 0 {
+		return fmt.Errorf("Neighbor %s has no peer AS", neighbor.Config.NeighborAddress)
+	}
+	return nil
+}
+
+// checkStarted fails if plugin was not started yet (goBGP server would block until it is started).
+func (plugin *Plugin) checkStarted() error {
+	if plugin.serverWatcher == nil {
+		return fmt.Errorf("GoBGP plugin is not started yet")
+	}
+	return nil
+}
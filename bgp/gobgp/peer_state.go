@@ -0,0 +1,305 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+)
+
+// notifications is logrus hook that passes NOTIFICATION messages logged by goBGP servers of this process to trackers
+// of all initialized plugins.
+var notifications = &notificationHook{trackers: map[*notificationTracker]bool{}}
+
+// registerNotificationHook hooks notifications into goBGP logger (only once per process, logrus hooks can't be removed).
+var registerNotificationHook sync.Once
+
+// notificationHook is logrus hook that collects NOTIFICATION messages sent to or received from peers.
+// goBGP doesn't expose NOTIFICATION messages in its API (they are consumed by its FSM and neither peer state watch
+// events nor neighbor state carry them), it only logs them on warning level. Therefore the notifications can't be tracked
+// if goBGP logger level is set above warning level. Hook is installed to goBGP logger (logrus standard logger) and it only
+// reads entries of goBGP's "Peer" topic, other entries (also of other users of the logger) are left untouched. Entries
+// identify peer only by its address, so plugins of one process that have neighbor with the same address both get
+// its notifications.
+type notificationHook struct {
+	sync.Mutex
+	trackers map[*notificationTracker]bool
+}
+
+// Levels returns log levels of goBGP entries about sent or received notifications.
+func (hook *notificationHook) Levels() []log.Level {
+	return []log.Level{log.WarnLevel}
+}
+
+// goBGPPeerTopic is topic of goBGP log entries about peers (including sent and received notifications).
+const goBGPPeerTopic = "Peer"
+
+// Fire passes notification from goBGP log <entry> to all registered trackers if the entry is about sent or received
+// notification.
+func (hook *notificationHook) Fire(entry *log.Entry) error {
+	neighbor, notification, ok := parseNotification(entry)
+	if !ok {
+		return nil
+	}
+	hook.Lock()
+	defer hook.Unlock()
+	for tracker := range hook.trackers {
+		tracker.remember(neighbor, notification)
+	}
+	return nil
+}
+
+// add registers <tracker> to receive notifications.
+func (hook *notificationHook) add(tracker *notificationTracker) {
+	hook.Lock()
+	defer hook.Unlock()
+	hook.trackers[tracker] = true
+}
+
+// remove unregisters <tracker>.
+func (hook *notificationHook) remove(tracker *notificationTracker) {
+	hook.Lock()
+	defer hook.Unlock()
+	delete(hook.trackers, tracker)
+}
+
+// parseNotification returns neighbor address and notification from goBGP log <entry>. It returns false if the entry
+// is not about sent or received notification.
+func parseNotification(entry *log.Entry) (neighbor string, notification bgp.Notification, ok bool) {
+	if entry.Logger != log.StandardLogger() || entry.Data["Topic"] != goBGPPeerTopic {
+		return "", notification, false
+	}
+	if entry.Message != "received notification" && entry.Message != "sent notification" {
+		return "", notification, false
+	}
+	if neighbor, ok = entry.Data["Key"].(string); !ok {
+		return "", notification, false
+	}
+	if msgErr, isMsgErr := entry.Data["Data"].(*bgpPacket.MessageError); isMsgErr {
+		return neighbor, bgp.Notification{Code: msgErr.TypeCode, Subcode: msgErr.SubTypeCode}, true
+	}
+	code, codeOk := entry.Data["Code"].(uint8)
+	subcode, subcodeOk := entry.Data["Subcode"].(uint8)
+	if !codeOk || !subcodeOk {
+		return "", notification, false
+	}
+	return neighbor, bgp.Notification{Code: code, Subcode: subcode}, true
+}
+
+// notificationTracker keeps last NOTIFICATION message exchanged with each neighbor of one plugin during the current
+// session with the neighbor (see processPeerState()).
+type notificationTracker struct {
+	sync.Mutex
+	lastNotifications map[string]bgp.Notification // by neighbor address
+}
+
+// newNotificationTracker creates notificationTracker without any notification.
+func newNotificationTracker() *notificationTracker {
+	return &notificationTracker{lastNotifications: map[string]bgp.Notification{}}
+}
+
+// remember remembers <notification> as the last notification exchanged with <neighbor>.
+func (tracker *notificationTracker) remember(neighbor string, notification bgp.Notification) {
+	tracker.Lock()
+	defer tracker.Unlock()
+	tracker.lastNotifications[neighbor] = notification
+}
+
+// last returns last notification exchanged with <neighbor> or nil if there was none.
+func (tracker *notificationTracker) last(neighbor string) *bgp.Notification {
+	tracker.Lock()
+	defer tracker.Unlock()
+	if notification, found := tracker.lastNotifications[neighbor]; found {
+		return &notification
+	}
+	return nil
+}
+
+// forget forgets last notification exchanged with <neighbor>.
+func (tracker *notificationTracker) forget(neighbor string) {
+	tracker.Lock()
+	defer tracker.Unlock()
+	delete(tracker.lastNotifications, neighbor)
+}
+
+// processPeerState translates session state change from goBGP server into bgp.PeerStateEvent and queues it for all
+// registered peer state watchers. Routes received from the peer are withdrawn or marked stale when its established
+// session is lost (see processSessionLoss()) and all watchers are resynchronized when lost session is re-established
+// (see resyncWatchers()). End-of-RIB markers of peer are not awaited anymore after loss of its session. Only event
+// of loss of established session carries the last notification exchanged with the peer during the session.
+func (plugin *Plugin) processPeerState(msg *server.WatchEventPeerState) {
+	plugin.peersMu.Lock()
+	neighbor := msg.PeerAddress.String()
+	event := &bgp.PeerStateEvent{
+		PeerAddress: msg.PeerAddress,
+		PeerAs:      msg.PeerAS,
+		RouterID:    msg.PeerID,
+		OldState:    plugin.peerStates[neighbor],
+		NewState:    toSessionState(msg.State),
+		AdminState:  toAdminState(msg.AdminState),
+		Timestamp:   msg.Timestamp,
+	}
+	switch {
+	case event.NewState == bgp.SessionEstablished:
+		plugin.notifications.forget(neighbor) // notifications of previous sessions
+	case event.OldState == bgp.SessionEstablished:
+		event.LastNotification = plugin.notifications.last(neighbor)
+	}
+	plugin.peerStates[neighbor] = event.NewState
+	recovered := event.NewState == bgp.SessionEstablished && event.OldState != bgp.SessionEstablished && plugin.establishedPeers[neighbor]
+	if event.NewState == bgp.SessionEstablished {
+		plugin.establishedPeers[neighbor] = true
+	}
+	queues := make([]*deliveryQueue, 0, len(plugin.peerStateWatchers))
+	for _, watcher := range plugin.peerStateWatchers {
+		queues = append(queues, watcher.queue)
+	}
+	plugin.peersMu.Unlock()
+
+	if event.OldState == bgp.SessionEstablished && event.NewState != bgp.SessionEstablished {
+		plugin.processSessionLoss(neighbor)
+		plugin.stopAwaitingEndOfRIB(neighbor)
+	}
+	if recovered {
+		plugin.resyncWatchers(neighbor)
+	}
+
+	plugin.Log.Debugf("Sending peer state event for %v (%v -> %v)", neighbor, event.OldState, event.NewState)
+	for _, queue := range queues {
+		queue.push(event)
+	}
+}
+
+// resyncWatchers sends all currently known routes to all registered route, EVPN and FlowSpec watchers after
+// bgp.ResyncStart marker when session with <neighbor> was re-established, so that watchers can sweep routes they hold
+// that are no longer reachable. bgp.ResyncEnd marker is sent after the neighbor sent all its routes (see pendingResync).
+// Session epoch of plugin is changed (see bgp.EventStamp).
+func (plugin *Plugin) resyncWatchers(neighbor string) {
+	epoch := atomic.AddUint64(&plugin.epoch, 1)
+	plugin.Log.Infof("Session with %s was re-established, resynchronizing watchers (epoch %d)", neighbor, epoch)
+	resync := plugin.startResync(neighbor)
+	plugin.routesMu.Lock()
+	for _, watcher := range plugin.routeWatchers {
+		plugin.sendRIBSnapshot(watcher, resyncStart)
+		resync.routeWatchers = append(resync.routeWatchers, watcher)
+	}
+	plugin.routesMu.Unlock()
+
+	plugin.evpnMu.Lock()
+	for _, watcher := range plugin.evpnWatchers {
+		plugin.sendEVPNSnapshot(watcher, resyncStart)
+		resync.evpnWatchers = append(resync.evpnWatchers, watcher)
+	}
+	plugin.evpnMu.Unlock()
+
+	plugin.flowSpecMu.Lock()
+	for _, watcher := range plugin.flowSpecWatchers {
+		plugin.sendFlowSpecSnapshot(watcher, resyncStart)
+		resync.flowSpecWatchers = append(resync.flowSpecWatchers, watcher)
+	}
+	plugin.flowSpecMu.Unlock()
+
+	if len(resync.awaited) == 0 {
+		plugin.endResync(resync)
+	}
+}
+
+// toSessionState translates goBGP FSM state to bgp.SessionState.
+func toSessionState(state bgpPacket.FSMState) bgp.SessionState {
+	switch state {
+	case bgpPacket.BGP_FSM_CONNECT:
+		return bgp.SessionConnect
+	case bgpPacket.BGP_FSM_ACTIVE:
+		return bgp.SessionActive
+	case bgpPacket.BGP_FSM_OPENSENT:
+		return bgp.SessionOpenSent
+	case bgpPacket.BGP_FSM_OPENCONFIRM:
+		return bgp.SessionOpenConfirm
+	case bgpPacket.BGP_FSM_ESTABLISHED:
+		return bgp.SessionEstablished
+	default:
+		return bgp.SessionIdle
+	}
+}
+
+// toAdminState translates goBGP administrative state of peer to bgp.AdminState.
+func toAdminState(state server.AdminState) bgp.AdminState {
+	switch state {
+	case server.ADMIN_STATE_DOWN:
+		return bgp.AdminStateDown
+	case server.ADMIN_STATE_PFX_CT:
+		return bgp.AdminStatePrefixLimitExceeded
+	default:
+		return bgp.AdminStateUp
+	}
+}
+
+// WatchPeerState register watcher to notifications about changes of BGP session state with peers.
+// Watcher have to identify himself by name(<watcher> param) and provide <callback> that receives the state changes.
+// goBGP reports only changes from or to established state, so intermediate states of session establishment are not
+// sent to <callback>. LastNotification is filled only for loss of established session and only if goBGP logs notifications
+// (log level warning or lower).
+func (plugin *Plugin) WatchPeerState(watcher string, callback func(*bgp.PeerStateEvent)) (bgp.WatchRegistration, error) {
+	if callback == nil {
+		return nil, bgp.ErrNilCallback
+	}
+	plugin.Log.Infof("Watcher %s registering for watching of peer state in %s.", watcher, plugin.PluginName)
+	plugin.peersMu.Lock()
+	defer plugin.peersMu.Unlock()
+	if _, found := plugin.peerStateWatchers[watcherName(watcher)]; found {
+		return nil, &bgp.DuplicateWatcherError{Watcher: watcher}
+	}
+	registered := &peerStateWatcher{
+		registrationInfo: plugin.newRegistrationInfo(),
+		queue:            newPeerStateEventQueue(callback),
+	}
+	registered.queue.epoch = plugin.currentEpoch
+	plugin.peerStateWatchers[watcherName(watcher)] = registered
+	return &peerStateRegistration{watcher: watcherName(watcher), plugin: plugin, registered: registered}, nil
+}
+
+// peerStateWatcher is registered peer state watcher. Peer state events are queued for delivery to watcher's callback.
+type peerStateWatcher struct {
+	registrationInfo
+	queue *deliveryQueue
+}
+
+// peerStateRegistration is Plugin's WatchRegistration implementation for peer state watchers.
+type peerStateRegistration struct {
+	watcher    watcherName
+	plugin     *Plugin
+	registered *peerStateWatcher
+}
+
+// ID returns unique identification of the registration.
+func (pr *peerStateRegistration) ID() uint64 {
+	return pr.registered.id
+}
+
+// Close ends the agreement between Plugin and peer state watcher. Plugin stops sending watcher any further notifications.
+// Repeated Close does nothing and Close never unregisters newer registration of watcher with the same name.
+func (pr *peerStateRegistration) Close() error {
+	pr.plugin.peersMu.Lock()
+	defer pr.plugin.peersMu.Unlock()
+	if pr.plugin.peerStateWatchers[pr.watcher] == pr.registered {
+		delete(pr.plugin.peerStateWatchers, pr.watcher)
+	}
+	pr.registered.queue.close()
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	. "github.com/onsi/gomega"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// TestWatcherResyncAfterSessionRecovery tests that watchers receive all currently reachable routes enclosed in resync
+// markers when lost session is re-established, but not when the session is established for the first time.
+func TestWatcherResyncAfterSessionRecovery(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, events := pluginWithEventWatcher()
+	peer := net.ParseIP("10.0.0.1")
+
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ESTABLISHED})
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.9.1.0", false),
+		peerPath("10.0.0.2", "10.9.2.0", false),
+	}})
+	receiveRouteEvent(events)
+	receiveRouteEvent(events)
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.9.1.0", true),
+	}})
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ACTIVE})
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.RouteWithdrawn))
+
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ESTABLISHED})
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.ResyncStart))
+	event := receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Prefix).To(Equal("10.9.2.0/24"))
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+
+	// routes sent by peer after re-establishment of session come before the end of resynchronization
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		peerPath("10.0.0.1", "10.9.1.0", false),
+	}})
+	event = receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Prefix).To(Equal("10.9.1.0/24"))
+	plugin.processEndOfRIB(&server.WatchEventMessage{PeerAddress: net.ParseIP("10.0.0.2"), Message: bgpPacket.NewEndOfRib(bgpPacket.RF_IPv4_UC)})
+	plugin.processEndOfRIB(&server.WatchEventMessage{PeerAddress: peer, Message: bgpPacket.NewEndOfRib(bgpPacket.RF_IPv6_UC)})
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+
+	plugin.processEndOfRIB(&server.WatchEventMessage{PeerAddress: peer, Message: bgpPacket.NewEndOfRib(bgpPacket.RF_IPv4_UC)})
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.ResyncEnd))
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+}
+
+// TestWatcherResyncTimeout tests that resynchronization of watchers ends when End-of-RIB marker of recovered peer is not
+// received in time or when session with the peer is lost again.
+func TestWatcherResyncTimeout(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, events := pluginWithEventWatcher()
+	peer := net.ParseIP("10.0.0.1")
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ESTABLISHED})
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ACTIVE})
+
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ESTABLISHED})
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.ResyncStart))
+	plugin.resync.timer.Reset(10 * time.Millisecond)
+	var resync *pendingResync
+	Eventually(plugin.resyncsDue, time.Second).Should(Receive(&resync))
+	plugin.processResyncTimeout(resync) // plugin is not started, so there is no watchChanges()
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.ResyncEnd))
+
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ACTIVE})
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ESTABLISHED})
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.ResyncStart))
+	plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: bgpPacket.BGP_FSM_ACTIVE})
+	Expect(receiveRouteEvent(events).Type).To(Equal(bgp.ResyncEnd))
+	Expect(plugin.resync).To(BeNil())
+	plugin.processResyncTimeout(resync)
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+}
+
+// TestNotificationTracker tests that notifications are picked up from log entries in the exact format used by goBGP FSM
+// and passed to registered trackers and that other log entries are ignored.
+func TestNotificationTracker(x *testing.T) {
+	RegisterTestingT(x)
+	hook := &notificationHook{trackers: map[*notificationTracker]bool{}}
+	tracker := newNotificationTracker()
+	hook.add(tracker)
+	goBGPEntry := func(message string, fields log.Fields) *log.Entry {
+		entry := log.NewEntry(log.StandardLogger()).WithFields(fields)
+		entry.Message = message
+		return entry
+	}
+
+	// received notification (fsm.go, established/openconfirm handler)
+	Expect(hook.Fire(goBGPEntry("received notification", log.Fields{
+		"Topic": "Peer", "Key": "10.0.0.1", "Code": uint8(6), "Subcode": uint8(4), "Data": []byte{},
+	}))).To(BeNil())
+	Expect(tracker.last("10.0.0.1")).To(Equal(&bgp.Notification{Code: 6, Subcode: 4}))
+	// sent notification with state (fsm.go, openconfirm handler)
+	Expect(hook.Fire(goBGPEntry("sent notification", log.Fields{
+		"Topic": "Peer", "Key": "10.0.0.1", "State": "BGP_FSM_OPENCONFIRM", "Code": uint8(2), "Subcode": uint8(2), "Data": []byte{},
+	}))).To(BeNil())
+	Expect(tracker.last("10.0.0.1")).To(Equal(&bgp.Notification{Code: 2, Subcode: 2}))
+	// sent notification caused by message error (fsm.go, sendNotificationFromErrorMsg)
+	msgErr := bgpPacket.NewMessageError(bgpPacket.BGP_ERROR_UPDATE_MESSAGE_ERROR, bgpPacket.BGP_ERROR_SUB_MALFORMED_AS_PATH, nil, "")
+	Expect(hook.Fire(goBGPEntry("sent notification", log.Fields{"Topic": "Peer", "Key": "10.0.0.2", "Data": msgErr}))).To(BeNil())
+	Expect(tracker.last("10.0.0.2")).To(Equal(&bgp.Notification{Code: 3, Subcode: 11}))
+
+	// entries of other topics and other loggers are ignored
+	Expect(hook.Fire(goBGPEntry("received notification", log.Fields{
+		"Topic": "Other", "Key": "10.0.0.3", "Code": uint8(6), "Subcode": uint8(2),
+	}))).To(BeNil())
+	otherLogger := log.New()
+	otherLogger.Out = ioutil.Discard
+	other := log.NewEntry(otherLogger).WithFields(log.Fields{"Topic": "Peer", "Key": "10.0.0.3", "Code": uint8(6), "Subcode": uint8(2)})
+	other.Message = "received notification"
+	Expect(hook.Fire(other)).To(BeNil())
+	Expect(tracker.last("10.0.0.3")).To(BeNil())
+
+	// unregistered tracker doesn't get notifications
+	hook.remove(tracker)
+	Expect(hook.Fire(goBGPEntry("received notification", log.Fields{
+		"Topic": "Peer", "Key": "10.0.0.1", "Code": uint8(6), "Subcode": uint8(2), "Data": []byte{},
+	}))).To(BeNil())
+	Expect(tracker.last("10.0.0.1")).To(Equal(&bgp.Notification{Code: 2, Subcode: 2}))
+}
+
+// TestLastNotificationOfSession tests that only loss of established session carries the last notification and that
+// notification of lost session is not carried by events of recovered session.
+func TestLastNotificationOfSession(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, _ := pluginWithEventWatcher()
+	states := make(chan *bgp.PeerStateEvent, 10)
+	_, err := plugin.WatchPeerState("TestPeerStateWatcher", func(event *bgp.PeerStateEvent) {
+		states <- event
+	})
+	Expect(err).To(BeNil())
+	peer := net.ParseIP("10.0.0.1")
+	receiveState := func(state bgpPacket.FSMState) *bgp.PeerStateEvent {
+		plugin.processPeerState(&server.WatchEventPeerState{PeerAddress: peer, State: state})
+		var event *bgp.PeerStateEvent
+		Eventually(states, time.Second).Should(Receive(&event))
+		return event
+	}
+
+	plugin.notifications.remember("10.0.0.1", bgp.Notification{Code: 2, Subcode: 2}) // i.e. bad peer AS in OPEN
+	Expect(receiveState(bgpPacket.BGP_FSM_ESTABLISHED).LastNotification).To(BeNil())
+	plugin.notifications.remember("10.0.0.1", bgp.Notification{Code: 6, Subcode: 4})
+	Expect(receiveState(bgpPacket.BGP_FSM_ACTIVE).LastNotification).To(Equal(&bgp.Notification{Code: 6, Subcode: 4}))
+
+	Expect(receiveState(bgpPacket.BGP_FSM_ESTABLISHED).LastNotification).To(BeNil())
+	Expect(receiveState(bgpPacket.BGP_FSM_ACTIVE).LastNotification).To(BeNil())
+}
+
+// TestGoBGPNotificationLogFormat tests that vendored goBGP still logs notifications in the format expected
+// by notificationTracker (the tracker silently stops working otherwise).
+func TestGoBGPNotificationLogFormat(x *testing.T) {
+	RegisterTestingT(x)
+	source, err := ioutil.ReadFile("../../vendor/github.com/osrg/gobgp/server/fsm.go")
+	if err != nil {
+		x.Skip("goBGP is not vendored: ", err)
+	}
+	Expect(regexp.MustCompile(`\.Warn\("received notification"\)`).FindAll(source, -1)).To(HaveLen(2))
+	Expect(regexp.MustCompile(`\.Warn\("sent notification"\)`).FindAll(source, -1)).To(HaveLen(3))
+	Expect(regexp.MustCompile(`"Topic":\s+"Peer",\s+"Key":\s+[\w.]+NeighborAddress,\s+("State":\s+fsm\.state\.String\(\),\s+)?"Code":\s+body\.ErrorCode,\s+"Subcode":\s+body\.ErrorSubcode,`).FindAll(source, -1)).To(HaveLen(4))
+	Expect(regexp.MustCompile(`"Topic":\s+"Peer",\s+"Key":\s+fsm\.pConf\.State\.NeighborAddress,\s+"Data":\s+e,\s+}\)\.Warn\("sent notification"\)`).FindAll(source, -1)).To(HaveLen(1))
+}
@@ -16,13 +16,18 @@
 package gobgp
 
 import (
+	"context"
 	"fmt"
 	"github.com/ligato/bgp-agent/bgp"
 	"github.com/ligato/cn-infra/flavors/local"
+	"github.com/ligato/cn-infra/logging"
 	"github.com/osrg/gobgp/config"
 	"github.com/osrg/gobgp/server"
-	"strconv"
+	log "github.com/sirupsen/logrus"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Plugin is GoBGP Ligato BGP Plugin implementation. Purpose of this plugin is to retrieve BGP related information and
@@ -32,7 +37,33 @@ type Plugin struct {
 	Deps
 	server                *server.BgpServer
 	serverWatcher         *server.Watcher
-	watchersWithCallbacks map[watcherName]func(*bgp.ReachableIPRoute)
+	routeWatchers         map[watcherName]*routeWatcher
+	rib                   *ribIndex  // last known best route for each reachable prefix
+	receivedPaths         map[string]map[string]*bgp.ReachableIPRoute // last known received paths by peer address and path key (tracked only for watchers of all paths)
+	staleSweeps           map[string]*staleSweep // scheduled sweeps of stale received paths by peer address
+	staleSweepsDue        chan *staleSweep       // sweeps of stale received paths that are due (processed by watchChanges())
+	pathsLoad             *receivedPathsLoad     // loading of received paths for the first watcher of all paths (nil if none)
+	pathsLoadMu           sync.Mutex             // serializes loading of received paths (see loadReceivedPaths())
+	vrfs                  map[string]Vrf
+	routesMu              sync.Mutex // guards rib, receivedPaths, staleSweeps, pathsLoad, routeWatchers and vrfs so that RIB snapshots are consistent with sent events
+	peerStateWatchers     map[watcherName]*peerStateWatcher
+	peerStates            map[string]bgp.SessionState // last known session state for each neighbor address
+	establishedPeers      map[string]bool             // neighbors whose session was established at least once
+	peersMu               sync.Mutex                  // guards peerStateWatchers, peerStates and establishedPeers
+	notifications         *notificationTracker        // NOTIFICATION messages exchanged with neighbors (registered to goBGP logger by Init)
+	evpnWatchers          map[watcherName]*evpnWatcher
+	evpnRoutes            map[string]*bgp.EVPNRoute // last known best EVPN route by its key (see evpnRouteKey())
+	evpnMu                sync.Mutex                // guards evpnWatchers and evpnRoutes
+	flowSpecWatchers      map[watcherName]*flowSpecWatcher
+	flowSpecRules         map[string]*bgp.FlowSpecRule // last known FlowSpec rule by its key (see flowSpecRuleKey())
+	flowSpecMu            sync.Mutex                   // guards flowSpecWatchers and flowSpecRules
+	dampener              *dampener                    // route flap dampening of best path route events (guarded by routesMu, nil if disabled)
+	announcements         map[string]*announcementHandle // not yet withdrawn announcements by canonical prefix
+	announcementsMu       sync.Mutex                     // guards announcements
+	resync                *pendingResync                 // resynchronization of watchers awaiting End-of-RIB markers (nil if none)
+	resyncsDue            chan *pendingResync            // resynchronizations whose timeout expired (processed by watchChanges())
+	lastRegistrationID    uint64                      // ID of the last watcher registration (accessed atomically)
+	epoch                 uint64                      // session epoch of plugin (accessed atomically, see bgp.EventStamp)
 	stopWatch             chan bool
 	watchWG               sync.WaitGroup // wait group that allows to wait until Watch loop is ended
 }
@@ -41,14 +72,76 @@ type Plugin struct {
 type Deps struct {
 	local.PluginInfraDeps             // inject
 	SessionConfig         *config.Bgp // optional inject (if not injected, it must be set using external config file)
+	Dampening             *bgp.DampeningConfig // optional inject (route flap dampening is disabled if not injected)
 }
 
 // watcherName is by-name identification of registered watcher
 type watcherName string
 
+// registrationInfo identifies one registration of watcher.
+type registrationInfo struct {
+	id           uint64
+	registeredAt time.Time
+}
+
+// newRegistrationInfo creates registrationInfo with new unique registration ID.
+func (plugin *Plugin) newRegistrationInfo() registrationInfo {
+	return registrationInfo{id: atomic.AddUint64(&plugin.lastRegistrationID, 1), registeredAt: time.Now()}
+}
+
+// routeWatcher is registered route event watcher. Route events passing its filter are queued for delivery to watcher's callback.
+type routeWatcher struct {
+	registrationInfo
+	filter *bgp.RouteFilter
+	vrf      *bgp.RouteFilter // L3VPN routes imported into watched VRF (nil if watcher doesn't watch VRF)
+	vrfName  string           // name of watched VRF (empty if watcher doesn't watch VRF)
+	allPaths bool             // watcher receives all received paths instead of best paths (see bgp.WithAllPaths())
+	queue    *deliveryQueue
+}
+
+// notify queues <event> for delivery to watcher if the event passes watcher's filter.
+func (watcher *routeWatcher) notify(event *bgp.RouteEvent) {
+	if filtered := watcher.filterEvent(event); filtered != nil {
+		watcher.queue.push(filtered)
+	}
+}
+
+// filterEvent applies watcher's VRF subscription and filter on <event> (see bgp.RouteFilter.FilterEvent()). L3VPN routes
+// pass only to watchers of VRF that imports them, other routes pass only to watchers that don't watch VRF.
+// Nil is returned if the event doesn't pass.
+func (watcher *routeWatcher) filterEvent(event *bgp.RouteEvent) *bgp.RouteEvent {
+	if watcher.vrf == nil {
+		if event.Route != nil && event.Route.Family.IsVPN() {
+			return nil
+		}
+	} else if event = watcher.vrf.FilterEvent(event); event == nil {
+		return nil
+	}
+	return watcher.filter.FilterEvent(event)
+}
+
 //New creates a GoBGP Ligato BGP Plugin implementation. Needed <dependencies> are injected into plugin implementation.
 func New(dependencies Deps) *Plugin {
-	return &Plugin{Deps: dependencies, watchersWithCallbacks: map[watcherName]func(*bgp.ReachableIPRoute){}}
+	return &Plugin{
+		Deps:                  dependencies,
+		routeWatchers:         map[watcherName]*routeWatcher{},
+		rib:                   newRIBIndex(),
+		receivedPaths:         map[string]map[string]*bgp.ReachableIPRoute{},
+		staleSweeps:           map[string]*staleSweep{},
+		staleSweepsDue:        make(chan *staleSweep),
+		resyncsDue:            make(chan *pendingResync),
+		vrfs:                  map[string]Vrf{},
+		peerStateWatchers:     map[watcherName]*peerStateWatcher{},
+		peerStates:            map[string]bgp.SessionState{},
+		establishedPeers:      map[string]bool{},
+		notifications:         newNotificationTracker(),
+		evpnWatchers:          map[watcherName]*evpnWatcher{},
+		evpnRoutes:            map[string]*bgp.EVPNRoute{},
+		flowSpecWatchers:      map[watcherName]*flowSpecWatcher{},
+		flowSpecRules:         map[string]*bgp.FlowSpecRule{},
+		announcements:         map[string]*announcementHandle{},
+		epoch:                 uint64(time.Now().UnixNano()), // epochs of later plugin sessions are greater
+	}
 }
 
 //Init creates the gobgp server and checks if needed SessionConfig was injected and fails if it is not.
@@ -58,6 +151,15 @@ func (plugin *Plugin) Init() error {
 	if plugin.SessionConfig == nil {
 		return fmt.Errorf("Can't init GoBGP plugin without configuration")
 	}
+	plugin.enableDefaultAfiSafis()
+	if plugin.Dampening != nil {
+		if err := plugin.Dampening.Validate(); err != nil {
+			return fmt.Errorf("Can't init GoBGP plugin with invalid dampening configuration: %v", err)
+		}
+		plugin.dampener = newDampener(*plugin.Dampening)
+	}
+	registerNotificationHook.Do(func() { log.AddHook(notifications) }) // goBGP logs to logrus standard logger
+	notifications.add(plugin.notifications)
 	plugin.server = server.NewBgpServer()
 
 	return nil
@@ -80,6 +182,33 @@ func (plugin *Plugin) Init() error {
 	plugin.SessionConfig = &externalCfg
 }
 
+// enableDefaultAfiSafis enables all route families supported by this plugin (IPv4 and IPv6 unicast, labeled unicast, L3VPN, EVPN and FlowSpec) for every configured
+// neighbor that has no explicit afi-safis configuration. Without it, GoBGP would negotiate only the route family
+// of the neighbor's address.
+func (plugin *Plugin) enableDefaultAfiSafis() {
+	for i := range plugin.SessionConfig.Neighbors {
+		withDefaultAfiSafis(&plugin.SessionConfig.Neighbors[i])
+	}
+}
+
+// withDefaultAfiSafis enables all route families supported by this plugin for <neighbor> if it has no explicit afi-safis configuration.
+func withDefaultAfiSafis(neighbor *config.Neighbor) {
+	if len(neighbor.AfiSafis) > 0 {
+		return
+	}
+	neighbor.AfiSafis = []config.AfiSafi{
+		{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_IPV4_UNICAST, Enabled: true}},
+		{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_IPV6_UNICAST, Enabled: true}},
+		{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_IPV4_LABELLED_UNICAST, Enabled: true}},
+		{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_IPV6_LABELLED_UNICAST, Enabled: true}},
+		{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_L3VPN_IPV4_UNICAST, Enabled: true}},
+		{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_L3VPN_IPV6_UNICAST, Enabled: true}},
+		{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_L2VPN_EVPN, Enabled: true}},
+		{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_IPV4_FLOWSPEC, Enabled: true}},
+		{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_IPV6_FLOWSPEC, Enabled: true}},
+	}
+}
+
 // AfterInit starts gobgp with dedicated goroutine for watching gobgp and forwarding best path reachable ip routes to registered watchers.
 // After start of gobgp session, known neighbors from configuration are added to gobgp server. AfterInit fails if session start or
 // adding of known neighbors from configuration fails.
@@ -95,53 +224,131 @@ func (plugin *Plugin) AfterInit() error {
 		return err
 	}
 	plugin.stopWatch = make(chan bool, 1)
-	plugin.serverWatcher = plugin.server.Watch(server.WatchBestPath(true))
+	plugin.serverWatcher = plugin.server.Watch(server.WatchBestPath(true), server.WatchPeerState(true), server.WatchPostUpdate(false), server.WatchMessage(false))
 	plugin.watchWG.Add(1)
 	go plugin.watchChanges(plugin.serverWatcher)
 
 	return nil
 }
 
-// watchChanges watches for events from goBGP server(using server <watcher>), translates them to bgp.ReachableIPRoute and sends them to registered watchers.
+// watchChanges watches for events from goBGP server(using server <watcher>), translates them to bgp.RouteEvent, bgp.EVPNEvent, bgp.FlowSpecEvent or bgp.PeerStateEvent
+// and sends them to registered watchers. Received messages are watched only for End-of-RIB markers (see processEndOfRIB()).
+// Due sweeps of stale received paths and expired resynchronizations of watchers are processed by the same goroutine.
 func (plugin *Plugin) watchChanges(watcher *server.Watcher) {
 	defer plugin.watchWG.Done()
 
+	var reuse <-chan time.Time // reuse checks of dampened prefixes (nil channel blocks forever if dampening is disabled)
+	if plugin.dampener != nil {
+		ticker := time.NewTicker(dampeningReuseInterval)
+		defer ticker.Stop()
+		reuse = ticker.C
+	}
 	for {
 		select {
 		case <-plugin.stopWatch:
 			plugin.Log.Debug("Stop Watching ", plugin.PluginName)
 			return
+		case now := <-reuse:
+			plugin.reuseDampenedRoutes(now)
+		case sweep := <-plugin.staleSweepsDue:
+			plugin.sweepStaleReceivedPaths(sweep)
+		case resync := <-plugin.resyncsDue:
+			plugin.processResyncTimeout(resync)
 		case ev := <-watcher.Event():
 			switch msg := ev.(type) {
 			case *server.WatchEventBestPath:
-				for _, path := range msg.PathList {
-					asPath := path.GetAsPath().String()
-					as, err := strconv.ParseUint(asPath, 10, 32)
-					if err != nil {
-						plugin.Log.Warnf("Ignoring Path '%s' due to parse error: %v", asPath, err)
-						continue
-					}
-					pathInfo := bgp.ReachableIPRoute{
-						As:      uint32(as),
-						Prefix:  path.GetNlri().String(),
-						Nexthop: path.GetNexthop(),
-					}
-					plugin.Log.Debug("Fill channel with new path", pathInfo)
-					for _, callback := range plugin.watchersWithCallbacks {
-						callback(&pathInfo)
-					}
+				plugin.processBestPaths(msg)
+			case *server.WatchEventPeerState:
+				plugin.processPeerState(msg)
+			case *server.WatchEventUpdate:
+				if msg.PostPolicy {
+					plugin.processReceivedPaths(msg)
 				}
+			case *server.WatchEventMessage:
+				plugin.processEndOfRIB(msg)
 			}
 		}
+		plugin.endEventGroup()
 	}
 }
 
-//Close stops dedicated goroutine for watching gobgp. Then stops watcher provider by gobgp server and finally stops that gobgp server itself.
+// processPath translates best path change (<pathInfo> translated from goBGP path stored under <key> in route table)
+// into bgp.RouteEvent and queues it for all registered best path watchers. Path withdrawal is signalled by <isWithdraw>.
+// Changed ECMP next hop set of the prefix is given by <multipath> (nil means that the set didn't change).
+// Watchers are collected together with the change of route table, so that watchers registered later (with RIB snapshot
+// that already contains the change) don't receive the event.
+func (plugin *Plugin) processPath(key string, pathInfo *bgp.ReachableIPRoute, isWithdraw bool, multipath []bgp.MultipathNexthop) {
+	plugin.routesMu.Lock()
+	plugin.setMultipath(key, pathInfo, multipath)
+	event := plugin.toRouteEvent(key, pathInfo, isWithdraw)
+	held := event != nil && plugin.dampen(key, event)
+	watchers := plugin.routeWatcherList(false)
+	plugin.routesMu.Unlock()
+
+	if event == nil {
+		plugin.Log.Debugf("Ignoring withdrawal of unknown prefix %s", pathInfo.Prefix)
+		return
+	}
+	if held {
+		plugin.Log.Debugf("Suppressing %v route event for flapping prefix %s", event.Type, pathInfo.Prefix)
+		return
+	}
+	if plugin.Log.GetLevel() == logging.DebugLevel { // header of log entry is costly even if it is not logged (full table churn)
+		plugin.Log.Debugf("Sending %v route event for %v", event.Type, pathInfo)
+	}
+	for _, watcher := range watchers {
+		watcher.notify(event)
+	}
+}
+
+// routeWatcherList returns all registered route watchers that watch all received paths (<allPaths> is true) or best
+// paths (<allPaths> is false). Caller must hold routesMu.
+func (plugin *Plugin) routeWatcherList(allPaths bool) []*routeWatcher {
+	watchers := make([]*routeWatcher, 0, len(plugin.routeWatchers))
+	for _, watcher := range plugin.routeWatchers {
+		if watcher.allPaths == allPaths {
+			watchers = append(watchers, watcher)
+		}
+	}
+	return watchers
+}
+
+// toRouteEvent classifies best path change for <route> (stored under <key> in route table) against last known best routes
+// and updates them accordingly. Path withdrawal is signalled by <isWithdraw>. Nil is returned for withdrawal of prefix that was never announced.
+// Update to stale route (i.e. marked by long-lived graceful restart) is classified as bgp.RouteStale.
+func (plugin *Plugin) toRouteEvent(key string, route *bgp.ReachableIPRoute, isWithdraw bool) *bgp.RouteEvent {
+	previous, known := plugin.rib.get(key)
+	if isWithdraw {
+		if !known {
+			return nil
+		}
+		plugin.rib.delete(key)
+		return &bgp.RouteEvent{Type: bgp.RouteWithdrawn, Route: route, PreviousRoute: previous}
+	}
+	plugin.rib.put(key, route)
+	if !known {
+		return &bgp.RouteEvent{Type: bgp.RouteAdded, Route: route}
+	}
+	if route.Stale {
+		return &bgp.RouteEvent{Type: bgp.RouteStale, Route: route, PreviousRoute: previous}
+	}
+	return &bgp.RouteEvent{Type: bgp.RouteUpdated, Route: route, PreviousRoute: previous}
+}
+
+//Close stops dedicated goroutine for watching gobgp and cancels scheduled sweeps of stale received paths and pending resynchronization of watchers. Then stops watcher provider by gobgp server and finally stops that gobgp server itself.
 //Close will fail if bgpServer fails to stop.
 func (plugin *Plugin) Close() error {
 	plugin.Log.Info("Closing goBgp plugin ", plugin.PluginName)
 	close(plugin.stopWatch) //command to stop watching
 	plugin.watchWG.Wait()   //wait for actual stop of watching
+	plugin.routesMu.Lock()
+	plugin.stopStaleSweeps()
+	plugin.routesMu.Unlock()
+	if plugin.resync != nil {
+		plugin.resync.timer.Stop()
+	}
+	plugin.closeWatchers()
+	notifications.remove(plugin.notifications)
 	plugin.serverWatcher.Stop()
 	return plugin.server.Stop()
 }
@@ -149,15 +356,210 @@ func (plugin *Plugin) Close() error {
 //WatchIPRoutes register watcher to notifications for any new learned IP-based routes.
 //Watcher have to identify himself by name(<watcher> param) and provide <callback> so that GoBGP can sent information to watcher.
 //WatchIPRoutes returns <bgp.WatchRegistration> as way how to control the watcher-goBGPlugin agreement from the watcher side in the future.
-//It also returns error to indicate failure, but currently for this plugin is not known use case of failure.
-//WatchRegistration is not retroactive, that means that any IP-based routes learned in the past are not send to new watchers.
+//It fails with bgp.ErrNilCallback if <callback> is nil and with bgp.DuplicateWatcherError if route watcher with
+//the same name is already registered. The name can be reused after closing of previous registration.
+//WatchRegistration is not retroactive by default, that means that any IP-based routes learned in the past are not send to new watchers.
 //This also means that if you want be notified of all learned IP-based routes, you must register before calling of
 //AfterInit(). In case of external(=not other plugin started with this plugin) watchers this means before plugin start.
 //However, late-registered watchers are permitted (no error will be returned), but they can miss some learned IP-based routes.
-func (plugin *Plugin) WatchIPRoutes(watcher string, callback func(*bgp.ReachableIPRoute)) (bgp.WatchRegistration, error) {
+//Late-registered watchers can use bgp.WithRIBSnapshot() option to receive all currently reachable routes first.
+//Only announcements (added or updated routes) are passed to <callback>.
+func (plugin *Plugin) WatchIPRoutes(watcher string, callback func(*bgp.ReachableIPRoute), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	if callback == nil {
+		return nil, bgp.ErrNilCallback
+	}
+	return plugin.WatchIPRouteEvents(watcher, func(event *bgp.RouteEvent) {
+		if event.Type == bgp.RouteAdded || event.Type == bgp.RouteUpdated {
+			callback(event.Route)
+		}
+	}, opts...)
+}
+
+//WatchIPRouteEvents register watcher to notifications for any change of IP-based routes (addition, update and withdrawal).
+//Registration semantics are the same as for WatchIPRoutes. If bgp.WithRIBSnapshot() option is used, all currently reachable
+//routes are sent to <callback> (followed by bgp.RIBSnapshotEnd event) before any live update.
+//Events are delivered to <callback> by dedicated goroutine of the watcher through bounded queue (see bgp.WithQueue()),
+//so callback can use any method of plugin (including registration and unregistration of watchers).
+func (plugin *Plugin) WatchIPRouteEvents(watcher string, callback func(*bgp.RouteEvent), opts ...bgp.WatchOption) (bgp.WatchRegistration, error) {
+	if callback == nil {
+		return nil, bgp.ErrNilCallback
+	}
 	plugin.Log.Infof("Watcher %s registering for watching of IPRoutes in %s.", watcher, plugin.PluginName)
-	plugin.watchersWithCallbacks[watcherName(watcher)] = callback
-	return &watchRegistration{watcher: watcherName(watcher), plugin: plugin}, nil
+	options := bgp.NewWatchOptions(opts...)
+	return plugin.registerRouteWatcher(watcher, options, func() *deliveryQueue {
+		return newRouteEventQueue(options, callback)
+	})
+}
+
+// registerRouteWatcher registers route <watcher> with given <options> whose events are delivered through queue created
+// by <newQueue> (called only if the registration succeeds).
+func (plugin *Plugin) registerRouteWatcher(watcher string, options *bgp.WatchOptions, newQueue func() *deliveryQueue) (bgp.WatchRegistration, error) {
+	var load *receivedPathsLoad
+	if options.AllPaths {
+		plugin.pathsLoadMu.Lock()
+		defer plugin.pathsLoadMu.Unlock()
+		load = plugin.loadReceivedPaths()
+	}
+	plugin.routesMu.Lock()
+	defer plugin.routesMu.Unlock()
+	if load != nil {
+		defer func() { plugin.pathsLoad = nil }() // also if registration fails
+	}
+	if _, found := plugin.routeWatchers[watcherName(watcher)]; found {
+		return nil, &bgp.DuplicateWatcherError{Watcher: watcher}
+	}
+	vrf, err := plugin.vrfFilter(options.Vrf)
+	if err != nil {
+		return nil, err
+	}
+	registered := &routeWatcher{
+		registrationInfo: plugin.newRegistrationInfo(),
+		filter:           options.Filter,
+		vrf:              vrf,
+		vrfName:          options.Vrf,
+		allPaths:         options.AllPaths,
+		queue:            newQueue(),
+	}
+	registration := &watchRegistration{watcher: watcherName(watcher), plugin: plugin, registered: registered}
+	registered.queue.epoch = plugin.currentEpoch
+	registered.queue.onDisconnect = func() {
+		plugin.Log.Warnf("Watcher %s disconnected, because it didn't keep up with route changes", watcher)
+		registration.Close()
+	}
+	if load != nil {
+		plugin.trackReceivedPaths(load)
+	}
+	if options.RIBSnapshot {
+		plugin.sendRIBSnapshot(registered, snapshotEnd)
+	}
+	plugin.routeWatchers[watcherName(watcher)] = registered
+	return registration, nil
+}
+
+//WatchIPRoutesContext register watcher to notifications for any change of IP-based routes that are sent to returned
+//event channel until <ctx> is cancelled. Then the watcher is unregistered and both returned channels are closed.
+//Error channel receives failure of registration. Registration semantics are the same as for WatchIPRouteEvents.
+func (plugin *Plugin) WatchIPRoutesContext(ctx context.Context, watcher string, opts ...bgp.WatchOption) (<-chan bgp.RouteEvent, <-chan error) {
+	return bgp.WatchContext(ctx, plugin, watcher, opts...)
+}
+
+// snapshotMarkers tells which markers enclose snapshot of known routes sent to watcher.
+type snapshotMarkers int
+
+const (
+	snapshotEnd    snapshotMarkers = iota // snapshot is followed by bgp.RIBSnapshotEnd
+	resyncStartEnd                        // snapshot is enclosed in bgp.ResyncStart and bgp.ResyncEnd
+	resyncStart                           // snapshot is preceded by bgp.ResyncStart, bgp.ResyncEnd is sent later (see pendingResync)
+)
+
+// sendRIBSnapshot queues all currently reachable routes (ordered by prefix and passing watcher's filter) as bgp.RouteAdded
+// events for <watcher> and marks the end of snapshot by bgp.RIBSnapshotEnd event. Watcher of all paths receives all
+// currently received paths instead (see receivedPathList()). Routes of prefixes suppressed by dampening are sent as they are
+// known to best path watchers (see deliveredRoutes()). Snapshot sent for resynchronization of watcher is enclosed
+// in bgp.ResyncStart and bgp.ResyncEnd <markers> instead. Caller must hold routesMu, so that no route change can
+// happen between snapshot and registration of watcher.
+func (plugin *Plugin) sendRIBSnapshot(watcher *routeWatcher, markers snapshotMarkers) {
+	routes := plugin.deliveredRoutes()
+	if watcher.allPaths {
+		routes = plugin.receivedPathList()
+	}
+	events := make([]interface{}, 0, len(routes)+2)
+	if markers != snapshotEnd {
+		events = append(events, &bgp.RouteEvent{Type: bgp.ResyncStart})
+	}
+	for _, route := range routes {
+		if event := watcher.filterEvent(&bgp.RouteEvent{Type: bgp.RouteAdded, Route: route}); event != nil {
+			events = append(events, event)
+		}
+	}
+	switch markers {
+	case snapshotEnd:
+		events = append(events, &bgp.RouteEvent{Type: bgp.RIBSnapshotEnd})
+	case resyncStartEnd:
+		events = append(events, &bgp.RouteEvent{Type: bgp.ResyncEnd})
+	}
+	watcher.queue.pushAll(events)
+}
+
+//WatcherStats returns statistics of event delivery to route <watcher>. Found is false if there is no such registered watcher.
+func (plugin *Plugin) WatcherStats(watcher string) (stats bgp.WatchStats, found bool) {
+	plugin.routesMu.Lock()
+	registered, found := plugin.routeWatchers[watcherName(watcher)]
+	plugin.routesMu.Unlock()
+	if !found {
+		return bgp.WatchStats{}, false
+	}
+	return registered.queue.statistics(), true
+}
+
+//ListWatchers returns all currently registered route, peer state, EVPN and FlowSpec watchers (ordered by registration ID)
+//with their registration time and delivery statistics.
+func (plugin *Plugin) ListWatchers() []bgp.WatcherInfo {
+	var watchers []bgp.WatcherInfo
+	plugin.routesMu.Lock()
+	for name, watcher := range plugin.routeWatchers {
+		watchers = append(watchers, toWatcherInfo(name, bgp.RouteWatcherKind, watcher.registrationInfo, watcher.queue))
+	}
+	plugin.routesMu.Unlock()
+
+	plugin.peersMu.Lock()
+	for name, watcher := range plugin.peerStateWatchers {
+		watchers = append(watchers, toWatcherInfo(name, bgp.PeerStateWatcherKind, watcher.registrationInfo, watcher.queue))
+	}
+	plugin.peersMu.Unlock()
+
+	plugin.evpnMu.Lock()
+	for name, watcher := range plugin.evpnWatchers {
+		watchers = append(watchers, toWatcherInfo(name, bgp.EVPNWatcherKind, watcher.registrationInfo, watcher.queue))
+	}
+	plugin.evpnMu.Unlock()
+
+	plugin.flowSpecMu.Lock()
+	for name, watcher := range plugin.flowSpecWatchers {
+		watchers = append(watchers, toWatcherInfo(name, bgp.FlowSpecWatcherKind, watcher.registrationInfo, watcher.queue))
+	}
+	plugin.flowSpecMu.Unlock()
+
+	sort.Slice(watchers, func(i, j int) bool { return watchers[i].ID < watchers[j].ID })
+	return watchers
+}
+
+// toWatcherInfo describes registered watcher (of given <name> and <kind>) for watcher introspection.
+func toWatcherInfo(name watcherName, kind bgp.WatcherKind, info registrationInfo, queue *deliveryQueue) bgp.WatcherInfo {
+	return bgp.WatcherInfo{
+		ID:           info.id,
+		Name:         string(name),
+		Kind:         kind,
+		RegisteredAt: info.registeredAt,
+		Stats:        queue.statistics(),
+	}
+}
+
+// closeWatchers closes delivery queues of all registered watchers.
+func (plugin *Plugin) closeWatchers() {
+	plugin.routesMu.Lock()
+	for _, watcher := range plugin.routeWatchers {
+		watcher.queue.close()
+	}
+	plugin.routesMu.Unlock()
+
+	plugin.peersMu.Lock()
+	for _, watcher := range plugin.peerStateWatchers {
+		watcher.queue.close()
+	}
+	plugin.peersMu.Unlock()
+
+	plugin.evpnMu.Lock()
+	for _, watcher := range plugin.evpnWatchers {
+		watcher.queue.close()
+	}
+	plugin.evpnMu.Unlock()
+
+	plugin.flowSpecMu.Lock()
+	for _, watcher := range plugin.flowSpecWatchers {
+		watcher.queue.close()
+	}
+	plugin.flowSpecMu.Unlock()
 }
 
 //startSession starts session on already running goBGP server. It fails when start of goBGP server fails.
@@ -182,15 +584,28 @@ func (plugin *Plugin) addKnownNeighbors() error {
 }
 
 // watchRegistration is Plugin's simple WatchRegistration implementation that is sent to watchers.
-// This implementation is not thread-safe.
 type watchRegistration struct {
-	watcher watcherName
-	plugin  *Plugin
+	watcher    watcherName
+	plugin     *Plugin
+	registered *routeWatcher
 }
 
-//Close ends the agreement between Plugin and watcher. Plugin stops sending watcher any further notifications.
+//ID returns unique identification of the registration.
+func (wr *watchRegistration) ID() uint64 {
+	return wr.registered.id
+}
+
+//Close ends the agreement between Plugin and watcher. Plugin stops sending watcher any further notifications
+//(events waiting in watcher's queue are dropped). Repeated Close does nothing and Close never unregisters newer
+//registration of watcher with the same name.
 //It returns failure, but current goBGP implementation doesn't have failure use case.
 func (wr *watchRegistration) Close() error {
-	delete(wr.plugin.watchersWithCallbacks, wr.watcher)
+	wr.plugin.routesMu.Lock()
+	defer wr.plugin.routesMu.Unlock()
+	if wr.plugin.routeWatchers[wr.watcher] == wr.registered {
+		delete(wr.plugin.routeWatchers, wr.watcher)
+		wr.plugin.untrackReceivedPaths()
+	}
+	wr.registered.queue.close()
 	return nil
 }
@@ -26,6 +26,7 @@ import (
 	bgpPacket "github.com/osrg/gobgp/packet/bgp"
 	"github.com/osrg/gobgp/server"
 	"github.com/osrg/gobgp/table"
+	"net"
 	"sync"
 	"testing"
 	"time"
@@ -37,6 +38,18 @@ const (
 	prefix1                 string = "10.0.0.0"
 	prefix2                 string = "10.0.0.2"
 	prefixMaskLength        uint8  = 24
+	med                     uint32 = 100
+	community               uint32 = 65000<<16 | 10
+	unknownAttrType         uint8  = 250
+	ipv6NextHop             string = "2001:db8::1"
+	ipv6Prefix              string = "2001:db8:1::"
+	ipv6PrefixMaskLength    uint8  = 64
+	announcedPrefix         string = "10.20.0.0/16"
+	announcedNextHop        string = "10.0.0.5"
+	announcedAsPathPrepend  uint8  = 2
+	vrfName                 string = "tenant1"
+	vrfRouteDistinguisher   string = "65000:100"
+	vrfRouteTarget          string = "65000:100"
 	expectedReceivedAs             = uint32(65000)
 	maxSessionEstablishment        = 2 * time.Minute
 	timeoutForReceiving            = 30 * time.Second
@@ -58,9 +71,13 @@ type Variables struct {
 	routeReflector        *server.BgpServer
 	goBGPPlugin           *gobgp.Plugin
 	dataChannel           chan bgp.ReachableIPRoute
+	eventChannel          chan bgp.RouteEvent
+	lateEventChannel      chan bgp.RouteEvent
+	peerStateChannel      chan bgp.PeerStateEvent
 	lifecycleCloseChannel chan struct{}
 	lifecycleWG           sync.WaitGroup
 	watchRegistration     bgp.WatchRegistration
+	announcementHandle    bgp.AnnouncementHandle
 }
 
 // Given is composition of multiple test step methods (see BDD Given keyword)
@@ -92,6 +109,9 @@ func (t *TestHelper) DefaultSetup() {
 
 	// initialize data channel
 	t.vars.dataChannel = make(chan bgp.ReachableIPRoute, 10)
+	t.vars.eventChannel = make(chan bgp.RouteEvent, 10)
+	t.vars.lateEventChannel = make(chan bgp.RouteEvent, 10)
+	t.vars.peerStateChannel = make(chan bgp.PeerStateEvent, 10)
 }
 
 // Teardown handles properly releasing of resources or stopping of components (route reflector, agent with plugins)
@@ -155,6 +175,42 @@ func (g *Given) GoBGPPluginWithWatcher() {
 	}
 }
 
+// GoBGPPluginWithEventWatcher creates GoBGPPlugin (with route event watcher registered in it) and prepares it for usage
+// the same way as GoBGPPluginWithWatcher does.
+func (g *Given) GoBGPPluginWithEventWatcher() {
+	g.createGoBGPPlugin()
+
+	var registrationErr error
+	g.vars.watchRegistration, registrationErr = g.vars.goBGPPlugin.WatchIPRouteEvents("TestEventWatcher", func(event *bgp.RouteEvent) {
+		g.vars.eventChannel <- *event
+	})
+	Expect(registrationErr).To(BeNil(), "Can't properly register to watch IP route events")
+	Expect(g.vars.watchRegistration).NotTo(BeNil(), "WatchRegistration must be non-nil to be able to close registration later")
+
+	g.startPluginLifecycle()
+	if g.vars.routeReflector != nil {
+		g.waitForSessionEstablishment()
+	}
+}
+
+// GoBGPPluginWithPeerStateWatcher creates GoBGPPlugin (with peer state watcher registered in it) and prepares it for usage
+// the same way as GoBGPPluginWithWatcher does.
+func (g *Given) GoBGPPluginWithPeerStateWatcher() {
+	g.createGoBGPPlugin()
+
+	var registrationErr error
+	g.vars.watchRegistration, registrationErr = g.vars.goBGPPlugin.WatchPeerState("TestPeerStateWatcher", func(event *bgp.PeerStateEvent) {
+		g.vars.peerStateChannel <- *event
+	})
+	Expect(registrationErr).To(BeNil(), "Can't properly register to watch peer state")
+	Expect(g.vars.watchRegistration).NotTo(BeNil(), "WatchRegistration must be non-nil to be able to close registration later")
+
+	g.startPluginLifecycle()
+	if g.vars.routeReflector != nil {
+		g.waitForSessionEstablishment()
+	}
+}
+
 // waitForSessionEstablishment waits until it is possible to work with server correctly after start. Many commands depends on session being correctly established.
 func (g *Given) waitForSessionEstablishment() {
 	timeChan := time.NewTimer(maxSessionEstablishment).C
@@ -198,12 +254,124 @@ func (w *When) AddNewRoute() {
 	Expect(w.addNewRoute(prefix1, nextHop1, prefixMaskLength)).To(BeNil(), "Can't add new route")
 }
 
+// AddNewIPv6Route adds constant-based IPv6 route to route reflector and asserts success.
+func (w *When) AddNewIPv6Route() {
+	prefix := bgpPacket.NewIPv6AddrPrefix(ipv6PrefixMaskLength, ipv6Prefix)
+	attrs := []bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(0),
+		bgpPacket.NewPathAttributeMpReachNLRI(ipv6NextHop, []bgpPacket.AddrPrefixInterface{prefix}),
+	}
+
+	_, err := w.vars.routeReflector.AddPath("",
+		[]*table.Path{table.NewPath(nil, prefix, false, attrs, time.Now(), false)})
+	Expect(err).To(BeNil(), "Can't add new IPv6 route")
+}
+
+// AddNewRouteWithPathAttributes adds first constant-based route to route reflector. Route has beside mandatory attributes also
+// MED, communities of all kinds and one unknown optional transitive attribute. Success of addition is asserted.
+func (w *When) AddNewRouteWithPathAttributes() {
+	attrs := []bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(bgpPacket.BGP_ORIGIN_ATTR_TYPE_INCOMPLETE),
+		bgpPacket.NewPathAttributeNextHop(nextHop1),
+		bgpPacket.NewPathAttributeMultiExitDisc(med),
+		bgpPacket.NewPathAttributeCommunities([]uint32{community}),
+		bgpPacket.NewPathAttributeExtendedCommunities([]bgpPacket.ExtendedCommunityInterface{
+			bgpPacket.NewTwoOctetAsSpecificExtended(bgpPacket.EC_SUBTYPE_ROUTE_TARGET, 65000, 100, true),
+		}),
+		bgpPacket.NewPathAttributeLargeCommunities([]*bgpPacket.LargeCommunity{bgpPacket.NewLargeCommunity(65000, 1, 2)}),
+		&bgpPacket.PathAttributeUnknown{PathAttribute: bgpPacket.PathAttribute{
+			Flags:  bgpPacket.BGP_ATTR_FLAG_OPTIONAL | bgpPacket.BGP_ATTR_FLAG_TRANSITIVE,
+			Type:   bgpPacket.BGPAttrType(unknownAttrType),
+			Length: 3,
+			Value:  []byte{1, 2, 3},
+		}},
+	}
+
+	_, err := w.vars.routeReflector.AddPath("",
+		[]*table.Path{table.NewPath(nil, bgpPacket.NewIPAddrPrefix(prefixMaskLength, prefix1), false, attrs, time.Now(), false)})
+	Expect(err).To(BeNil(), "Can't add new route")
+}
+
+// LateWatcherRegistersWithRIBSnapshot registers another route event watcher to already running GoBGPPlugin. Watcher asks
+// for snapshot of already learned routes.
+func (w *When) LateWatcherRegistersWithRIBSnapshot() {
+	_, err := w.vars.goBGPPlugin.WatchIPRouteEvents("TestLateWatcher", func(event *bgp.RouteEvent) {
+		w.vars.lateEventChannel <- *event
+	}, bgp.WithRIBSnapshot())
+	Expect(err).To(BeNil(), "Can't properly register to watch IP route events")
+}
+
 // StopWatchingAndAddNewRoute closes watch registration and adds second constant-based route to route reflector. For both actions success is asserted.
 func (w *When) StopWatchingAndAddNewRoute() {
 	Expect(w.vars.watchRegistration.Close()).To(BeNil(), "Closing registration failed")
 	Expect(w.addNewRoute(prefix2, nextHop2, prefixMaskLength)).To(BeNil(), "Can't add new route")
 }
 
+// WatcherReRegistersAfterRepeatedClose closes watch registration twice, registers watcher with the same name again and
+// then closes the old registration once more. New registration must get new ID and it must survive closing of the old one.
+func (w *When) WatcherReRegistersAfterRepeatedClose() {
+	oldRegistration := w.vars.watchRegistration
+	Expect(oldRegistration.Close()).To(BeNil(), "Closing registration failed")
+	Expect(oldRegistration.Close()).To(BeNil(), "Repeated closing of registration failed")
+
+	var registrationErr error
+	w.vars.watchRegistration, registrationErr = w.vars.goBGPPlugin.WatchIPRoutes("TestWatcher", bgp.ToChan(w.vars.dataChannel, logroot.StandardLogger()))
+	Expect(registrationErr).To(BeNil(), "Can't register watcher with name of closed registration")
+	Expect(w.vars.watchRegistration.ID()).NotTo(Equal(oldRegistration.ID()))
+	Expect(oldRegistration.Close()).To(BeNil(), "Repeated closing of registration failed")
+}
+
+// PluginAddsVrf configures constant-based VRF in GoBGP plugin and asserts success. Plugin is started asynchronously by agent,
+// therefore the addition is retried until the plugin is started (timeoutForReceiving constant).
+func (w *When) PluginAddsVrf() {
+	Eventually(func() error {
+		return w.vars.goBGPPlugin.AddVrf(gobgp.Vrf{
+			Name:               vrfName,
+			ID:                 1,
+			RouteDistinguisher: vrfRouteDistinguisher,
+			ImportRouteTargets: []string{vrfRouteTarget},
+			ExportRouteTargets: []string{vrfRouteTarget},
+		})
+	}, timeoutForReceiving).Should(BeNil(), "Can't add VRF")
+}
+
+// PluginDeletesVrf removes constant-based VRF from GoBGP plugin and asserts success.
+func (w *When) PluginDeletesVrf() {
+	Expect(w.vars.goBGPPlugin.DeleteVrf(vrfName)).To(BeNil(), "Can't delete VRF")
+}
+
+// RouteReflectorShutsDownSession administratively shuts down session of route reflector with GoBGP plugin
+// (route reflector sends CEASE NOTIFICATION message) and asserts success.
+func (w *When) RouteReflectorShutsDownSession() {
+	Expect(w.vars.routeReflector.ShutdownNeighbor(serverConf.Neighbors[0].Config.NeighborAddress, "")).To(BeNil(), "Can't shut down session")
+}
+
+// PluginAnnouncesRoute announces constant-based prefix via constant-based next hop (with MED, community and AS path prepending) by GoBGP plugin
+// and asserts success.
+func (w *When) PluginAnnouncesRoute() {
+	announcedMed := med
+	var err error
+	w.vars.announcementHandle, err = w.vars.goBGPPlugin.Announce(bgp.Announcement{
+		Prefix:        announcedPrefix,
+		Nexthop:       net.ParseIP(announcedNextHop),
+		Communities:   []bgp.Community{bgp.Community(community)},
+		Med:           &announcedMed,
+		AsPathPrepend: announcedAsPathPrepend,
+	})
+	Expect(err).To(BeNil(), "Can't announce route")
+	Expect(w.vars.announcementHandle).NotTo(BeNil(), "AnnouncementHandle must be non-nil to be able to withdraw route later")
+}
+
+// PluginWithdrawsAnnouncedRoute withdraws route previously announced by GoBGP plugin and asserts success.
+func (w *When) PluginWithdrawsAnnouncedRoute() {
+	Expect(w.vars.announcementHandle.Withdraw()).To(BeNil(), "Can't withdraw announced route")
+}
+
+// WithdrawAddedRoute withdraws first constant-based route from route reflector and asserts success.
+func (w *When) WithdrawAddedRoute() {
+	Expect(w.withdrawRoute(prefix1, nextHop1, prefixMaskLength)).To(BeNil(), "Can't withdraw route")
+}
+
 // addNewRoute adds route to Route reflector.
 // New route is defined by <prefix>(full IPv4 address as string) with
 // <prefixMaskLength>(count of bit of network mask for prefix) and <nextHop>(full IPv4 address as string).
@@ -227,6 +395,26 @@ func (w *When) addNewRoute(prefix string, nextHop string, prefixMaskLength uint8
 	return err
 }
 
+// withdrawRoute withdraws route (defined the same way as in addNewRoute) from Route reflector.
+// It returns nonnill error if withdrawal was not successful.
+func (w *When) withdrawRoute(prefix string, nextHop string, prefixMaskLength uint8) error {
+	attrs := []bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(0),
+		bgpPacket.NewPathAttributeNextHop(nextHop),
+	}
+
+	return w.vars.routeReflector.DeletePath(nil, bgpPacket.RF_IPv4_UC, "",
+		[]*table.Path{table.NewPath(
+			nil,
+			bgpPacket.NewIPAddrPrefix(prefixMaskLength, prefix),
+			true,
+			attrs,
+			time.Now(),
+			false),
+		},
+	)
+}
+
 // WatcherReceivesNothing is timeout-based wait to assert that nothing comes to watcher by watcher data flow source. Timeout can be changed by changing the timeoutForNotReceiving constant.
 func (t *Then) WatcherReceivesNothing() {
 	timeChan := time.NewTimer(timeoutForNotReceiving).C
@@ -254,6 +442,7 @@ func (t *Then) WatcherReceivesAddedRoute() {
 			logroot.StandardLogger().Debug("Agent received new route ", receivedRoute)
 
 			Expect(receivedRoute.As).To(Equal(expectedReceivedAs))
+			Expect(receivedRoute.AsPath.NeighborAs()).To(Equal(expectedReceivedAs))
 			Expect(receivedRoute.Nexthop.String()).To(Equal(nextHop1))
 			Expect(receivedRoute.Prefix).To(Equal(prefix1 + "/24"))
 			return
@@ -261,6 +450,289 @@ func (t *Then) WatcherReceivesAddedRoute() {
 	}
 }
 
+// WatcherReceivesAddedIPv6Route waits for received route and then checks that it is IPv6 unicast route previously added
+// to route reflector. If nothing comes in timeout (timeoutForReceiving constant), test fails.
+func (t *Then) WatcherReceivesAddedIPv6Route() {
+	select {
+	case <-time.After(timeoutForReceiving):
+		t.vars.golangT.Fatal("Channel didn't received any route, but it should have.")
+	case receivedRoute := <-t.vars.dataChannel:
+		logroot.StandardLogger().Debug("Agent received new route ", receivedRoute)
+
+		Expect(receivedRoute.Family).To(Equal(bgp.IPv6Unicast))
+		Expect(receivedRoute.Prefix).To(Equal(ipv6Prefix + "/64"))
+		Expect(receivedRoute.As).To(Equal(expectedReceivedAs))
+		Expect(receivedRoute.Nexthop.String()).To(Equal(ipv6NextHop))
+	}
+}
+
+// WatcherReceivesRouteWithPathAttributes waits for received route and then checks that path attributes of route previously
+// added by AddNewRouteWithPathAttributes are correctly passed. If nothing comes in timeout (timeoutForReceiving constant), test fails.
+func (t *Then) WatcherReceivesRouteWithPathAttributes() {
+	select {
+	case <-time.After(timeoutForReceiving):
+		t.vars.golangT.Fatal("Channel didn't received any route, but it should have.")
+	case receivedRoute := <-t.vars.dataChannel:
+		logroot.StandardLogger().Debug("Agent received new route ", receivedRoute)
+
+		attrs := receivedRoute.Attributes
+		Expect(attrs.Origin).To(Equal(bgp.OriginIncomplete))
+		Expect(attrs.Med).NotTo(BeNil())
+		Expect(*attrs.Med).To(Equal(med))
+		Expect(attrs.LocalPref).To(BeNil()) // local preference is not sent over eBGP session
+		Expect(attrs.Communities).To(Equal([]bgp.Community{bgp.Community(community)}))
+		Expect(attrs.ExtendedCommunities).To(HaveLen(1))
+		Expect(attrs.ExtendedCommunities[0].String()).To(Equal("0x00:0x02:0xfde800000064"))
+		Expect(attrs.LargeCommunities).To(Equal([]bgp.LargeCommunity{{GlobalAdmin: 65000, LocalData1: 1, LocalData2: 2}}))
+		Expect(attrs.Other).To(HaveLen(1))
+		Expect(attrs.Other[0].Type).To(Equal(unknownAttrType))
+		Expect(attrs.Other[0].IsTransitive()).To(BeTrue())
+		Expect(attrs.Other[0].Value).To(Equal([]byte{1, 2, 3}))
+	}
+}
+
+// EventWatcherReceivesAddedRoute waits for route event and checks that it is addition of first constant-based route.
+// If nothing comes in timeout (timeoutForReceiving constant), test fails.
+func (t *Then) EventWatcherReceivesAddedRoute() {
+	event := t.receiveEvent()
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.PreviousRoute).To(BeNil())
+	Expect(event.Route.Nexthop.String()).To(Equal(nextHop1))
+	Expect(event.Route.Prefix).To(Equal(prefix1 + "/24"))
+}
+
+// EventWatcherReceivesWithdrawnRoute waits for route event and checks that it is withdrawal of first constant-based route
+// that carries previously announced route. If nothing comes in timeout (timeoutForReceiving constant), test fails.
+func (t *Then) EventWatcherReceivesWithdrawnRoute() {
+	event := t.receiveEvent()
+	Expect(event.Type).To(Equal(bgp.RouteWithdrawn))
+	Expect(event.Route.Prefix).To(Equal(prefix1 + "/24"))
+	Expect(event.PreviousRoute).NotTo(BeNil())
+	Expect(event.PreviousRoute.Nexthop.String()).To(Equal(nextHop1))
+}
+
+// LateWatcherReceivesRIBSnapshot checks that late-registered watcher received snapshot with first constant-based route
+// and that the snapshot is terminated by snapshot end marker. If snapshot doesn't come in timeout (timeoutForReceiving constant),
+// test fails.
+func (t *Then) LateWatcherReceivesRIBSnapshot() {
+	Eventually(t.vars.lateEventChannel, timeoutForReceiving).Should(HaveLen(2))
+	event := <-t.vars.lateEventChannel
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Prefix).To(Equal(prefix1 + "/24"))
+	Expect(event.Route.Nexthop.String()).To(Equal(nextHop1))
+	event = <-t.vars.lateEventChannel
+	Expect(event.Type).To(Equal(bgp.RIBSnapshotEnd))
+	Expect(event.Route).To(BeNil())
+}
+
+// PeerStateWatcherReceivesEstablishedSession waits for peer state event and checks that it is establishment of session
+// with route reflector. If nothing comes in timeout (timeoutForReceiving constant), test fails.
+func (t *Then) PeerStateWatcherReceivesEstablishedSession() {
+	event := t.receivePeerStateEvent()
+	Expect(event.PeerAddress.String()).To(Equal(serverConf.Neighbors[0].Config.NeighborAddress))
+	Expect(event.PeerAs).To(Equal(expectedReceivedAs))
+	Expect(event.RouterID.String()).To(Equal(routeReflectorConf.Global.Config.RouterId))
+	Expect(event.OldState).NotTo(Equal(bgp.SessionEstablished))
+	Expect(event.NewState).To(Equal(bgp.SessionEstablished))
+	Expect(event.AdminState).To(Equal(bgp.AdminStateUp))
+	Expect(event.Timestamp.IsZero()).To(BeFalse())
+}
+
+// PeerStateWatcherReceivesSessionShutdown waits for peer state event and checks that it is loss of established session caused
+// by administrative shutdown. If nothing comes in timeout (timeoutForReceiving constant), test fails.
+func (t *Then) PeerStateWatcherReceivesSessionShutdown() {
+	event := t.receivePeerStateEvent()
+	Expect(event.OldState).To(Equal(bgp.SessionEstablished))
+	Expect(event.NewState).NotTo(Equal(bgp.SessionEstablished))
+	Expect(event.LastNotification).To(Equal(&bgp.Notification{
+		Code:    bgpPacket.BGP_ERROR_CEASE,
+		Subcode: bgpPacket.BGP_ERROR_SUB_ADMINISTRATIVE_SHUTDOWN,
+	}))
+}
+
+// RouteReaderFindsAddedRoute checks that first constant-based route (already received by watcher) can be read from GoBGP plugin
+// by listing of routes, by its exact prefix and by longest prefix match of address from the prefix.
+func (t *Then) RouteReaderFindsAddedRoute() {
+	routes := t.vars.goBGPPlugin.Routes()
+	Expect(routes).To(HaveLen(1))
+	Expect(routes[0].Prefix).To(Equal(prefix1 + "/24"))
+	Expect(t.vars.goBGPPlugin.Routes(bgp.IPv6Unicast)).To(BeEmpty())
+
+	route, found, err := t.vars.goBGPPlugin.Route(prefix1 + "/24")
+	Expect(err).To(BeNil())
+	Expect(found).To(BeTrue())
+	Expect(route.Nexthop.String()).To(Equal(nextHop1))
+	_, found, err = t.vars.goBGPPlugin.Route(prefix1 + "/16")
+	Expect(err).To(BeNil())
+	Expect(found).To(BeFalse())
+
+	route, found = t.vars.goBGPPlugin.LookupRoute(net.ParseIP(prefix2))
+	Expect(found).To(BeTrue())
+	Expect(route.Prefix).To(Equal(prefix1 + "/24"))
+	_, found = t.vars.goBGPPlugin.LookupRoute(net.ParseIP("192.168.0.1"))
+	Expect(found).To(BeFalse())
+}
+
+// RouteReflectorReceivesAnnouncedRoute waits until route reflector learns the route announced by GoBGP plugin and checks
+// its path attributes. If route doesn't come in timeout (timeoutForReceiving constant), test fails.
+func (t *Then) RouteReflectorReceivesAnnouncedRoute() {
+	var path *table.Path
+	Eventually(func() *table.Path {
+		path = t.routeReflectorBestPath(announcedPrefix)
+		return path
+	}, timeoutForReceiving, time.Second).ShouldNot(BeNil(), "Route reflector didn't receive announced route")
+
+	localAs := serverConf.Global.Config.As
+	Expect(path.GetAsList()).To(Equal([]uint32{localAs, localAs, localAs})) // prepended twice + eBGP prepending
+	Expect(path.GetNexthop().String()).To(Equal(announcedNextHop))
+	Expect(path.GetCommunities()).To(Equal([]uint32{community}))
+	receivedMed, err := path.GetMed()
+	Expect(err).To(BeNil())
+	Expect(receivedMed).To(Equal(med))
+}
+
+// RouteReflectorLosesAnnouncedRoute waits until route reflector forgets the route withdrawn by GoBGP plugin.
+// If route is not withdrawn in timeout (timeoutForReceiving constant), test fails.
+func (t *Then) RouteReflectorLosesAnnouncedRoute() {
+	Eventually(func() *table.Path {
+		return t.routeReflectorBestPath(announcedPrefix)
+	}, timeoutForReceiving, time.Second).Should(BeNil(), "Route reflector didn't lose withdrawn route")
+}
+
+// routeReflectorBestPath returns best path of route reflector for IPv4 <prefix> or nil if route reflector doesn't know the prefix.
+func (t *Then) routeReflectorBestPath(prefix string) *table.Path {
+	rib, err := t.vars.routeReflector.GetRib("", bgpPacket.RF_IPv4_UC, nil)
+	Expect(err).To(BeNil())
+	if destination, found := rib.GetDestinations()[prefix]; found {
+		return destination.GetBestPath("")
+	}
+	return nil
+}
+
+// NeighborsContainEstablishedRouteReflector checks that GoBGP plugin lists route reflector as its only neighbor with established session.
+// Session establishment is waited for (timeoutForReceiving constant), because route reflector can see the session established sooner.
+func (t *Then) NeighborsContainEstablishedRouteReflector() {
+	var neighbors []gobgp.NeighborStatus
+	Eventually(func() bgp.SessionState {
+		var err error
+		neighbors, err = t.vars.goBGPPlugin.Neighbors()
+		Expect(err).To(BeNil())
+		Expect(neighbors).To(HaveLen(1))
+		return neighbors[0].SessionState
+	}, timeoutForReceiving, time.Second).Should(Equal(bgp.SessionEstablished))
+	Expect(neighbors[0].Address.String()).To(Equal(serverConf.Neighbors[0].Config.NeighborAddress))
+	Expect(neighbors[0].PeerAs).To(Equal(expectedReceivedAs))
+	Expect(neighbors[0].RouterID.String()).To(Equal(routeReflectorConf.Global.Config.RouterId))
+	Expect(neighbors[0].AdminState).To(Equal(bgp.AdminStateUp))
+	Expect(neighbors[0].Uptime.IsZero()).To(BeFalse())
+}
+
+// AddingOfDuplicateNeighborFails checks that GoBGP plugin refuses to add neighbor with address of already configured neighbor.
+func (t *Then) AddingOfDuplicateNeighborFails() {
+	err := t.vars.goBGPPlugin.AddNeighbor(serverConf.Neighbors[0])
+	Expect(err).To(BeAssignableToTypeOf(&gobgp.NeighborExistsError{}))
+}
+
+// ManagingOfUnknownNeighborFails checks that GoBGP plugin refuses to manage neighbor that is not configured and to manage
+// neighbor given by invalid address.
+func (t *Then) ManagingOfUnknownNeighborFails() {
+	const unknownNeighbor = "127.0.0.2"
+	Expect(t.vars.goBGPPlugin.DeleteNeighbor(unknownNeighbor)).To(BeAssignableToTypeOf(&gobgp.NeighborNotFoundError{}))
+	Expect(t.vars.goBGPPlugin.DisableNeighbor(unknownNeighbor, "")).To(BeAssignableToTypeOf(&gobgp.NeighborNotFoundError{}))
+	Expect(t.vars.goBGPPlugin.SoftResetNeighbor(unknownNeighbor)).To(BeAssignableToTypeOf(&gobgp.NeighborNotFoundError{}))
+	Expect(t.vars.goBGPPlugin.UpdateNeighbor(config.Neighbor{Config: config.NeighborConfig{
+		NeighborAddress: unknownNeighbor,
+		PeerAs:          expectedReceivedAs,
+	}})).To(BeAssignableToTypeOf(&gobgp.NeighborNotFoundError{}))
+	Expect(t.vars.goBGPPlugin.ResetNeighbor("not-an-address", "")).NotTo(BeNil())
+}
+
+// DuplicateWatcherRegistrationFails checks that GoBGP plugin refuses registration of watcher with name of already registered watcher.
+func (t *Then) DuplicateWatcherRegistrationFails() {
+	_, err := t.vars.goBGPPlugin.WatchIPRouteEvents("TestWatcher", func(event *bgp.RouteEvent) {})
+	Expect(err).To(BeAssignableToTypeOf(&bgp.DuplicateWatcherError{}))
+}
+
+// RegistrationWithoutCallbackFails checks that GoBGP plugin refuses registration of watchers without callback.
+func (t *Then) RegistrationWithoutCallbackFails() {
+	_, err := t.vars.goBGPPlugin.WatchIPRoutes("TestNilWatcher", nil)
+	Expect(err).To(Equal(bgp.ErrNilCallback))
+	_, err = t.vars.goBGPPlugin.WatchIPRouteEvents("TestNilWatcher", nil)
+	Expect(err).To(Equal(bgp.ErrNilCallback))
+	_, err = t.vars.goBGPPlugin.WatchPeerState("TestNilWatcher", nil)
+	Expect(err).To(Equal(bgp.ErrNilCallback))
+}
+
+// ListedWatchersContainOnlyRegisteredWatcher checks that the only watcher listed by GoBGP plugin is the watcher
+// of the current watch registration.
+func (t *Then) ListedWatchersContainOnlyRegisteredWatcher() {
+	watchers := t.vars.goBGPPlugin.ListWatchers()
+	Expect(watchers).To(HaveLen(1))
+	Expect(watchers[0].ID).To(Equal(t.vars.watchRegistration.ID()))
+	Expect(watchers[0].Name).To(Equal("TestWatcher"))
+	Expect(watchers[0].Kind).To(Equal(bgp.RouteWatcherKind))
+	Expect(watchers[0].RegisteredAt.IsZero()).To(BeFalse())
+}
+
+// VrfIsConfigured checks that constant-based VRF is listed by GoBGP plugin, that its (empty) RIB can be read and that
+// watchers can register for its routes.
+func (t *Then) VrfIsConfigured() {
+	vrfs := t.vars.goBGPPlugin.Vrfs()
+	Expect(vrfs).To(HaveLen(1))
+	Expect(vrfs[0].Name).To(Equal(vrfName))
+	Expect(vrfs[0].RouteDistinguisher).To(Equal(vrfRouteDistinguisher))
+	Expect(vrfs[0].ImportRouteTargets).To(Equal([]string{vrfRouteTarget}))
+
+	routes, err := t.vars.goBGPPlugin.GetVrfRib(vrfName, bgp.IPv4Unicast)
+	Expect(err).To(BeNil())
+	Expect(routes).To(BeEmpty())
+
+	registration, err := t.vars.goBGPPlugin.WatchIPRouteEvents("TestVrfWatcher", func(event *bgp.RouteEvent) {}, bgp.WithVrf(vrfName))
+	Expect(err).To(BeNil())
+	Expect(registration.Close()).To(BeNil())
+}
+
+// ManagingOfUnknownVrfFails checks that GoBGP plugin refuses operations with VRF that is not configured and refuses
+// VRF with invalid route distinguisher.
+func (t *Then) ManagingOfUnknownVrfFails() {
+	const unknownVrf = "unknown"
+	Expect(t.vars.goBGPPlugin.DeleteVrf(unknownVrf)).To(BeAssignableToTypeOf(&gobgp.VrfNotFoundError{}))
+	_, err := t.vars.goBGPPlugin.GetVrfRib(unknownVrf, bgp.IPv4Unicast)
+	Expect(err).To(BeAssignableToTypeOf(&gobgp.VrfNotFoundError{}))
+	_, err = t.vars.goBGPPlugin.WatchIPRouteEvents("TestVrfWatcher", func(event *bgp.RouteEvent) {}, bgp.WithVrf(unknownVrf))
+	Expect(err).To(BeAssignableToTypeOf(&gobgp.VrfNotFoundError{}))
+	Expect(t.vars.goBGPPlugin.AddVrf(gobgp.Vrf{Name: unknownVrf, RouteDistinguisher: "invalid"})).NotTo(BeNil())
+}
+
+// NoVrfIsConfigured checks that GoBGP plugin has no VRF.
+func (t *Then) NoVrfIsConfigured() {
+	Expect(t.vars.goBGPPlugin.Vrfs()).To(BeEmpty())
+}
+
+// receivePeerStateEvent waits for event delivered to peer state watcher. If nothing comes in timeout (timeoutForReceiving constant), test fails.
+func (t *Then) receivePeerStateEvent() bgp.PeerStateEvent {
+	select {
+	case <-time.After(timeoutForReceiving):
+		t.vars.golangT.Fatal("Peer state channel didn't received any event, but it should have.")
+	case event := <-t.vars.peerStateChannel:
+		logroot.StandardLogger().Debug("Agent received new peer state event ", event)
+		return event
+	}
+	return bgp.PeerStateEvent{}
+}
+
+// receiveEvent waits for route event delivered to event watcher. If nothing comes in timeout (timeoutForReceiving constant), test fails.
+func (t *Then) receiveEvent() bgp.RouteEvent {
+	select {
+	case <-time.After(timeoutForReceiving):
+		t.vars.golangT.Fatal("Event channel didn't received any route event, but it should have.")
+	case event := <-t.vars.eventChannel:
+		logroot.StandardLogger().Debug("Agent received new route event ", event)
+		return event
+	}
+	return bgp.RouteEvent{}
+}
+
 var (
 	serverConf = &config.Bgp{
 		Global: config.Global{
@@ -303,6 +775,10 @@ var (
 						PassiveMode: true,
 					},
 				},
+				AfiSafis: []config.AfiSafi{
+					{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_IPV4_UNICAST, Enabled: true}},
+					{Config: config.AfiSafiConfig{AfiSafiName: config.AFI_SAFI_TYPE_IPV6_UNICAST, Enabled: true}},
+				},
 			},
 		},
 	}
@@ -35,3 +35,152 @@ func TestGoBGPPluginInfoPassing(x *testing.T) {
 	t.When.StopWatchingAndAddNewRoute()
 	t.Then.WatcherReceivesNothing()
 }
+
+// TestGoBGPPluginRouteEvents tests gobgp plugin for the ability of passing route events (addition and withdrawal of route)
+// to its registered event watchers. Withdrawal event must carry the previously announced route.
+func TestGoBGPPluginRouteEvents(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+	defer t.Teardown()
+
+	t.Given.RouteReflector()
+	t.Given.GoBGPPluginWithEventWatcher() //connected to route reflector
+	t.When.AddNewRoute()
+	t.Then.EventWatcherReceivesAddedRoute()
+
+	t.When.WithdrawAddedRoute()
+	t.Then.EventWatcherReceivesWithdrawnRoute()
+}
+
+// TestGoBGPPluginIPv6RoutePassing tests gobgp plugin for the ability of retrieving IPv6 unicast routes (next hop is carried
+// in MP_REACH_NLRI attribute) and passing them to its registered watchers together with their route family.
+func TestGoBGPPluginIPv6RoutePassing(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+	defer t.Teardown()
+
+	t.Given.RouteReflector()
+	t.Given.GoBGPPluginWithWatcher() //connected to route reflector
+	t.When.AddNewIPv6Route()
+	t.Then.WatcherReceivesAddedIPv6Route()
+}
+
+// TestGoBGPPluginPathAttributesPassing tests gobgp plugin for the ability of passing BGP path attributes of received routes
+// to its registered watchers. Attributes that have no typed representation must be passed in raw form.
+func TestGoBGPPluginPathAttributesPassing(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+	defer t.Teardown()
+
+	t.Given.RouteReflector()
+	t.Given.GoBGPPluginWithWatcher() //connected to route reflector
+	t.When.AddNewRouteWithPathAttributes()
+	t.Then.WatcherReceivesRouteWithPathAttributes()
+}
+
+// TestGoBGPPluginRIBSnapshot tests gobgp plugin for the ability of sending snapshot of already learned routes
+// to late-registered watcher that asked for it. Snapshot must be terminated by snapshot end marker.
+func TestGoBGPPluginRIBSnapshot(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+	defer t.Teardown()
+
+	t.Given.RouteReflector()
+	t.Given.GoBGPPluginWithEventWatcher() //connected to route reflector
+	t.When.AddNewRoute()
+	t.Then.EventWatcherReceivesAddedRoute()
+
+	t.When.LateWatcherRegistersWithRIBSnapshot()
+	t.Then.LateWatcherReceivesRIBSnapshot()
+}
+
+// TestGoBGPPluginPeerStateChanges tests gobgp plugin for the ability of passing changes of BGP session state to its registered
+// peer state watchers. Loss of session must carry NOTIFICATION message that caused it.
+func TestGoBGPPluginPeerStateChanges(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+	defer t.Teardown()
+
+	t.Given.RouteReflector()
+	t.Given.GoBGPPluginWithPeerStateWatcher() //connected to route reflector
+	t.Then.PeerStateWatcherReceivesEstablishedSession()
+
+	t.When.RouteReflectorShutsDownSession()
+	t.Then.PeerStateWatcherReceivesSessionShutdown()
+}
+
+// TestGoBGPPluginRouteReading tests gobgp plugin for the ability of answering queries for currently reachable routes
+// (listing of routes, exact prefix lookup and longest prefix match lookup).
+func TestGoBGPPluginRouteReading(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+	defer t.Teardown()
+
+	t.Given.RouteReflector()
+	t.Given.GoBGPPluginWithWatcher() //connected to route reflector
+	t.When.AddNewRoute()
+	t.Then.WatcherReceivesAddedRoute()
+	t.Then.RouteReaderFindsAddedRoute()
+}
+
+// TestGoBGPPluginAdvertising tests gobgp plugin for the ability of originating prefix (with optional path attributes)
+// to its BGP neighbors and withdrawing exactly this prefix later.
+func TestGoBGPPluginAdvertising(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+	defer t.Teardown()
+
+	t.Given.RouteReflector()
+	t.Given.GoBGPPluginWithWatcher() //connected to route reflector
+	t.When.PluginAnnouncesRoute()
+	t.Then.RouteReflectorReceivesAnnouncedRoute()
+
+	t.When.PluginWithdrawsAnnouncedRoute()
+	t.Then.RouteReflectorLosesAnnouncedRoute()
+}
+
+// TestGoBGPPluginNeighborManagement tests gobgp plugin for the ability of listing configured neighbors with their session state
+// and for refusing of invalid neighbor management operations (duplicate or unknown neighbor).
+func TestGoBGPPluginNeighborManagement(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+	defer t.Teardown()
+
+	t.Given.RouteReflector()
+	t.Given.GoBGPPluginWithWatcher() //connected to route reflector
+	t.Then.NeighborsContainEstablishedRouteReflector()
+	t.Then.AddingOfDuplicateNeighborFails()
+	t.Then.ManagingOfUnknownNeighborFails()
+}
+
+// TestGoBGPPluginWatcherRegistration tests gobgp plugin for enforcing of registration semantics (refusing of duplicate
+// watcher names and nil callbacks, idempotent closing of registration) and for listing of registered watchers.
+func TestGoBGPPluginWatcherRegistration(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+	defer t.Teardown()
+
+	t.Given.GoBGPPluginWithWatcher()
+	t.Then.DuplicateWatcherRegistrationFails()
+	t.Then.RegistrationWithoutCallbackFails()
+	t.Then.ListedWatchersContainOnlyRegisteredWatcher()
+
+	t.When.WatcherReRegistersAfterRepeatedClose()
+	t.Then.ListedWatchersContainOnlyRegisteredWatcher()
+}
+
+// TestGoBGPPluginVrfManagement tests gobgp plugin for the ability of configuring VRFs for L3VPN routes, reading of VRF's routes
+// and for refusing of operations with unknown VRF.
+func TestGoBGPPluginVrfManagement(x *testing.T) {
+	t := TestHelper{golangTesting: x}
+	t.DefaultSetup()
+	defer t.Teardown()
+
+	t.Given.GoBGPPluginWithWatcher()
+	t.When.PluginAddsVrf()
+	t.Then.VrfIsConfigured()
+	t.Then.ManagingOfUnknownVrfFails()
+
+	t.When.PluginDeletesVrf()
+	t.Then.NoVrfIsConfigured()
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"sort"
+	"time"
+)
+
+// defaultResyncTimeout bounds waiting for End-of-RIB markers of peer that doesn't advertise restart time of graceful
+// restart (default restart time of RFC 4724).
+const defaultResyncTimeout = 120 * time.Second
+
+// pendingResync is resynchronization of watchers (see resyncWatchers()) whose bgp.ResyncEnd marker waits until recovered
+// peers send End-of-RIB marker for all their route families (or until resync timeout expires), so that routes sent by
+// the peers after re-establishment of session are not swept by watchers. It is accessed only by goroutine processing
+// goBGP events (see watchChanges()).
+type pendingResync struct {
+	awaited          map[string]map[bgpPacket.RouteFamily]bool // route families of awaited End-of-RIB markers by peer address
+	routeWatchers    []*routeWatcher                           // watchers that received bgp.ResyncStart
+	evpnWatchers     []*evpnWatcher
+	flowSpecWatchers []*flowSpecWatcher
+	timer            *time.Timer
+}
+
+// startResync starts resynchronization of watchers that awaits End-of-RIB markers of <neighbor> whose session was
+// re-established. Resynchronization that is still pending is restarted, so End-of-RIB markers awaited by it are awaited
+// too and its timeout is replaced by the timeout of <neighbor>.
+func (plugin *Plugin) startResync(neighbor string) *pendingResync {
+	families, timeout := plugin.awaitedEndOfRIBs(neighbor)
+	resync := &pendingResync{awaited: map[string]map[bgpPacket.RouteFamily]bool{}}
+	if pending := plugin.resync; pending != nil {
+		pending.timer.Stop()
+		for peer, awaited := range pending.awaited {
+			resync.awaited[peer] = awaited
+		}
+	}
+	if len(families) > 0 {
+		resync.awaited[neighbor] = families
+	}
+	resync.timer = time.AfterFunc(timeout, func() {
+		select {
+		case plugin.resyncsDue <- resync:
+		case <-plugin.stopWatch:
+		}
+	})
+	plugin.resync = resync
+	return resync
+}
+
+// awaitedEndOfRIBs returns route families whose End-of-RIB marker is awaited after re-establishment of session with
+// <neighbor> (families configured for the neighbor that the peer advertised by multiprotocol capability) and the time
+// after which resynchronization of watchers ends without them (restart time advertised by the peer for graceful restart
+// or defaultResyncTimeout). Only IPv4 unicast is awaited if the neighbor is not known to goBGP.
+func (plugin *Plugin) awaitedEndOfRIBs(neighbor string) (families map[bgpPacket.RouteFamily]bool, timeout time.Duration) {
+	families = map[bgpPacket.RouteFamily]bool{bgpPacket.RF_IPv4_UC: true}
+	if plugin.checkStarted() != nil {
+		return families, defaultResyncTimeout
+	}
+	neighbors := plugin.server.GetNeighbor(neighbor, false)
+	if len(neighbors) == 0 {
+		return families, defaultResyncTimeout
+	}
+	advertised := map[bgpPacket.RouteFamily]bool{}
+	for _, capability := range neighbors[0].State.RemoteCapabilityList {
+		if multiprotocol, isMultiprotocol := capability.(*bgpPacket.CapMultiProtocol); isMultiprotocol {
+			advertised[multiprotocol.CapValue] = true
+		}
+	}
+	if len(advertised) == 0 {
+		advertised[bgpPacket.RF_IPv4_UC] = true // peer without multiprotocol capability supports IPv4 unicast only (RFC 4760)
+	}
+	families = map[bgpPacket.RouteFamily]bool{}
+	for _, afiSafi := range neighbors[0].AfiSafis {
+		if family, err := bgpPacket.GetRouteFamily(string(afiSafi.Config.AfiSafiName)); err == nil && advertised[family] {
+			families[family] = true
+		}
+	}
+	timeout = defaultResyncTimeout
+	if restartTime := neighbors[0].GracefulRestart.State.PeerRestartTime; restartTime > 0 {
+		timeout = time.Duration(restartTime) * time.Second
+	}
+	return families, timeout
+}
+
+// processEndOfRIB stops awaiting End-of-RIB marker received from peer in <msg> by pending resynchronization of watchers
+// (see pendingResync). Other received messages are ignored.
+func (plugin *Plugin) processEndOfRIB(msg *server.WatchEventMessage) {
+	if plugin.resync == nil || msg.Message == nil {
+		return
+	}
+	update, isUpdate := msg.Message.Body.(*bgpPacket.BGPUpdate)
+	if !isUpdate {
+		return
+	}
+	if eor, family := update.IsEndOfRib(); eor {
+		plugin.Log.Debugf("End-of-RIB marker of %v received from %v", family, msg.PeerAddress)
+		plugin.stopAwaitingEndOfRIB(msg.PeerAddress.String(), family)
+	}
+}
+
+// stopAwaitingEndOfRIB stops awaiting End-of-RIB markers of <families> from <peer> (all its markers if no family is given,
+// i.e. after loss of session with the peer) and ends pending resynchronization of watchers if no marker is awaited anymore.
+func (plugin *Plugin) stopAwaitingEndOfRIB(peer string, families ...bgpPacket.RouteFamily) {
+	resync := plugin.resync
+	if resync == nil {
+		return
+	}
+	awaited, found := resync.awaited[peer]
+	if !found {
+		return
+	}
+	for _, family := range families {
+		delete(awaited, family)
+	}
+	if len(families) == 0 || len(awaited) == 0 {
+		delete(resync.awaited, peer)
+	}
+	if len(resync.awaited) == 0 {
+		plugin.endResync(resync)
+	}
+}
+
+// processResyncTimeout ends pending resynchronization of watchers whose timeout expired (<resync>) without awaited
+// End-of-RIB markers. Resynchronization that was already ended or restarted is ignored.
+func (plugin *Plugin) processResyncTimeout(resync *pendingResync) {
+	if plugin.resync != resync {
+		return
+	}
+	peers := make([]string, 0, len(resync.awaited))
+	for peer := range resync.awaited {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	plugin.Log.Warnf("End-of-RIB markers of %v were not received in time, ending resynchronization of watchers", peers)
+	plugin.endResync(resync)
+}
+
+// endResync sends bgp.ResyncEnd marker to watchers that received bgp.ResyncStart marker of <resync> (it is ignored
+// by closed queues of watchers unregistered since then).
+func (plugin *Plugin) endResync(resync *pendingResync) {
+	resync.timer.Stop()
+	plugin.resync = nil
+	plugin.Log.Info("Resynchronization of watchers is complete")
+	for _, watcher := range resync.routeWatchers {
+		watcher.queue.push(&bgp.RouteEvent{Type: bgp.ResyncEnd})
+	}
+	for _, watcher := range resync.evpnWatchers {
+		watcher.queue.push(&bgp.EVPNEvent{Type: bgp.ResyncEnd})
+	}
+	for _, watcher := range resync.flowSpecWatchers {
+		watcher.queue.push(&bgp.FlowSpecEvent{Type: bgp.ResyncEnd})
+	}
+}
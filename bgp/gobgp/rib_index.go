@@ -0,0 +1,184 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"fmt"
+	"github.com/armon/go-radix"
+	"github.com/ligato/bgp-agent/bgp"
+	"net"
+)
+
+// ribIndex is prefix trie of reachable routes. Routes are keyed by bit string of their prefix (prefixed by address family
+// marker), so that exact prefix lookup and longest prefix match are both simple trie lookups. Keys of routes of other than
+// unicast route families are qualified by route family and route distinguisher (see routeKey()), so that they don't take
+// part in longest prefix match of unicast routes. ribIndex is not thread-safe.
+type ribIndex struct {
+	tree *radix.Tree
+}
+
+// newRIBIndex creates empty ribIndex.
+func newRIBIndex() *ribIndex {
+	return &ribIndex{tree: radix.New()}
+}
+
+// get returns route stored under given <key> (see routeKey()).
+func (index *ribIndex) get(key string) (*bgp.ReachableIPRoute, bool) {
+	if route, found := index.tree.Get(key); found {
+		return route.(*bgp.ReachableIPRoute), true
+	}
+	return nil, false
+}
+
+// put stores <route> under given <key> (replacing previous route of the key).
+func (index *ribIndex) put(key string, route *bgp.ReachableIPRoute) {
+	index.tree.Insert(key, route)
+}
+
+// delete removes route stored under given <key>.
+func (index *ribIndex) delete(key string) {
+	index.tree.Delete(key)
+}
+
+// longestMatch returns route with the longest prefix containing <ip>.
+func (index *ribIndex) longestMatch(ip net.IP) (*bgp.ReachableIPRoute, bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	bits := len(ip) * 8
+	key, err := prefixKey(&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	if err != nil {
+		return nil, false
+	}
+	if _, route, found := index.tree.LongestPrefix(key); found {
+		return route.(*bgp.ReachableIPRoute), true
+	}
+	return nil, false
+}
+
+// routes returns all routes (of given <families> if any are given) ordered by their key (unicast routes by prefix first).
+func (index *ribIndex) routes(families ...bgp.RouteFamily) []*bgp.ReachableIPRoute {
+	routes := make([]*bgp.ReachableIPRoute, 0, index.tree.Len())
+	filter := &bgp.RouteFilter{Families: families}
+	index.tree.Walk(func(key string, value interface{}) bool {
+		route := value.(*bgp.ReachableIPRoute)
+		if filter.Match(route) {
+			routes = append(routes, route)
+		}
+		return false
+	})
+	return routes
+}
+
+// keysFrom returns keys of routes received from <peer> (see bgp.ReachableIPRoute.SourcePeer) in key order.
+func (index *ribIndex) keysFrom(peer net.IP) []string {
+	var keys []string
+	index.tree.Walk(func(key string, value interface{}) bool {
+		if value.(*bgp.ReachableIPRoute).SourcePeer.Equal(peer) {
+			keys = append(keys, key)
+		}
+		return false
+	})
+	return keys
+}
+
+// clone returns copy of index (routes themselves are shared).
+func (index *ribIndex) clone() *ribIndex {
+	clone := newRIBIndex()
+	index.tree.Walk(func(key string, value interface{}) bool {
+		clone.tree.Insert(key, value)
+		return false
+	})
+	return clone
+}
+
+// len returns count of routes in index.
+func (index *ribIndex) len() int {
+	return index.tree.Len()
+}
+
+// routeKey returns trie key of <route>. Key of unicast route is key of its prefix (see prefixKey()), keys of other routes
+// are qualified by route family and route distinguisher. Error is returned if prefix of route can't be parsed.
+func routeKey(route *bgp.ReachableIPRoute) (string, error) {
+	prefix, err := route.IPNet()
+	if err != nil {
+		return "", err
+	}
+	key, err := prefixKey(prefix)
+	if err != nil {
+		return "", err
+	}
+	if route.Family == bgp.IPv4Unicast || route.Family == bgp.IPv6Unicast {
+		return key, nil
+	}
+	return route.Family.String() + "|" + route.RouteDistinguisher + "|" + key, nil
+}
+
+// prefixKey encodes <prefix> into trie key. Key consists of address family marker followed by prefix bits ('0' or '1'
+// characters) up to the prefix length, so that key of every covering prefix is prefix of the key. Address family is given
+// by mask length (IPv4-mapped IPv6 prefix is IPv6 prefix). Error is returned for prefix whose mask doesn't fit its address.
+func prefixKey(prefix *net.IPNet) (string, error) {
+	ones, bits := prefix.Mask.Size()
+	ip := prefix.IP.To16()
+	marker := byte('6')
+	if bits == 8*net.IPv4len {
+		ip = prefix.IP.To4()
+		marker = '4'
+	}
+	if ip == nil || bits != len(ip)*8 || ones > len(ip)*8 {
+		return "", fmt.Errorf("Invalid prefix %v", prefix)
+	}
+	key := make([]byte, 0, ones+1)
+	key = append(key, marker)
+	for i := 0; i < ones; i++ {
+		if ip[i/8]&(0x80>>uint(i%8)) != 0 {
+			key = append(key, '1')
+		} else {
+			key = append(key, '0')
+		}
+	}
+	return string(key), nil
+}
+
+// Routes returns all currently reachable routes (ordered by prefix). If <families> are given, only routes of these route families
+// are returned.
+func (plugin *Plugin) Routes(families ...bgp.RouteFamily) []*bgp.ReachableIPRoute {
+	plugin.routesMu.Lock()
+	defer plugin.routesMu.Unlock()
+	return plugin.rib.routes(families...)
+}
+
+// Route returns reachable unicast route for exactly the given <prefix> (in CIDR notation). Error is returned if <prefix> can't be parsed.
+func (plugin *Plugin) Route(prefix string) (*bgp.ReachableIPRoute, bool, error) {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, false, err
+	}
+	key, err := prefixKey(ipNet)
+	if err != nil {
+		return nil, false, err
+	}
+	plugin.routesMu.Lock()
+	defer plugin.routesMu.Unlock()
+	route, found := plugin.rib.get(key)
+	return route, found, nil
+}
+
+// LookupRoute returns reachable unicast route whose prefix is the longest prefix matching the <ip> address.
+func (plugin *Plugin) LookupRoute(ip net.IP) (*bgp.ReachableIPRoute, bool) {
+	plugin.routesMu.Lock()
+	defer plugin.routesMu.Unlock()
+	return plugin.rib.longestMatch(ip)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	"github.com/ligato/cn-infra/flavors/local"
+	. "github.com/onsi/gomega"
+	"net"
+	"strings"
+	"testing"
+)
+
+// TestPrefixKey tests that address family of prefix key is given by mask length, so that IPv4-mapped IPv6 prefixes
+// and default routes are keyed correctly.
+func TestPrefixKey(x *testing.T) {
+	RegisterTestingT(x)
+	for _, tc := range []struct {
+		prefix string
+		key    string
+	}{
+		{"10.0.0.0/8", "4" + "00001010"},
+		{"0.0.0.0/0", "4"},
+		{"::/0", "6"},
+		{"::ffff:10.0.0.0/104", "6" + strings.Repeat("0", 80) + strings.Repeat("1", 16) + "00001010"},
+		{"::ffff:10.0.0.0/128", "6" + strings.Repeat("0", 80) + strings.Repeat("1", 16) + "00001010" + strings.Repeat("0", 24)},
+	} {
+		_, prefix, err := net.ParseCIDR(tc.prefix)
+		Expect(err).To(BeNil())
+		key, err := prefixKey(prefix)
+		Expect(err).To(BeNil(), tc.prefix)
+		Expect(key).To(Equal(tc.key), tc.prefix)
+	}
+
+	_, err := prefixKey(&net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(8, 32)})
+	Expect(err).NotTo(BeNil())
+	_, err = prefixKey(&net.IPNet{IP: net.IP{10, 0, 0}, Mask: net.CIDRMask(8, 32)})
+	Expect(err).NotTo(BeNil())
+}
+
+// TestMappedIPv6Route tests that IPv4-mapped IPv6 prefixes and default routes can be stored, looked up and withdrawn.
+func TestMappedIPv6Route(x *testing.T) {
+	RegisterTestingT(x)
+	flavor := &local.FlavorLocal{}
+	plugin := New(Deps{PluginInfraDeps: *flavor.InfraDeps("TestGoBGP")})
+	for _, prefix := range []string{"::ffff:10.0.0.0/104", "0.0.0.0/0", "::/0", "10.0.0.0/8"} {
+		family := bgp.IPv6Unicast
+		if !strings.Contains(prefix, ":") {
+			family = bgp.IPv4Unicast
+		}
+		plugin.processPath(mustRouteKey(prefix, family), &bgp.ReachableIPRoute{Family: family, Prefix: prefix}, false, nil)
+	}
+	for _, prefix := range []string{"::ffff:10.0.0.0/104", "0.0.0.0/0", "::/0", "10.0.0.0/8"} {
+		route, found, err := plugin.Route(prefix)
+		Expect(err).To(BeNil())
+		Expect(found).To(BeTrue(), prefix)
+		Expect(route.Prefix).To(Equal(prefix))
+	}
+	route, found := plugin.LookupRoute(net.ParseIP("10.1.2.3"))
+	Expect(found).To(BeTrue())
+	Expect(route.Prefix).To(Equal("10.0.0.0/8"))
+	route, found = plugin.LookupRoute(net.ParseIP("2001:db8::1"))
+	Expect(found).To(BeTrue())
+	Expect(route.Prefix).To(Equal("::/0"))
+}
+
+// mustRouteKey returns route key of unicast route of <prefix> and <family>.
+func mustRouteKey(prefix string, family bgp.RouteFamily) string {
+	key, err := routeKey(&bgp.ReachableIPRoute{Family: family, Prefix: prefix})
+	Expect(err).To(BeNil())
+	return key
+}
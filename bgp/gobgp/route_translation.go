@@ -0,0 +1,256 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"fmt"
+	"github.com/ligato/bgp-agent/bgp"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/table"
+	"net"
+)
+
+// supportedFamilies maps goBGP route families that can be translated into bgp.ReachableIPRoute to their bgp.RouteFamily.
+var supportedFamilies = map[bgpPacket.RouteFamily]bgp.RouteFamily{
+	bgpPacket.RF_IPv4_UC:   bgp.IPv4Unicast,
+	bgpPacket.RF_IPv6_UC:   bgp.IPv6Unicast,
+	bgpPacket.RF_IPv4_MPLS: bgp.IPv4LabeledUnicast,
+	bgpPacket.RF_IPv6_MPLS: bgp.IPv6LabeledUnicast,
+	bgpPacket.RF_IPv4_VPN:  bgp.IPv4VPN,
+	bgpPacket.RF_IPv6_VPN:  bgp.IPv6VPN,
+}
+
+// toReachableIPRoute translates goBGP path of supported route family (see supportedFamilies) into bgp.ReachableIPRoute.
+func toReachableIPRoute(path *table.Path) *bgp.ReachableIPRoute {
+	asPath := toAsPath(path.GetAsPath())
+	nexthop, linkLocalNexthop := toNexthops(path)
+	route := &bgp.ReachableIPRoute{
+		As:               asPath.OriginAs(),
+		Family:           supportedFamilies[path.GetRouteFamily()],
+		Prefix:           path.GetNlri().String(),
+		Nexthop:          nexthop,
+		LinkLocalNexthop: linkLocalNexthop,
+		AsPath:           asPath,
+		Attributes:       toPathAttributes(path),
+		PathID:           path.GetNlri().PathIdentifier(),
+		Stale:            isStale(path),
+	}
+	if source := path.GetSource(); source != nil && len(source.Address) > 0 {
+		route.SourcePeer = source.Address
+	}
+	switch nlri := path.GetNlri().(type) {
+	case *bgpPacket.LabeledIPAddrPrefix:
+		route.Labels = append([]uint32(nil), nlri.Labels.Labels...)
+	case *bgpPacket.LabeledIPv6AddrPrefix:
+		route.Labels = append([]uint32(nil), nlri.Labels.Labels...)
+	case *bgpPacket.LabeledVPNIPAddrPrefix:
+		setVPNInfo(route, nlri, path)
+	case *bgpPacket.LabeledVPNIPv6AddrPrefix:
+		setVPNInfo(route, &nlri.LabeledVPNIPAddrPrefix, path)
+	}
+	return route
+}
+
+// setVPNInfo fills <route> translated from L3VPN <path> with IP prefix, route distinguisher and MPLS labels from
+// VPN <nlri> and with route targets of the path.
+func setVPNInfo(route *bgp.ReachableIPRoute, nlri *bgpPacket.LabeledVPNIPAddrPrefix, path *table.Path) {
+	route.Prefix = nlri.IPPrefix()
+	if nlri.RD != nil {
+		route.RouteDistinguisher = nlri.RD.String()
+	}
+	route.Labels = append([]uint32(nil), nlri.Labels.Labels...)
+	route.RouteTargets = toRouteTargets(path.GetExtCommunities())
+}
+
+// isStale returns true if <path> is retained by goBGP for gracefully restarting peer or if it carries LLGR_STALE community.
+func isStale(path *table.Path) bool {
+	if path.IsStale() {
+		return true
+	}
+	for _, community := range path.GetCommunities() {
+		if community == uint32(bgp.LLGRStale) {
+			return true
+		}
+	}
+	return false
+}
+
+// toRouteTargets translates route target extended communities (RFC 4360, RFC 5668) from <communities> into their
+// string form (i.e. "65000:100"). Other extended communities are skipped.
+func toRouteTargets(communities []bgpPacket.ExtendedCommunityInterface) []string {
+	var routeTargets []string
+	for _, community := range communities {
+		typ, subType := community.GetTypes()
+		if subType != bgpPacket.EC_SUBTYPE_ROUTE_TARGET {
+			continue
+		}
+		switch typ {
+		case bgpPacket.EC_TYPE_TRANSITIVE_TWO_OCTET_AS_SPECIFIC, bgpPacket.EC_TYPE_TRANSITIVE_IP4_SPECIFIC,
+			bgpPacket.EC_TYPE_TRANSITIVE_FOUR_OCTET_AS_SPECIFIC:
+			routeTargets = append(routeTargets, community.String())
+		}
+	}
+	return routeTargets
+}
+
+// toNexthops retrieves global and link-local next hop of goBGP path. Next hop of IPv4 routes is taken from NEXT_HOP
+// attribute, next hops of other routes are taken from MP_REACH_NLRI attribute (RFC 4760, RFC 2545). Link-local next hop
+// is nil if it is not present.
+func toNexthops(path *table.Path) (nexthop net.IP, linkLocalNexthop net.IP) {
+	for _, attr := range path.GetPathAttrs() {
+		if mpReach, ok := attr.(*bgpPacket.PathAttributeMpReachNLRI); ok {
+			if len(mpReach.LinkLocalNexthop) > 0 && !mpReach.LinkLocalNexthop.IsUnspecified() {
+				linkLocalNexthop = mpReach.LinkLocalNexthop
+			}
+		}
+	}
+	return path.GetNexthop(), linkLocalNexthop
+}
+
+// toMultipathNexthops translates ECMP path set of one prefix from goBGP into next hops with weights taken from link bandwidth
+// extended community of the paths. Withdrawn paths are skipped.
+func toMultipathNexthops(paths []*table.Path) []bgp.MultipathNexthop {
+	nexthops := make([]bgp.MultipathNexthop, 0, len(paths))
+	for _, path := range paths {
+		if path.IsWithdraw {
+			continue
+		}
+		nexthop := bgp.MultipathNexthop{Nexthop: path.GetNexthop()}
+		for _, community := range toExtendedCommunities(path.GetExtCommunities()) {
+			if _, bandwidth, ok := community.LinkBandwidth(); ok {
+				nexthop.Weight = bandwidth
+				break
+			}
+		}
+		nexthops = append(nexthops, nexthop)
+	}
+	return nexthops
+}
+
+// toAsPath translates goBGP AS_PATH attribute into bgp.AsPath. Missing attribute is translated to empty AS path.
+func toAsPath(attr *bgpPacket.PathAttributeAsPath) bgp.AsPath {
+	if attr == nil {
+		return bgp.AsPath{}
+	}
+	asPath := make(bgp.AsPath, 0, len(attr.Value))
+	for _, param := range attr.Value {
+		switch segment := param.(type) {
+		case *bgpPacket.As4PathParam:
+			asPath = append(asPath, bgp.AsPathSegment{
+				Type: bgp.AsPathSegmentType(segment.Type),
+				ASes: append([]uint32(nil), segment.AS...),
+			})
+		case *bgpPacket.AsPathParam:
+			ases := make([]uint32, 0, len(segment.AS))
+			for _, as := range segment.AS {
+				ases = append(ases, uint32(as))
+			}
+			asPath = append(asPath, bgp.AsPathSegment{Type: bgp.AsPathSegmentType(segment.Type), ASes: ases})
+		}
+	}
+	return asPath
+}
+
+// toPathAttributes translates path attributes of goBGP path into bgp.PathAttributes. Attributes that are translated
+// elsewhere (AS_PATH, next hop and NLRI related attributes) are skipped. Attributes without typed representation
+// in bgp.PathAttributes are translated to bgp.RawPathAttribute.
+func toPathAttributes(path *table.Path) bgp.PathAttributes {
+	attrs := bgp.PathAttributes{}
+	for _, attr := range path.GetPathAttrs() {
+		switch a := attr.(type) {
+		case *bgpPacket.PathAttributeAsPath, *bgpPacket.PathAttributeAs4Path, *bgpPacket.PathAttributeNextHop,
+			*bgpPacket.PathAttributeMpReachNLRI, *bgpPacket.PathAttributeMpUnreachNLRI:
+			continue
+		case *bgpPacket.PathAttributeOrigin:
+			if len(a.Value) > 0 {
+				attrs.Origin = bgp.Origin(a.Value[0])
+			}
+		case *bgpPacket.PathAttributeMultiExitDisc:
+			med := a.Value
+			attrs.Med = &med
+		case *bgpPacket.PathAttributeLocalPref:
+			localPref := a.Value
+			attrs.LocalPref = &localPref
+		case *bgpPacket.PathAttributeCommunities:
+			for _, community := range a.Value {
+				attrs.Communities = append(attrs.Communities, bgp.Community(community))
+			}
+		case *bgpPacket.PathAttributeExtendedCommunities:
+			attrs.ExtendedCommunities = toExtendedCommunities(a.Value)
+		case *bgpPacket.PathAttributeLargeCommunities:
+			for _, community := range a.Values {
+				attrs.LargeCommunities = append(attrs.LargeCommunities, bgp.LargeCommunity{
+					GlobalAdmin: community.ASN,
+					LocalData1:  community.LocalData1,
+					LocalData2:  community.LocalData2,
+				})
+			}
+		case *bgpPacket.PathAttributeAtomicAggregate:
+			attrs.AtomicAggregate = true
+		case *bgpPacket.PathAttributeAggregator:
+			attrs.Aggregator = &bgp.Aggregator{As: a.Value.AS, Address: a.Value.Address}
+		case *bgpPacket.PathAttributeOriginatorId:
+			attrs.OriginatorID = a.Value
+		case *bgpPacket.PathAttributeClusterList:
+			attrs.ClusterList = append([]net.IP(nil), a.Value...)
+		default:
+			if raw, err := toRawPathAttribute(attr); err == nil {
+				attrs.Other = append(attrs.Other, raw)
+			}
+		}
+	}
+	return attrs
+}
+
+// toExtendedCommunities translates goBGP extended communities into their raw 8-octet form. Communities that can't be
+// serialized are skipped.
+func toExtendedCommunities(communities []bgpPacket.ExtendedCommunityInterface) []bgp.ExtendedCommunity {
+	result := make([]bgp.ExtendedCommunity, 0, len(communities))
+	for _, community := range communities {
+		data, err := community.Serialize()
+		if err != nil || len(data) != 8 {
+			continue
+		}
+		var extended bgp.ExtendedCommunity
+		copy(extended[:], data)
+		result = append(result, extended)
+	}
+	return result
+}
+
+// toRawPathAttribute translates goBGP path attribute into bgp.RawPathAttribute by serializing it and stripping
+// the attribute header (flags, type code and 1 or 2 octets of length).
+func toRawPathAttribute(attr bgpPacket.PathAttributeInterface) (bgp.RawPathAttribute, error) {
+	data, err := attr.Serialize()
+	if err != nil {
+		return bgp.RawPathAttribute{}, err
+	}
+	if len(data) < 3 {
+		return bgp.RawPathAttribute{}, fmt.Errorf("path attribute %v is too short", attr.GetType())
+	}
+	flags := bgpPacket.BGPAttrFlag(data[0])
+	headerLen := 3
+	if flags&bgpPacket.BGP_ATTR_FLAG_EXTENDED_LENGTH != 0 {
+		headerLen = 4
+	}
+	if len(data) < headerLen {
+		return bgp.RawPathAttribute{}, fmt.Errorf("path attribute %v is too short", attr.GetType())
+	}
+	return bgp.RawPathAttribute{
+		Type:  data[1],
+		Flags: uint8(flags),
+		Value: data[headerLen:],
+	}, nil
+}
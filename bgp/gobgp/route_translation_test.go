@@ -0,0 +1,74 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	. "github.com/onsi/gomega"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestLabeledUnicastRouteWatching tests that labeled unicast (BGP-LU) routes are sent to route watchers as plain unicast
+// routes together with their family and MPLS label stack and that they are kept apart from unicast routes of the same prefix.
+func TestLabeledUnicastRouteWatching(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, events := pluginWithEventWatcher()
+
+	ipv4Nlri := bgpPacket.NewLabeledIPAddrPrefix(24, "10.6.0.0", *bgpPacket.NewMPLSLabelStack(100, 200))
+	ipv6Nlri := bgpPacket.NewLabeledIPv6AddrPrefix(64, "2001:db8:6::", *bgpPacket.NewMPLSLabelStack(300))
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		labeledPath(ipv4Nlri, "10.0.0.1"),
+		labeledPath(ipv6Nlri, "2001:db8::1"),
+	}})
+	event := receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Family).To(Equal(bgp.IPv4LabeledUnicast))
+	Expect(event.Route.Family.IsLabeledUnicast()).To(BeTrue())
+	Expect(event.Route.Prefix).To(Equal("10.6.0.0/24"))
+	Expect(event.Route.Nexthop.String()).To(Equal("10.0.0.1"))
+	Expect(event.Route.Labels).To(Equal([]uint32{100, 200}))
+	event = receiveRouteEvent(events)
+	Expect(event.Route.Family).To(Equal(bgp.IPv6LabeledUnicast))
+	Expect(event.Route.Prefix).To(Equal("2001:db8:6::/64"))
+	Expect(event.Route.Labels).To(Equal([]uint32{300}))
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{
+		table.NewPath(nil, bgpPacket.NewIPAddrPrefix(24, "10.6.0.0"), false, []bgpPacket.PathAttributeInterface{
+			bgpPacket.NewPathAttributeOrigin(0),
+			bgpPacket.NewPathAttributeNextHop("10.0.0.3"),
+		}, time.Now(), false),
+	}})
+	event = receiveRouteEvent(events)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Family).To(Equal(bgp.IPv4Unicast))
+	Expect(event.Route.Labels).To(BeNil())
+	Expect(plugin.Routes(bgp.IPv4LabeledUnicast, bgp.IPv6LabeledUnicast)).To(HaveLen(2))
+	route, found := plugin.LookupRoute(net.ParseIP("10.6.0.1"))
+	Expect(found).To(BeTrue())
+	Expect(route.Family).To(Equal(bgp.IPv4Unicast))
+}
+
+// labeledPath creates goBGP path of labeled unicast <nlri> via <nexthop>.
+func labeledPath(nlri bgpPacket.AddrPrefixInterface, nexthop string) *table.Path {
+	return table.NewPath(nil, nlri, false, []bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(0),
+		bgpPacket.NewPathAttributeMpReachNLRI(nexthop, []bgpPacket.AddrPrefixInterface{nlri}),
+	}, time.Now(), false)
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"fmt"
+	"github.com/ligato/bgp-agent/bgp"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"sort"
+)
+
+// Vrf is configuration of VRF (virtual routing and forwarding instance) whose routes are exchanged with neighbors
+// as L3VPN routes. Route distinguisher and route targets are in GoBGP notation, i.e. "65000:100" or "10.0.0.1:100".
+type Vrf struct {
+	Name               string
+	ID                 uint32
+	RouteDistinguisher string
+	ImportRouteTargets []string
+	ExportRouteTargets []string
+}
+
+// VrfNotFoundError is returned by VRF related methods of Plugin if there is no VRF with given name.
+type VrfNotFoundError struct {
+	Name string
+}
+
+// Error returns description of VrfNotFoundError.
+func (err *VrfNotFoundError) Error() string {
+	return fmt.Sprintf("VRF %s is not configured", err.Name)
+}
+
+// AddVrf configures new <vrf> in goBGP server. L3VPN routes with any of VRF's import route targets are imported into
+// the VRF and can be watched by registering with bgp.WithVrf() option. It fails if route distinguisher or route targets
+// can't be parsed or if goBGP server refuses the VRF (i.e. VRF with the same name already exists).
+func (plugin *Plugin) AddVrf(vrf Vrf) error {
+	if err := plugin.checkStarted(); err != nil {
+		return err
+	}
+	rd, err := bgpPacket.ParseRouteDistinguisher(vrf.RouteDistinguisher)
+	if err != nil {
+		return fmt.Errorf("Can't parse route distinguisher %s of VRF %s: %v", vrf.RouteDistinguisher, vrf.Name, err)
+	}
+	importRts, err := parseRouteTargets(vrf.ImportRouteTargets)
+	if err != nil {
+		return fmt.Errorf("Can't parse import route targets of VRF %s: %v", vrf.Name, err)
+	}
+	exportRts, err := parseRouteTargets(vrf.ExportRouteTargets)
+	if err != nil {
+		return fmt.Errorf("Can't parse export route targets of VRF %s: %v", vrf.Name, err)
+	}
+	if err := plugin.server.AddVrf(vrf.Name, vrf.ID, rd, importRts, exportRts); err != nil {
+		return err
+	}
+
+	// keeping route distinguisher and route targets in the same notation as they have in routes
+	vrf.RouteDistinguisher = rd.String()
+	vrf.ImportRouteTargets = toRouteTargets(importRts)
+	vrf.ExportRouteTargets = toRouteTargets(exportRts)
+	plugin.routesMu.Lock()
+	plugin.vrfs[vrf.Name] = vrf
+	plugin.routesMu.Unlock()
+	return nil
+}
+
+// DeleteVrf removes VRF of given <name> from goBGP server. It fails with VrfNotFoundError if there is no such VRF.
+// Watchers of the VRF are disconnected (they receive bgp.WatchDisconnected event as the last event, events waiting
+// in their queues are dropped) and unregistered, because no route is imported into deleted VRF.
+func (plugin *Plugin) DeleteVrf(name string) error {
+	if err := plugin.checkStarted(); err != nil {
+		return err
+	}
+	if _, err := plugin.lookupVrf(name); err != nil {
+		return err
+	}
+	if err := plugin.server.DeleteVrf(name); err != nil {
+		return err
+	}
+	plugin.routesMu.Lock()
+	delete(plugin.vrfs, name)
+	for watcher, registered := range plugin.routeWatchers {
+		if registered.vrfName == name {
+			plugin.Log.Infof("Disconnecting watcher %s of deleted VRF %s", watcher, name)
+			delete(plugin.routeWatchers, watcher)
+			registered.queue.end()
+		}
+	}
+	plugin.untrackReceivedPaths()
+	plugin.routesMu.Unlock()
+	return nil
+}
+
+// Vrfs returns all configured VRFs ordered by name.
+func (plugin *Plugin) Vrfs() []Vrf {
+	plugin.routesMu.Lock()
+	vrfs := make([]Vrf, 0, len(plugin.vrfs))
+	for _, vrf := range plugin.vrfs {
+		vrfs = append(vrfs, vrf)
+	}
+	plugin.routesMu.Unlock()
+	sort.Slice(vrfs, func(i, j int) bool { return vrfs[i].Name < vrfs[j].Name })
+	return vrfs
+}
+
+// GetVrfRib returns best routes of given route <family> imported into VRF of given <name>, as they are seen inside the VRF
+// (routes are of unicast route family and they don't carry route distinguisher, route targets and labels).
+// Both unicast and L3VPN route families can be used as <family>. It fails with VrfNotFoundError if there is no such VRF.
+func (plugin *Plugin) GetVrfRib(name string, family bgp.RouteFamily) ([]*bgp.ReachableIPRoute, error) {
+	if err := plugin.checkStarted(); err != nil {
+		return nil, err
+	}
+	if _, err := plugin.lookupVrf(name); err != nil {
+		return nil, err
+	}
+	var rf bgpPacket.RouteFamily
+	switch family {
+	case bgp.IPv4Unicast, bgp.IPv4VPN:
+		rf = bgpPacket.RF_IPv4_UC
+	case bgp.IPv6Unicast, bgp.IPv6VPN:
+		rf = bgpPacket.RF_IPv6_UC
+	default:
+		return nil, fmt.Errorf("Route family %v is not supported in VRF", family)
+	}
+	rib, err := plugin.server.GetVrfRib(name, rf, nil)
+	if err != nil {
+		return nil, err
+	}
+	var routes []*bgp.ReachableIPRoute
+	for _, destination := range rib.GetSortedDestinations() {
+		if paths := destination.GetAllKnownPathList(); len(paths) > 0 {
+			routes = append(routes, toReachableIPRoute(paths[0]))
+		}
+	}
+	return routes, nil
+}
+
+// lookupVrf returns configured VRF of given <name> or VrfNotFoundError.
+func (plugin *Plugin) lookupVrf(name string) (Vrf, error) {
+	plugin.routesMu.Lock()
+	defer plugin.routesMu.Unlock()
+	vrf, found := plugin.vrfs[name]
+	if !found {
+		return Vrf{}, &VrfNotFoundError{Name: name}
+	}
+	return vrf, nil
+}
+
+// vrfFilter creates filter of L3VPN routes imported into VRF of given <name> (nil if <name> is empty). It fails with
+// VrfNotFoundError if there is no such VRF. Caller must hold routesMu.
+func (plugin *Plugin) vrfFilter(name string) (*bgp.RouteFilter, error) {
+	if name == "" {
+		return nil, nil
+	}
+	vrf, found := plugin.vrfs[name]
+	if !found {
+		return nil, &VrfNotFoundError{Name: name}
+	}
+	return &bgp.RouteFilter{
+		Families:     []bgp.RouteFamily{bgp.IPv4VPN, bgp.IPv6VPN},
+		RouteTargets: vrf.ImportRouteTargets,
+	}, nil
+}
+
+// parseRouteTargets parses <routeTargets> in GoBGP notation (i.e. "65000:100") into extended communities.
+func parseRouteTargets(routeTargets []string) ([]bgpPacket.ExtendedCommunityInterface, error) {
+	communities := make([]bgpPacket.ExtendedCommunityInterface, 0, len(routeTargets))
+	for _, routeTarget := range routeTargets {
+		community, err := bgpPacket.ParseRouteTarget(routeTarget)
+		if err != nil {
+			return nil, err
+		}
+		communities = append(communities, community)
+	}
+	return communities, nil
+}
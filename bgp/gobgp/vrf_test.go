@@ -0,0 +1,117 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobgp
+
+import (
+	"github.com/ligato/bgp-agent/bgp"
+	. "github.com/onsi/gomega"
+	bgpPacket "github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestVrfRouteWatching tests that L3VPN routes (carrying route distinguisher, route targets and MPLS labels) are sent only
+// to watchers of VRF that imports them and that watchers without VRF don't receive them.
+func TestVrfRouteWatching(x *testing.T) {
+	RegisterTestingT(x)
+	plugin, events := pluginWithEventWatcher()
+	plugin.vrfs["tenant1"] = Vrf{Name: "tenant1", RouteDistinguisher: "65000:1", ImportRouteTargets: []string{"65000:100"}}
+	plugin.vrfs["tenant2"] = Vrf{Name: "tenant2", RouteDistinguisher: "65000:2", ImportRouteTargets: []string{"65000:200"}}
+	tenant1Events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestTenant1Watcher", func(event *bgp.RouteEvent) {
+		tenant1Events <- *event
+	}, bgp.WithVrf("tenant1"))
+	Expect(err).To(BeNil())
+	tenant2Events := make(chan bgp.RouteEvent, 10)
+	_, err = plugin.WatchIPRouteEvents("TestTenant2Watcher", func(event *bgp.RouteEvent) {
+		tenant2Events <- *event
+	}, bgp.WithVrf("tenant2"))
+	Expect(err).To(BeNil())
+	_, err = plugin.WatchIPRouteEvents("TestUnknownVrfWatcher", func(event *bgp.RouteEvent) {}, bgp.WithVrf("unknown"))
+	Expect(err).To(BeAssignableToTypeOf(&VrfNotFoundError{}))
+
+	path := vpnPath("65000:100")
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{path}})
+	event := receiveRouteEvent(tenant1Events)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+	Expect(event.Route.Family).To(Equal(bgp.IPv4VPN))
+	Expect(event.Route.Prefix).To(Equal("10.2.0.0/24"))
+	Expect(event.Route.Nexthop.String()).To(Equal("10.0.0.1"))
+	Expect(event.Route.RouteDistinguisher).To(Equal("65000:10"))
+	Expect(event.Route.RouteTargets).To(Equal([]string{"65000:100"}))
+	Expect(event.Route.Labels).To(Equal([]uint32{16}))
+
+	// route stops to be imported into VRF
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{vpnPath("65000:200")}})
+	event = receiveRouteEvent(tenant1Events)
+	Expect(event.Type).To(Equal(bgp.RouteWithdrawn))
+	event = receiveRouteEvent(tenant2Events)
+	Expect(event.Type).To(Equal(bgp.RouteAdded))
+
+	Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+	Expect(plugin.Routes(bgp.IPv4VPN)).To(HaveLen(1))
+	_, found := plugin.LookupRoute(net.ParseIP("10.2.0.1"))
+	Expect(found).To(BeFalse())
+}
+
+// vpnPath creates goBGP path of VPNv4 prefix 10.2.0.0/24 (route distinguisher 65000:10, MPLS label 16) via 10.0.0.1
+// with given <routeTarget>.
+func vpnPath(routeTarget string) *table.Path {
+	rd, _ := bgpPacket.ParseRouteDistinguisher("65000:10")
+	rt, _ := bgpPacket.ParseRouteTarget(routeTarget)
+	nlri := bgpPacket.NewLabeledVPNIPAddrPrefix(24, "10.2.0.0", *bgpPacket.NewMPLSLabelStack(16), rd)
+	return table.NewPath(nil, nlri, false, []bgpPacket.PathAttributeInterface{
+		bgpPacket.NewPathAttributeOrigin(0),
+		bgpPacket.NewPathAttributeMpReachNLRI("10.0.0.1", []bgpPacket.AddrPrefixInterface{nlri}),
+		bgpPacket.NewPathAttributeExtendedCommunities([]bgpPacket.ExtendedCommunityInterface{rt}),
+	}, time.Now(), false)
+}
+
+// TestVrfDeletionDisconnectsWatchers tests that watcher of deleted VRF is disconnected and doesn't receive routes matching
+// route targets of deleted VRF, while watchers of other VRFs are not affected.
+func TestVrfDeletionDisconnectsWatchers(x *testing.T) {
+	RegisterTestingT(x)
+	plugin := startedPlugin()
+	defer plugin.Close()
+	Expect(plugin.AddVrf(Vrf{Name: "tenant1", ID: 1, RouteDistinguisher: "65000:1", ImportRouteTargets: []string{"65000:100"}})).To(BeNil())
+	Expect(plugin.AddVrf(Vrf{Name: "tenant2", ID: 2, RouteDistinguisher: "65000:2", ImportRouteTargets: []string{"65000:100"}})).To(BeNil())
+	tenant1Events := make(chan bgp.RouteEvent, 10)
+	_, err := plugin.WatchIPRouteEvents("TestTenant1Watcher", func(event *bgp.RouteEvent) {
+		tenant1Events <- *event
+	}, bgp.WithVrf("tenant1"))
+	Expect(err).To(BeNil())
+	tenant2Events := make(chan bgp.RouteEvent, 10)
+	_, err = plugin.WatchIPRouteEvents("TestTenant2Watcher", func(event *bgp.RouteEvent) {
+		tenant2Events <- *event
+	}, bgp.WithVrf("tenant2"))
+	Expect(err).To(BeNil())
+
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{vpnPath("65000:100")}})
+	Expect(receiveRouteEvent(tenant1Events).Type).To(Equal(bgp.RouteAdded))
+	Expect(receiveRouteEvent(tenant2Events).Type).To(Equal(bgp.RouteAdded))
+
+	Expect(plugin.DeleteVrf("tenant1")).To(BeNil())
+	Expect(receiveRouteEvent(tenant1Events).Type).To(Equal(bgp.WatchDisconnected))
+	Expect(plugin.ListWatchers()).To(HaveLen(1))
+	plugin.processBestPaths(&server.WatchEventBestPath{PathList: []*table.Path{vpnPath("65000:100")}})
+	Expect(receiveRouteEvent(tenant2Events).Type).To(Equal(bgp.RouteUpdated))
+	Consistently(tenant1Events, 100*time.Millisecond).ShouldNot(Receive())
+
+	_, err = plugin.WatchIPRouteEvents("TestTenant1Watcher", func(event *bgp.RouteEvent) {}, bgp.WithVrf("tenant1"))
+	Expect(err).To(BeAssignableToTypeOf(&VrfNotFoundError{}))
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// SessionState is state of BGP finite state machine of session with peer (RFC 4271, section 8).
+type SessionState int
+
+const (
+	// SessionIdle is initial state of BGP session, no connection attempts are made in this state
+	SessionIdle SessionState = iota
+	// SessionConnect means that BGP speaker is waiting for the TCP connection to be completed
+	SessionConnect
+	// SessionActive means that BGP speaker is trying to acquire peer by listening for and accepting TCP connection
+	SessionActive
+	// SessionOpenSent means that BGP speaker sent OPEN message and waits for OPEN message from its peer
+	SessionOpenSent
+	// SessionOpenConfirm means that BGP speaker waits for KEEPALIVE or NOTIFICATION message after exchange of OPEN messages
+	SessionOpenConfirm
+	// SessionEstablished means that BGP speaker can exchange UPDATE, NOTIFICATION and KEEPALIVE messages with its peer
+	SessionEstablished
+)
+
+// String returns human readable name of session state.
+func (s SessionState) String() string {
+	switch s {
+	case SessionIdle:
+		return "idle"
+	case SessionConnect:
+		return "connect"
+	case SessionActive:
+		return "active"
+	case SessionOpenSent:
+		return "opensent"
+	case SessionOpenConfirm:
+		return "openconfirm"
+	case SessionEstablished:
+		return "established"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// AdminState is administrative state of peer.
+type AdminState int
+
+const (
+	// AdminStateUp means that peer is administratively enabled
+	AdminStateUp AdminState = iota
+	// AdminStateDown means that peer is administratively disabled
+	AdminStateDown
+	// AdminStatePrefixLimitExceeded means that session with peer was shut down because the peer exceeded prefix limit
+	AdminStatePrefixLimitExceeded
+)
+
+// String returns human readable name of administrative state.
+func (s AdminState) String() string {
+	switch s {
+	case AdminStateUp:
+		return "up"
+	case AdminStateDown:
+		return "down"
+	case AdminStatePrefixLimitExceeded:
+		return "prefix-limit-exceeded"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// Notification identifies BGP NOTIFICATION message by its error code and error subcode (RFC 4271, section 4.5).
+type Notification struct {
+	Code    uint8
+	Subcode uint8
+}
+
+// String returns notification in "code X subcode Y" notation.
+func (n Notification) String() string {
+	return fmt.Sprintf("code %d subcode %d", n.Code, n.Subcode)
+}
+
+// PeerStateEvent represents change of state of BGP session with one peer. PeerAs and RouterID are known only after
+// the exchange of OPEN messages. LastNotification is the last NOTIFICATION message sent to or received from the peer
+// (nil if no notification was exchanged yet). Timestamp is the time of the state change, Stamp identifies position
+// of the event in the stream of events sent to watcher (see EventStamp).
+type PeerStateEvent struct {
+	PeerAddress      net.IP
+	PeerAs           uint32
+	RouterID         net.IP
+	OldState         SessionState
+	NewState         SessionState
+	AdminState       AdminState
+	Timestamp        time.Time
+	LastNotification *Notification
+	Stamp            EventStamp
+}
+
+// PeerStateWatcher provides the ability to have external clients(watchers) that are notified about changes of BGP session
+// state with peers (i.e. loss of session with route reflector).
+type PeerStateWatcher interface {
+	//WatchPeerState register watcher to notifications about changes of BGP session state.
+	//Watcher have to identify himself by name(<watcher> param) and provide <callback> that receives the state changes.
+	//WatchPeerState returns <bgp.WatchRegistration> as way how to end the registration in the future.
+	//Registration semantics (errors for nil callback and duplicate names) are the same as for Watcher.WatchIPRoutes,
+	//but names of peer state watchers are independent of names of route watchers.
+	WatchPeerState(watcher string, callback func(*PeerStateEvent)) (WatchRegistration, error)
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"net"
+)
+
+// RouteReader provides read access to currently reachable routes (best paths) learned by BGP plugin, so that its clients
+// don't need to keep their own copy of the route table.
+type RouteReader interface {
+	//Routes returns all currently reachable routes. If <families> are given, only routes of these route families are returned.
+	Routes(families ...RouteFamily) []*ReachableIPRoute
+
+	//Route returns reachable route for exactly the given <prefix> (in CIDR notation). Found is false if prefix is not reachable.
+	//Error is returned only if <prefix> can't be parsed.
+	Route(prefix string) (route *ReachableIPRoute, found bool, err error)
+
+	//LookupRoute returns reachable route whose prefix is the longest prefix matching the <ip> address.
+	//Found is false if no reachable prefix contains <ip>.
+	LookupRoute(ip net.IP) (route *ReachableIPRoute, found bool)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNilCallback is returned by watcher registration if no callback is given.
+var ErrNilCallback = errors.New("Can't register watcher without callback")
+
+// DuplicateWatcherError is returned by watcher registration if watcher with the same name is already registered
+// (for the same kind of information). Name can be reused only after the previous registration is closed.
+type DuplicateWatcherError struct {
+	Watcher string
+}
+
+// Error returns description of DuplicateWatcherError.
+func (err *DuplicateWatcherError) Error() string {
+	return fmt.Sprintf("Watcher %s is already registered", err.Watcher)
+}
+
+// WatcherKind is kind of information that watcher is registered for.
+type WatcherKind int
+
+const (
+	// RouteWatcherKind is kind of watchers registered by WatchIPRoutes or WatchIPRouteEvents
+	RouteWatcherKind WatcherKind = iota
+	// PeerStateWatcherKind is kind of watchers registered by WatchPeerState
+	PeerStateWatcherKind
+	// EVPNWatcherKind is kind of watchers registered by WatchEVPNRoutes
+	EVPNWatcherKind
+	// FlowSpecWatcherKind is kind of watchers registered by WatchFlowSpec
+	FlowSpecWatcherKind
+)
+
+// String returns human readable name of watcher kind.
+func (kind WatcherKind) String() string {
+	switch kind {
+	case RouteWatcherKind:
+		return "route"
+	case PeerStateWatcherKind:
+		return "peer-state"
+	case EVPNWatcherKind:
+		return "evpn"
+	case FlowSpecWatcherKind:
+		return "flowspec"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(kind))
+	}
+}
+
+// WatcherInfo describes one registered watcher.
+type WatcherInfo struct {
+	// ID is unique identification of registration (see WatchRegistration.ID())
+	ID           uint64
+	Name         string
+	Kind         WatcherKind
+	RegisteredAt time.Time
+	Stats        WatchStats
+}
+
+// WatcherLister provides introspection of registered watchers.
+type WatcherLister interface {
+	// ListWatchers returns all currently registered watchers (ordered by registration ID) with their delivery statistics.
+	ListWatchers() []WatcherInfo
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"context"
+	"sync"
+)
+
+// ContextWatcher provides channel-based watching of IP-based routes whose lifetime is bound to context.
+type ContextWatcher interface {
+	// WatchIPRoutesContext register watcher to notifications for any change of IP-based routes. Route events are sent
+	// to returned event channel until <ctx> is cancelled, then the watcher is unregistered and both returned channels
+	// are closed. Registration semantics and <opts> are the same as for Watcher.WatchIPRouteEvents.
+	// Error channel receives failure of registration or unregistration.
+	WatchIPRoutesContext(ctx context.Context, watcher string, opts ...WatchOption) (<-chan RouteEvent, <-chan error)
+}
+
+// WatchContext adapts callback-based <w> (Watcher.WatchIPRouteEvents) to channel-based watching bound to <ctx>
+// (see ContextWatcher.WatchIPRoutesContext). Events are sent to event channel by watcher's callback, so backpressure
+// of slow reader is handled by watcher's queue (see WithQueue()). Watching ends also after WatchDisconnected event
+// is sent to event channel, because the watcher is already unregistered at that time.
+func WatchContext(ctx context.Context, w Watcher, watcher string, opts ...WatchOption) (<-chan RouteEvent, <-chan error) {
+	adapter := &contextAdapter{
+		events:       make(chan RouteEvent),
+		errors:       make(chan error, 1),
+		stop:         make(chan struct{}),
+		disconnected: make(chan struct{}),
+	}
+	registration, err := w.WatchIPRouteEvents(watcher, adapter.send, opts...)
+	if err != nil {
+		adapter.errors <- err
+		close(adapter.errors)
+		close(adapter.events)
+		return adapter.events, adapter.errors
+	}
+	go adapter.closeWhenDone(ctx, registration)
+	return adapter.events, adapter.errors
+}
+
+// contextAdapter passes events from watcher's callback to channel until the watching is ended.
+type contextAdapter struct {
+	sync.RWMutex            // callbacks hold read lock, so that event channel is not closed during sending
+	stopped            bool // true if event channel is closed
+	events             chan RouteEvent
+	errors             chan error
+	stop               chan struct{} // closed when watching ends, unblocks callbacks waiting for reader
+	disconnected       chan struct{} // closed after WatchDisconnected event is sent
+	disconnectedSignal sync.Once
+}
+
+// send is watcher's callback that sends <event> to event channel (or drops it if watching already ended).
+func (adapter *contextAdapter) send(event *RouteEvent) {
+	adapter.RLock()
+	defer adapter.RUnlock()
+	if adapter.stopped {
+		return
+	}
+	select {
+	case adapter.events <- *event:
+	case <-adapter.stop:
+		return
+	}
+	if event.Type == WatchDisconnected {
+		adapter.disconnectedSignal.Do(func() { close(adapter.disconnected) })
+	}
+}
+
+// closeWhenDone waits for cancellation of <ctx> (or disconnection of watcher), then closes <registration> and both channels.
+func (adapter *contextAdapter) closeWhenDone(ctx context.Context, registration WatchRegistration) {
+	select {
+	case <-ctx.Done():
+	case <-adapter.disconnected:
+	}
+	close(adapter.stop)
+	if err := registration.Close(); err != nil {
+		adapter.errors <- err
+	}
+	adapter.Lock()
+	adapter.stopped = true
+	close(adapter.events)
+	close(adapter.errors)
+	adapter.Unlock()
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2017 Pantheon technologies s.r.o.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"fmt"
+	"time"
+)
+
+// WatchOption is optional setting of watch registration (see Watcher). Options are applied to WatchOptions in the order
+// in which they are passed to registration.
+type WatchOption func(*WatchOptions)
+
+// WatchOptions contains all settings of one watch registration. It is meant for Watcher implementations,
+// watchers should use WatchOption functions (i.e. WithRIBSnapshot()) to change settings.
+type WatchOptions struct {
+	// RIBSnapshot is true if watcher wants to receive snapshot of currently reachable routes before live updates
+	RIBSnapshot bool
+	// Filter restricts routes that are sent to watcher (nil means no restriction)
+	Filter *RouteFilter
+	// QueueSize is maximal count of events waiting for delivery to watcher
+	QueueSize int
+	// OverflowPolicy says what happens when watcher's queue is full
+	OverflowPolicy OverflowPolicy
+	// Vrf is name of VRF whose imported L3VPN routes are sent to watcher (empty means no VRF, L3VPN routes are then
+	// not sent to watcher)
+	Vrf string
+	// AllPaths is true if watcher wants to receive all paths received from peers (post-policy) instead of best paths
+	AllPaths bool
+	// BatchSize is maximal count of events passed at once to callback of batch watcher (see Watcher.WatchIPRouteBatches())
+	BatchSize int
+	// FlushInterval is maximal time that events of batch watcher wait for more events before they are passed to its callback
+	// (0 means that events are passed as soon as processing of event of BGP implementation ends)
+	FlushInterval time.Duration
+}
+
+// DefaultQueueSize is default maximal count of events waiting for delivery to one watcher.
+const DefaultQueueSize = 1024
+
+// DefaultBatchSize is default maximal count of events passed at once to callback of batch watcher.
+const DefaultBatchSize = 1024
+
+// OverflowPolicy says what happens when event should be sent to watcher whose queue of not yet delivered events is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks processing of route changes until watcher's queue has free space again (no event is lost,
+	// but slow watcher delays other watchers)
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest event waiting in watcher's queue
+	OverflowDropOldest
+	// OverflowCoalesce merges event with event of the same prefix waiting in watcher's queue (see MergeRouteEvents()).
+	// If there is no such event, processing of route changes is blocked as with OverflowBlock.
+	OverflowCoalesce
+	// OverflowDisconnect drops all events waiting in watcher's queue and ends the registration. WatchDisconnected event
+	// is sent to watcher as the last event.
+	OverflowDisconnect
+)
+
+// String returns human readable name of overflow policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowCoalesce:
+		return "coalesce"
+	case OverflowDisconnect:
+		return "disconnect"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(p))
+	}
+}
+
+// WatchStats are statistics of event delivery to one watcher.
+type WatchStats struct {
+	// Queued is count of events waiting for delivery
+	Queued int
+	// Delivered is count of events passed to watcher
+	Delivered uint64
+	// Dropped is count of events that were dropped due to full queue (OverflowDropOldest and OverflowDisconnect)
+	Dropped uint64
+	// Coalesced is count of events that were merged into other events due to full queue (OverflowCoalesce)
+	Coalesced uint64
+}
+
+// NewWatchOptions creates WatchOptions with default settings and applies all <opts> to them.
+func NewWatchOptions(opts ...WatchOption) *WatchOptions {
+	options := &WatchOptions{QueueSize: DefaultQueueSize, OverflowPolicy: OverflowBlock, BatchSize: DefaultBatchSize}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithRIBSnapshot makes registration retroactive. Watcher first receives all currently reachable routes
+// (as RouteAdded events) followed by RIBSnapshotEnd event. Live updates are sent after that without any gap or duplicates
+// between snapshot and live updates.
+func WithRIBSnapshot() WatchOption {
+	return func(options *WatchOptions) {
+		options.RIBSnapshot = true
+	}
+}
+
+// WithFilter restricts routes that are sent to watcher to routes passing <filter>. Filter is evaluated by Watcher
+// implementation before watcher's callback is called (see RouteFilter.FilterEvent() for handling of route updates
+// and withdrawals).
+func WithFilter(filter *RouteFilter) WatchOption {
+	return func(options *WatchOptions) {
+		options.Filter = filter
+	}
+}
+
+// WithQueue sets maximal count of events waiting for delivery to watcher (<size>) and <policy> applied when this count
+// is reached. Events are delivered to each watcher by its own goroutine, so slow watcher doesn't delay other watchers
+// unless OverflowBlock or OverflowCoalesce policy is used. Sizes lower than 1 are replaced by DefaultQueueSize.
+func WithQueue(size int, policy OverflowPolicy) WatchOption {
+	return func(options *WatchOptions) {
+		if size < 1 {
+			size = DefaultQueueSize
+		}
+		options.QueueSize = size
+		options.OverflowPolicy = policy
+	}
+}
+
+// WithVrf subscribes watcher to L3VPN routes imported into VRF of given <name> (routes with any of VRF's import route
+// targets). Other routes are not sent to such watcher. Watchers registered without this option don't receive
+// L3VPN routes. Watcher of VRF is disconnected (see WatchDisconnected) when the VRF is deleted.
+func WithVrf(name string) WatchOption {
+	return func(options *WatchOptions) {
+		options.Vrf = name
+	}
+}
+
+// WithAllPaths makes watcher receive all paths (after import policy) received from peers instead of best paths only.
+// Paths of the same prefix are told apart by source peer and path identifier (ADD-PATH, RFC 7911) of route, so that
+// watcher can do its own path selection or precompute fast-reroute backup paths. RouteAdded event is sent for new path,
+// RouteUpdated for path replaced by the same peer (with the same path identifier) and RouteWithdrawn for withdrawn path.
+// Paths of peer are withdrawn also when session with the peer is lost. Locally originated routes are not sent in this mode.
+func WithAllPaths() WatchOption {
+	return func(options *WatchOptions) {
+		options.AllPaths = true
+	}
+}
+
+// WithBatching sets maximal count of events passed at once to callback of batch watcher (<size>) and maximal time that
+// events wait for more events before they are passed (<flushInterval>). Events caused by one event of BGP implementation
+// (i.e. one received update) are passed together unless the batch is full. Events of more such events are gathered
+// into one batch only if <flushInterval> is positive. Sizes lower than 1 are replaced by DefaultBatchSize.
+// The option applies only to batch watchers (see Watcher.WatchIPRouteBatches()).
+func WithBatching(size int, flushInterval time.Duration) WatchOption {
+	return func(options *WatchOptions) {
+		if size < 1 {
+			size = DefaultBatchSize
+		}
+		options.BatchSize = size
+		options.FlushInterval = flushInterval
+	}
+}